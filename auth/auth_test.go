@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := HashPassword("password123")
+	require.NoError(t, err)
+	assert.NotEqual(t, "password123", hash)
+
+	assert.NoError(t, CheckPassword(hash, "password123"))
+	assert.Equal(t, model.ErrInvalidCredentials, CheckPassword(hash, "wrong-password"))
+}
+
+func TestTokenManager(t *testing.T) {
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	now := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		token       func(tm *TokenManager) string
+		verifyAt    time.Time
+		expectedErr error
+	}{
+		{
+			name: "valid_token",
+			token: func(tm *TokenManager) string {
+				token, _, _ := tm.Issue(userID)
+				return token
+			},
+			verifyAt: now.Add(time.Minute),
+		},
+		{
+			name: "expired_token",
+			token: func(tm *TokenManager) string {
+				token, _, _ := tm.Issue(userID)
+				return token
+			},
+			verifyAt:    now.Add(2 * time.Hour),
+			expectedErr: model.ErrTokenExpired,
+		},
+		{
+			name: "tampered_signature",
+			token: func(tm *TokenManager) string {
+				token, _, _ := tm.Issue(userID)
+				return token + "x"
+			},
+			verifyAt:    now,
+			expectedErr: model.ErrInvalidToken,
+		},
+		{
+			name: "signed_with_other_secret",
+			token: func(_ *TokenManager) string {
+				other := NewTokenManager("other-secret", time.Hour)
+				other.now = func() time.Time { return now }
+				token, _, _ := other.Issue(userID)
+				return token
+			},
+			verifyAt:    now,
+			expectedErr: model.ErrInvalidToken,
+		},
+		{
+			name:        "malformed_token",
+			token:       func(_ *TokenManager) string { return "not-a-token" },
+			verifyAt:    now,
+			expectedErr: model.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTokenManager("test-secret", time.Hour)
+			tm.now = func() time.Time { return now }
+			token := tt.token(tm)
+
+			tm.now = func() time.Time { return tt.verifyAt }
+			subject, err := tm.Verify(token)
+			if tt.expectedErr != nil {
+				assert.Equal(t, tt.expectedErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, userID, subject)
+			assert.Equal(t, 2, len(strings.Split(token, ".")))
+		})
+	}
+}
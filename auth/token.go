@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"microblogging/model"
+	"strings"
+	"time"
+)
+
+// TokenManager issues and verifies HMAC-SHA256 signed bearer tokens
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+type claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func NewTokenManager(secret string, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret: []byte(secret),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Issue creates a signed token for the given user, returning it with its expiration time
+func (t *TokenManager) Issue(userID string) (string, time.Time, error) {
+	now := t.now().UTC()
+	expiresAt := now.Add(t.ttl)
+	payload, err := json.Marshal(claims{
+		Subject:   userID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + t.sign(encoded), expiresAt, nil
+}
+
+// Verify checks the token signature and expiration and returns the user ID it was issued for
+func (t *TokenManager) Verify(token string) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || encoded == "" || signature == "" {
+		return "", model.ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return "", model.ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", model.ErrInvalidToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.Subject == "" {
+		return "", model.ErrInvalidToken
+	}
+	if t.now().UTC().Unix() >= c.ExpiresAt {
+		return "", model.ErrTokenExpired
+	}
+	return c.Subject, nil
+}
+
+func (t *TokenManager) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
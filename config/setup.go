@@ -3,13 +3,18 @@ package config
 import (
 	"context"
 	"fmt"
+	"io"
+	"microblogging/auth"
+	"microblogging/migrations"
 	t "microblogging/model"
 	d "microblogging/repository"
 	srv "microblogging/server"
 	"microblogging/service"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
@@ -19,6 +24,22 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+const (
+	defaultTokenTTL           = 24 * time.Hour
+	storageMemory             = "memory"
+	defaultCelebrityThreshold = 10000
+)
+
+// Request deadlines, past which the queries of a request are cancelled
+const (
+	// readDeadline bounds the lookups of a single post, user or relation page
+	readDeadline = 2 * time.Second
+	// feedDeadline bounds the timelines, threads, searches and notifications
+	feedDeadline = 5 * time.Second
+	// writeDeadline bounds the requests that change data
+	writeDeadline = 5 * time.Second
+)
+
 type flags struct {
 	Host     string `validate:"required"`
 	Port     int    `validate:"required"`
@@ -30,6 +51,18 @@ type flags struct {
 
 // Setup
 func Setup(ctx context.Context) (d.PostRepository, error) {
+	// Setup logger
+	logger, err := SetupLogger()
+	if err != nil {
+		return nil, fmt.Errorf("could not configure logger: %w", err)
+	}
+
+	// STORAGE=memory runs the service without Postgres
+	if os.Getenv("STORAGE") == storageMemory {
+		logger.Warn("Using in-memory storage, data is lost on restart")
+		return d.NewMemoryRepository(logger), nil
+	}
+
 	// Get DB parameters from flags
 	dbConfig, err := setupFlags()
 	if err != nil {
@@ -42,14 +75,85 @@ func Setup(ctx context.Context) (d.PostRepository, error) {
 		return nil, fmt.Errorf("could not configure DB: %w", err)
 	}
 
-	// Setup logger
-	logger, err := SetupLogger()
+	// MIGRATE_ON_START=true applies the pending migrations before serving
+	if migrate, _ := strconv.ParseBool(os.Getenv("MIGRATE_ON_START")); migrate {
+		migrator, err := migrations.NewMigrator(db, logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not load migrations: %w", err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			return nil, fmt.Errorf("could not migrate DB: %w", err)
+		}
+	}
+
+	// TIMELINE_FANOUT=true materializes home timelines on write
+	fanout, err := SetupFanout(ctx, db, logger)
 	if err != nil {
-		return nil, fmt.Errorf("could not configure logger: %w", err)
+		return nil, fmt.Errorf("could not configure timeline fan-out: %w", err)
 	}
 
 	// Return a PostRepository (DBConnector now implements PostRepository)
-	return SetupRepository(db, logger), nil
+	return SetupRepository(db, logger, fanout), nil
+}
+
+// Migrate runs the migrate subcommand: "up" applies the pending migrations, "down" reverts the
+// latest one and "status" lists them. Its report is written to out.
+func Migrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+	logger, err := SetupLogger()
+	if err != nil {
+		return fmt.Errorf("could not configure logger: %w", err)
+	}
+	dbConfig, err := setupFlags()
+	if err != nil {
+		return fmt.Errorf("could not get DB params: %w", err)
+	}
+	db, err := SetupDB(dbConfig)
+	if err != nil {
+		return fmt.Errorf("could not configure DB: %w", err)
+	}
+	defer db.Close()
+	migrator, err := migrations.NewMigrator(db, logger)
+	if err != nil {
+		return fmt.Errorf("could not load migrations: %w", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down or status", args[0])
+	}
+	return nil
 }
 
 func setupFlags() (t.DatabaseConfig, error) {
@@ -105,26 +209,121 @@ func SetupLogger() (*zap.Logger, error) {
 	return logger, nil
 }
 
-func SetupRepository(db *sqlx.DB, logger *zap.Logger) d.PostRepository {
+// SetupAuth builds the token manager used to sign and verify session tokens
+func SetupAuth() (*auth.TokenManager, error) {
+	secret := os.Getenv("AUTH_TOKEN_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("AUTH_TOKEN_SECRET is required")
+	}
+
+	ttl := defaultTokenTTL
+	if raw := os.Getenv("AUTH_TOKEN_TTL"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid AUTH_TOKEN_TTL %q", raw)
+		}
+		ttl = parsed
+	}
+
+	return auth.NewTokenManager(secret, ttl), nil
+}
+
+// SetupService builds the blog service on top of repo. POST_EDIT_WINDOW, a duration such as 15m,
+// limits how long after their creation posts can be edited.
+func SetupService(repo d.PostRepository) (service.BlogService, error) {
+	var opts []service.Option
+	if raw := os.Getenv("POST_EDIT_WINDOW"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid POST_EDIT_WINDOW %q", raw)
+		}
+		opts = append(opts, service.WithEditWindow(window))
+	}
+	return service.NewBlogService(repo, opts...), nil
+}
+
+// SetupFanout starts the home timeline fan-out worker when TIMELINE_FANOUT is enabled.
+// Authors with more than TIMELINE_CELEBRITY_THRESHOLD followers are not fanned out.
+func SetupFanout(ctx context.Context, db *sqlx.DB, logger *zap.Logger) (*d.FanoutWorker, error) {
+	enabled, _ := strconv.ParseBool(os.Getenv("TIMELINE_FANOUT"))
+	if !enabled {
+		return nil, nil
+	}
+
+	threshold := defaultCelebrityThreshold
+	if raw := os.Getenv("TIMELINE_CELEBRITY_THRESHOLD"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid TIMELINE_CELEBRITY_THRESHOLD %q", raw)
+		}
+		threshold = parsed
+	}
+
+	worker := d.NewFanoutWorker(db, logger, d.FanoutConfig{CelebrityThreshold: threshold})
+	go worker.Run(ctx)
+	logger.Sugar().Infow("Timeline fan-out enabled", "celebrity_threshold", threshold)
+	return worker, nil
+}
+
+func SetupRepository(db *sqlx.DB, logger *zap.Logger, fanout *d.FanoutWorker) d.PostRepository {
 	return &d.DBConnector{
 		DB:     db,
 		Logger: logger,
+		Fanout: fanout,
 	}
 }
 
-func ServerSetup(svc service.BlogService) {
-	s := srv.NewServer(context.Background(), svc)
+// ServerSetup serves the API until ctx is done. Every request is served under the deadline of its
+// endpoint, the timeline stream and the websocket gateway bound each of their queries instead.
+func ServerSetup(ctx context.Context, svc service.BlogService, tokens *auth.TokenManager) {
+	s := srv.NewServer(ctx, svc, tokens)
+	read := func(h http.HandlerFunc) http.HandlerFunc { return s.WithDeadline(readDeadline, h) }
+	feed := func(h http.HandlerFunc) http.HandlerFunc { return s.WithDeadline(feedDeadline, h) }
+	write := func(h http.HandlerFunc) http.HandlerFunc { return s.WithDeadline(writeDeadline, h) }
 
 	router := mux.NewRouter()
 	api := router.PathPrefix("/V1").Subrouter()
-	api.HandleFunc("/post", s.CreatePostHandler).Methods("POST")
-	api.HandleFunc("/user", s.CreateUserHandler).Methods("POST")
-	api.HandleFunc("/posts", s.UpdatePostPutHandler).Methods("PUT")
-	api.HandleFunc("/timeline", s.GetTimelineHandler).Methods("GET")
-	api.HandleFunc("/follow", s.FollowUserHandler).Methods("POST")
-	api.HandleFunc("/unfollow", s.UnfollowUserHandler).Methods("POST")
-	api.HandleFunc("/followees/{id}", s.GetFolloweesHandler).Methods("GET")
-	api.HandleFunc("/user/{id}", s.DeleteUserHandler).Methods("DELETE")
-	port := ":8080"
-	http.ListenAndServe(port, router)
+	api.HandleFunc("/user", write(s.CreateUserHandler)).Methods("POST")
+	api.HandleFunc("/login", write(s.LoginHandler)).Methods("POST")
+	// the websocket gateway authenticates on connect, browsers cannot send the Authorization header
+	api.HandleFunc("/ws", s.WebSocketHandler).Methods("GET")
+
+	// every other route requires a valid bearer token
+	protected := api.NewRoute().Subrouter()
+	protected.Use(s.Authenticate)
+	protected.HandleFunc("/post", write(s.CreatePostHandler)).Methods("POST")
+	protected.HandleFunc("/posts", write(s.UpdatePostPutHandler)).Methods("PUT")
+	protected.HandleFunc("/posts/{id}", read(s.GetPostHandler)).Methods("GET")
+	protected.HandleFunc("/posts/{id}", write(s.PatchPostHandler)).Methods("PATCH")
+	protected.HandleFunc("/posts/{id}", write(s.DeletePostHandler)).Methods("DELETE")
+	protected.HandleFunc("/posts/{id}/thread", feed(s.GetThreadHandler)).Methods("GET")
+	protected.HandleFunc("/posts/{id}/revisions", read(s.GetPostRevisionsHandler)).Methods("GET")
+	protected.HandleFunc("/posts/{id}/like", write(s.LikePostHandler)).Methods("POST", "DELETE")
+	protected.HandleFunc("/posts/{id}/repost", write(s.RepostHandler)).Methods("POST")
+	protected.HandleFunc("/users/{id}/posts", feed(s.GetUserPostsHandler)).Methods("GET")
+	protected.HandleFunc("/users/{id}/mentions", feed(s.GetMentionsHandler)).Methods("GET")
+	protected.HandleFunc("/hashtags/{tag}/posts", feed(s.GetHashtagPostsHandler)).Methods("GET")
+	protected.HandleFunc("/timeline", feed(s.GetTimelineHandler)).Methods("GET")
+	protected.HandleFunc("/timeline/stream", s.StreamTimelineHandler).Methods("GET")
+	protected.HandleFunc("/notifications", feed(s.GetNotificationsHandler)).Methods("GET")
+	protected.HandleFunc("/notifications/read", write(s.ReadNotificationsHandler)).Methods("POST")
+	protected.HandleFunc("/follow", write(s.FollowUserHandler)).Methods("POST")
+	protected.HandleFunc("/unfollow", write(s.UnfollowUserHandler)).Methods("POST")
+	protected.HandleFunc("/followees/{id}", read(s.GetFolloweesHandler)).Methods("GET")
+	protected.HandleFunc("/followers/{id}", read(s.GetFollowersHandler)).Methods("GET")
+	protected.HandleFunc("/users/{id}/block", write(s.BlockUserHandler)).Methods("POST", "DELETE")
+	protected.HandleFunc("/users/{id}/mute", write(s.MuteUserHandler)).Methods("POST", "DELETE")
+	protected.HandleFunc("/blocks", read(s.GetBlockedUsersHandler)).Methods("GET")
+	protected.HandleFunc("/mutes", read(s.GetMutedUsersHandler)).Methods("GET")
+	protected.HandleFunc("/follow-requests", read(s.GetFollowRequestsHandler)).Methods("GET")
+	protected.HandleFunc("/follow-requests/{id}", write(s.FollowRequestHandler)).Methods("POST", "DELETE")
+	protected.HandleFunc("/user/{id}", read(s.GetUserHandler)).Methods("GET")
+	protected.HandleFunc("/user/{id}", write(s.DeleteUserHandler)).Methods("DELETE")
+	protected.HandleFunc("/user/{id}/privacy", write(s.SetPrivacyHandler)).Methods("PUT")
+	server := &http.Server{
+		Addr:        ":8080",
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	server.ListenAndServe()
 }
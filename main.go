@@ -2,16 +2,32 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"microblogging/config"
-	"microblogging/service"
+	"os"
 )
 
 func main() {
 	ctx := context.Background()
+	// migrate up|down|status manages the schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := config.Migrate(ctx, os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	db, err := config.Setup(ctx)
 	if err != nil {
 		panic(err)
 	}
-	svc := service.NewBlogService(db)
-	config.ServerSetup(svc)
+	tokens, err := config.SetupAuth()
+	if err != nil {
+		panic(err)
+	}
+	svc, err := config.SetupService(db)
+	if err != nil {
+		panic(err)
+	}
+	config.ServerSetup(ctx, svc, tokens)
 }
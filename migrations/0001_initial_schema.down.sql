@@ -0,0 +1,4 @@
+-- the pgcrypto extension is left in place, other schemas of the database may use it
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS posts;
@@ -1,3 +1,7 @@
+-- the baseline schema, the one the postgres container created on its first start before migrations.
+-- Its statements are idempotent so that the databases created that way adopt it, every later
+-- change is a migration of its own.
+
 CREATE EXTENSION IF NOT EXISTS "pgcrypto";
 
 CREATE TABLE IF NOT EXISTS posts (
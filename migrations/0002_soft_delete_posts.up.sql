@@ -0,0 +1,4 @@
+-- deleted posts keep their row, deleted_at hides them from every read
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_created_at ON posts (user_id, created_at DESC) WHERE deleted_at IS NULL;
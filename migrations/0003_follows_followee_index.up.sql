@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_follows_followee ON follows (followee_id, follower_id) WHERE is_active = TRUE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_posts_user_created_at;
+CREATE INDEX idx_posts_user_created_at ON posts (user_id, created_at DESC) WHERE deleted_at IS NULL;
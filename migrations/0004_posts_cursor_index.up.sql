@@ -0,0 +1,3 @@
+-- timelines page on (created_at, id), the index breaks the ties of created_at on id
+DROP INDEX IF EXISTS idx_posts_user_created_at;
+CREATE INDEX idx_posts_user_created_at ON posts (user_id, created_at DESC, id DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS home_timeline;
+
+DROP INDEX IF EXISTS idx_posts_not_fanned_out;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS fanned_out;
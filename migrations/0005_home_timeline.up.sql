@@ -0,0 +1,15 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS fanned_out BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_not_fanned_out ON posts (user_id, created_at DESC, id DESC) WHERE deleted_at IS NULL AND fanned_out = FALSE;
+
+-- fan-out-on-write timeline, one row per (follower, post), filled by the fan-out worker
+CREATE TABLE IF NOT EXISTS home_timeline (
+    user_id UUID NOT NULL,
+    post_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_home_timeline_user_created_at ON home_timeline (user_id, created_at DESC, post_id DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_in_reply_to;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS in_reply_to;
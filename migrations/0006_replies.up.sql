@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS in_reply_to UUID REFERENCES posts(id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_in_reply_to ON posts (in_reply_to, created_at, id) WHERE in_reply_to IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS likes;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS like_count;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_posts_unique_repost;
+DROP INDEX IF EXISTS idx_posts_repost_of;
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_kind_repost_of_check;
+ALTER TABLE posts DROP COLUMN IF EXISTS repost_of;
+ALTER TABLE posts DROP COLUMN IF EXISTS kind;
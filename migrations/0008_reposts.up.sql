@@ -0,0 +1,8 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'post' CHECK (kind IN ('post', 'repost', 'quote'));
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS repost_of UUID REFERENCES posts(id);
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_kind_repost_of_check;
+ALTER TABLE posts ADD CONSTRAINT posts_kind_repost_of_check CHECK ((kind = 'post') = (repost_of IS NULL));
+
+CREATE INDEX IF NOT EXISTS idx_posts_repost_of ON posts (repost_of, created_at DESC, id DESC) WHERE kind = 'repost' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_unique_repost ON posts (user_id, repost_of) WHERE kind = 'repost' AND deleted_at IS NULL;
@@ -0,0 +1,11 @@
+-- post_hashtags indexes the normalized hashtags of each post, created_at is copied from the post
+-- so hashtag feeds page on (tag, created_at, post_id) without touching posts
+CREATE TABLE IF NOT EXISTS post_hashtags (
+    post_id UUID NOT NULL,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, tag),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_hashtags_tag_created_at ON post_hashtags (tag, created_at DESC, post_id DESC);
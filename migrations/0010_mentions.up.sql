@@ -0,0 +1,13 @@
+-- post_mentions holds the @usernames of each post that resolved to a user, char_offset and
+-- char_length locate the mention in the content in characters
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    char_offset INT NOT NULL,
+    char_length INT NOT NULL,
+    PRIMARY KEY (post_id, char_offset),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id, post_id);
@@ -0,0 +1,18 @@
+-- notifications holds one row per event a user is notified of (follow, like, reply or mention),
+-- repeating an event does not notify twice and undoing it deletes its row
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    actor_id UUID NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('follow', 'like', 'reply', 'mention')),
+    post_id UUID NULL,
+    created_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP NULL,
+    UNIQUE NULLS NOT DISTINCT (user_id, type, actor_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created_at ON notifications (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_follows_pending;
+
+ALTER TABLE follows DROP CONSTRAINT IF EXISTS follows_active_pending_check;
+ALTER TABLE follows DROP COLUMN IF EXISTS is_pending;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_private;
@@ -0,0 +1,10 @@
+-- the posts of private accounts are only shown to the followers they approved
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- a follow of a private account is a pending request until the followee approves it
+ALTER TABLE follows ADD COLUMN IF NOT EXISTS is_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE follows DROP CONSTRAINT IF EXISTS follows_active_pending_check;
+ALTER TABLE follows ADD CONSTRAINT follows_active_pending_check CHECK (NOT (is_active AND is_pending));
+
+CREATE INDEX IF NOT EXISTS idx_follows_pending ON follows (followee_id, follower_id) WHERE is_pending = TRUE;
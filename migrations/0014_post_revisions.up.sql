@@ -0,0 +1,14 @@
+-- edit_count is the number of rows of the post in post_revisions
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS edit_count INTEGER NOT NULL DEFAULT 0 CHECK (edit_count >= 0);
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS edited BOOLEAN GENERATED ALWAYS AS (edit_count > 0) STORED;
+
+-- post_revisions keeps the previous contents of edited posts, revision 1 is the content the post
+-- was created with and created_at is when each content was published
+CREATE TABLE IF NOT EXISTS post_revisions (
+    post_id UUID NOT NULL,
+    revision INT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, revision),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
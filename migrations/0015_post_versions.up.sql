@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_warning TEXT CHECK (char_length(content_warning) <= 100);
+
+-- version is incremented by every update, PATCH /V1/posts/{id} compares it with If-Match
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
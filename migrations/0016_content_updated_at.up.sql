@@ -0,0 +1,8 @@
+-- content_updated_at is when the content of a post was last written, a revision is dated with it
+-- rather than with updated_at which any update moves
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_updated_at TIMESTAMP;
+
+-- the last content edit of existing posts is unknown, updated_at is the closest value kept
+UPDATE posts SET content_updated_at = updated_at WHERE content_updated_at IS NULL;
+
+ALTER TABLE posts ALTER COLUMN content_updated_at SET NOT NULL;
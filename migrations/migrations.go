@@ -0,0 +1,297 @@
+// Package migrations versions the database schema. Each migration is a pair of embedded SQL files,
+// NNNN_name.up.sql and NNNN_name.down.sql, applied in version order and recorded in the
+// schema_migrations table. Every schema change, such as a new column, must be a new migration:
+// applied migrations are never edited.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// lockID is the key of the advisory lock held while a migration runs, so that instances started
+// together do not apply the same migration twice
+const lockID = 7_452_301
+
+var (
+	ErrNoMigration      = errors.New("no migration to revert")
+	ErrUnknownMigration = errors.New("applied migration is unknown to this build")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change of the schema and the change that reverts it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, AppliedAt is nil for pending migrations
+type Status struct {
+	Version   int        `db:"version"`
+	Name      string     `db:"name"`
+	AppliedAt *time.Time `db:"applied_at"`
+}
+
+// Migrator applies and reverts the migrations of a database
+type Migrator struct {
+	db         *sqlx.DB
+	logger     *zap.Logger
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator of the migrations embedded in the binary
+func NewMigrator(db *sqlx.DB, logger *zap.Logger) (*Migrator, error) {
+	return newMigrator(db, logger, embedded)
+}
+
+func newMigrator(db *sqlx.DB, logger *zap.Logger, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, logger: logger, migrations: migrations}, nil
+}
+
+// load reads the migrations of fsys sorted by version. Versions must be unique and every
+// migration needs both its up and down files.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the pending migrations in version order and returns them. Each migration is applied
+// in its own transaction with its schema_migrations row.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		ran, err := m.apply(ctx, migration)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// apply runs migration unless another instance applied it first, and reports whether it ran
+func (m *Migrator) apply(ctx context.Context, migration Migration) (bool, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		m.logger.Error("Error starting migration transaction", zap.Error(err))
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, lockID); err != nil {
+		m.logger.Error("Error locking migrations", zap.Error(err))
+		return false, err
+	}
+	var applied bool
+	const appliedQuery = `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1);`
+	if err := tx.QueryRowContext(ctx, appliedQuery, migration.Version).Scan(&applied); err != nil {
+		m.logger.Error("Error checking migration", zap.Error(err))
+		return false, err
+	}
+	if applied {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		m.logger.Sugar().Errorw("Error applying migration", "error", err, "version", migration.Version, "name", migration.Name)
+		return false, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	const insertQuery = `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3);`
+	if _, err := tx.ExecContext(ctx, insertQuery, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+		m.logger.Error("Error recording migration", zap.Error(err))
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		m.logger.Error("Error committing migration", zap.Error(err))
+		return false, err
+	}
+	m.logger.Sugar().Infow("Migration applied", "version", migration.Version, "name", migration.Name)
+	return true, nil
+}
+
+// Down reverts the latest applied migration and returns it
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	if err := m.createTable(ctx); err != nil {
+		return Migration{}, err
+	}
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		m.logger.Error("Error starting migration transaction", zap.Error(err))
+		return Migration{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, lockID); err != nil {
+		m.logger.Error("Error locking migrations", zap.Error(err))
+		return Migration{}, err
+	}
+	var version int
+	const latestQuery = `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1;`
+	if err := tx.QueryRowContext(ctx, latestQuery).Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Migration{}, ErrNoMigration
+		}
+		m.logger.Error("Error getting latest migration", zap.Error(err))
+		return Migration{}, err
+	}
+	migration, ok := m.find(version)
+	if !ok {
+		return Migration{}, fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+		m.logger.Sugar().Errorw("Error reverting migration", "error", err, "version", migration.Version, "name", migration.Name)
+		return Migration{}, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1;`, version); err != nil {
+		m.logger.Error("Error recording migration revert", zap.Error(err))
+		return Migration{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		m.logger.Error("Error committing migration revert", zap.Error(err))
+		return Migration{}, err
+	}
+	m.logger.Sugar().Infow("Migration reverted", "version", migration.Version, "name", migration.Name)
+	return migration, nil
+}
+
+// Status returns every migration in version order, the applied migrations unknown to this build
+// included
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	var applied []Status
+	const appliedQuery = `SELECT version, name, applied_at FROM schema_migrations ORDER BY version;`
+	if err := m.db.SelectContext(ctx, &applied, appliedQuery); err != nil {
+		m.logger.Error("Error getting applied migrations", zap.Error(err))
+		return nil, err
+	}
+	byVersion := make(map[int]Status, len(applied))
+	for _, status := range applied {
+		byVersion[status.Version] = status
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status, ok := byVersion[migration.Version]
+		if !ok {
+			status = Status{Version: migration.Version, Name: migration.Name}
+		}
+		delete(byVersion, migration.Version)
+		statuses = append(statuses, status)
+	}
+	for _, status := range byVersion {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// appliedVersions creates schema_migrations if needed and returns the versions it holds
+func (m *Migrator) appliedVersions(ctx context.Context) (map[int]bool, error) {
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	var versions []int
+	if err := m.db.SelectContext(ctx, &versions, `SELECT version FROM schema_migrations;`); err != nil {
+		m.logger.Error("Error getting applied migrations", zap.Error(err))
+		return nil, err
+	}
+	applied := make(map[int]bool, len(versions))
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	const createQuery = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		);
+	`
+	if _, err := m.db.ExecContext(ctx, createQuery); err != nil {
+		m.logger.Error("Error creating schema_migrations", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
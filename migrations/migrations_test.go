@@ -0,0 +1,279 @@
+package migrations
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var testFS = fstest.MapFS{
+	"0001_create_posts.up.sql":   {Data: []byte("CREATE TABLE posts (id UUID);")},
+	"0001_create_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+	"0002_add_title.up.sql":      {Data: []byte("ALTER TABLE posts ADD COLUMN title TEXT;")},
+	"0002_add_title.down.sql":    {Data: []byte("ALTER TABLE posts DROP COLUMN title;")},
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := newMigrator(sqlx.NewDb(db, "sqlmock"), zap.NewNop(), testFS)
+	require.NoError(t, err)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	return migrator, mock
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := load(embedded)
+
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version, "versions have no gaps")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := load(testFS)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "create_posts", Up: "CREATE TABLE posts (id UUID);", Down: "DROP TABLE posts;"}, migrations[0])
+	assert.Equal(t, "add_title", migrations[1].Name)
+
+	invalid := map[string]fstest.MapFS{
+		"bad name":       {"create_posts.sql": {Data: []byte("SELECT 1;")}},
+		"missing down":   {"0001_create_posts.up.sql": {Data: []byte("SELECT 1;")}},
+		"renamed":        {"0001_a.up.sql": {Data: []byte("SELECT 1;")}, "0001_b.down.sql": {Data: []byte("SELECT 1;")}},
+		"empty up":       {"0001_a.up.sql": {Data: []byte("")}, "0001_a.down.sql": {Data: []byte("SELECT 1;")}},
+		"bad extension":  {"0001_a.sideways.sql": {Data: []byte("SELECT 1;")}},
+		"non sql file":   {"README.md": {Data: []byte("# migrations")}},
+		"no version num": {"x_a.up.sql": {Data: []byte("SELECT 1;")}},
+	}
+	for name, fsys := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestUp(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM schema_migrations WHERE version = \$1\)`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE posts ADD COLUMN title TEXT;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name, applied_at\) VALUES \(\$1, \$2, \$3\)`).
+		WithArgs(2, "add_title", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	applied, err := migrator.Up(t.Context())
+
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, 2, applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpSkipsConcurrentlyApplied(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM schema_migrations WHERE version = \$1\)`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	applied, err := migrator.Up(t.Context())
+
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpStopsAtFailedMigration(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS`).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE posts (id UUID);")).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+
+	applied, err := migrator.Up(t.Context())
+
+	assert.ErrorContains(t, err, "migration 1_create_posts")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown(t *testing.T) {
+	t.Run("reverts the latest migration", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE posts DROP COLUMN title;")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		migration, err := migrator.Down(t.Context())
+
+		require.NoError(t, err)
+		assert.Equal(t, 2, migration.Version)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT version FROM schema_migrations`).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+		mock.ExpectRollback()
+
+		_, err := migrator.Down(t.Context())
+
+		assert.ErrorIs(t, err, ErrNoMigration)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown migration", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT version FROM schema_migrations`).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectRollback()
+
+		_, err := migrator.Down(t.Context())
+
+		assert.ErrorIs(t, err, ErrUnknownMigration)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStatus(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	at := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT version, name, applied_at FROM schema_migrations ORDER BY version`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).
+			AddRow(1, "create_posts", at).
+			AddRow(3, "from_a_newer_build", at))
+
+	statuses, err := migrator.Status(t.Context())
+
+	require.NoError(t, err)
+	assert.Equal(t, []Status{
+		{Version: 1, Name: "create_posts", AppliedAt: &at},
+		{Version: 2, Name: "add_title"},
+		{Version: 3, Name: "from_a_newer_build", AppliedAt: &at},
+	}, statuses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpFromBaseline(t *testing.T) {
+	// a database created by the former init script has the baseline tables and no schema_migrations
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	migrator, err := NewMigrator(sqlx.NewDb(db, "sqlmock"), zap.NewNop())
+	require.NoError(t, err)
+
+	mock.ExpectExec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		);
+	`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version FROM schema_migrations;`).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	for _, migration := range migrator.migrations {
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock($1);`).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1);`).
+			WithArgs(migration.Version).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(migration.Up).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3);`).
+			WithArgs(migration.Version, migration.Name, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+
+	applied, err := migrator.Up(t.Context())
+
+	require.NoError(t, err)
+	assert.Equal(t, migrator.migrations, applied, "every migration is applied in version order")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMigratePostgres upgrades a database created by the former init script, which holds data, then
+// reverts and reapplies every migration. It needs MIGRATIONS_TEST_DATABASE_URL, whose public schema
+// is dropped.
+func TestMigratePostgres(t *testing.T) {
+	dsn := os.Getenv("MIGRATIONS_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("MIGRATIONS_TEST_DATABASE_URL is not set")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := t.Context()
+
+	_, err = db.ExecContext(ctx, `DROP SCHEMA public CASCADE; CREATE SCHEMA public;`)
+	require.NoError(t, err)
+	migrator, err := NewMigrator(db, zap.NewNop())
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, migrator.migrations[0].Up)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO users (id, user_name, email, password, created_at, updated_at)
+		VALUES ('11111111-1111-1111-1111-111111111111', 'alice', 'alice@example.com', 'secret', now(), now());
+		INSERT INTO posts (id, user_id, content, created_at, updated_at)
+		VALUES ('aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa', '11111111-1111-1111-1111-111111111111', 'hello', now(), now());
+	`)
+	require.NoError(t, err)
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrator.migrations))
+	var post struct {
+		Kind      string `db:"kind"`
+		LikeCount int    `db:"like_count"`
+		Edited    bool   `db:"edited"`
+		Version   int    `db:"version"`
+		Written   bool   `db:"written"`
+	}
+	require.NoError(t, db.GetContext(ctx, &post, `SELECT kind, like_count, edited, version, content_updated_at = updated_at AS written FROM posts;`))
+	assert.Equal(t, "post", post.Kind)
+	assert.Equal(t, 1, post.Version)
+	assert.True(t, post.Written)
+
+	for range migrator.migrations {
+		_, err := migrator.Down(ctx)
+		require.NoError(t, err)
+	}
+	_, err = migrator.Down(ctx)
+	assert.ErrorIs(t, err, ErrNoMigration)
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrator.migrations))
+}
@@ -1,19 +1,98 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Post kinds, reposts share another post as is and quotes share it with commentary
+const (
+	PostKindPost   = "post"
+	PostKindRepost = "repost"
+	PostKindQuote  = "quote"
+)
+
 type Post struct {
 	ID        string    `json:"id" db:"id"`
 	UserID    string    `json:"user_id" validate:"required,uuid" db:"user_id" `
 	Content   string    `json:"content" validate:"required,max=280" db:"content"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// DeletedAt is set when the post is soft deleted, the row stays as a tombstone
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// InReplyTo is the id of the parent post, nil for posts starting a conversation
+	InReplyTo *string `json:"in_reply_to,omitempty" db:"in_reply_to"`
+	LikeCount int     `json:"like_count" db:"like_count"`
+	// Edited is set once the content was changed, EditCount counts the revisions kept for the post
+	Edited    bool `json:"edited" db:"edited"`
+	EditCount int  `json:"edit_count" db:"edit_count"`
+	// ContentWarning is shown instead of the content until the reader expands it
+	ContentWarning *string `json:"content_warning,omitempty" db:"content_warning"`
+	// Version is incremented by every update, it is the ETag of the post
+	Version int `json:"version" db:"version"`
+	// LikedByViewer is only filled in timelines, for the user reading them
+	LikedByViewer bool   `json:"liked_by_viewer" db:"liked_by_viewer"`
+	Kind          string `json:"kind" db:"kind"`
+	// RepostOf is the shared post of reposts and quotes, Original holds its content when read
+	RepostOf *string `json:"repost_of,omitempty" db:"repost_of"`
+	Original *Post   `json:"original,omitempty" db:"-"`
+	// Hashtags are parsed from Content by the service when saving, they are not read back
+	Hashtags []string `json:"-" db:"-"`
+	// Mentions are the @usernames of Content that matched a user
+	Mentions Mentions `json:"mentions,omitempty" db:"mentions"`
+}
+
+// PostRevision is a previous content of an edited post, revision 1 is the content it was created with
+type PostRevision struct {
+	PostID   string `json:"post_id" db:"post_id"`
+	Revision int    `json:"revision" db:"revision"`
+	Content  string `json:"content" db:"content"`
+	// CreatedAt is when this content was published, it was replaced by the next revision
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
+
+// Mention is an @username of a post resolved to a user. Offset and Length count the characters
+// (Unicode code points) of the post content, from the @ to the end of the username.
+type Mention struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	UserID string `json:"user_id"`
+	// Username is the parsed name the repository resolves into UserID
+	Username string `json:"-"`
+}
+
+// Mentions is read from the JSON array the repository aggregates from post_mentions
+type Mentions []Mention
+
+// Scan implements sql.Scanner
+func (m *Mentions) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Mentions", src)
+	}
+	var mentions []Mention
+	if err := json.Unmarshal(data, &mentions); err != nil {
+		return err
+	}
+	if len(mentions) == 0 {
+		mentions = nil
+	}
+	*m = mentions
+	return nil
+}
+
 type Follow struct {
 	FollowerID string
 	FolloweeID string
@@ -34,9 +113,29 @@ type ErrorResponse struct {
 }
 
 type CreatePostRequest struct {
-	UserID  string `json:"user_id" validate:"required,uuid"`
-	Content string `json:"content"`
-	PostID  string `json:"post_id"`
+	UserID    string `json:"user_id" validate:"omitempty,uuid"`
+	Content   string `json:"content"`
+	PostID    string `json:"post_id"`
+	InReplyTo string `json:"in_reply_to" validate:"omitempty,uuid"`
+	QuoteOf   string `json:"quote_of" validate:"omitempty,uuid"`
+	// Hashtags and Mentions are parsed from Content by the service, they are not part of the request body
+	Hashtags []string  `json:"-"`
+	Mentions []Mention `json:"-"`
+}
+
+// PatchPostRequest is a partial update of a post, the fields left out are not changed
+type PatchPostRequest struct {
+	Content *string `json:"content" validate:"omitempty,min=1,max=280"`
+	// ContentWarning is removed when set to an empty string
+	ContentWarning *string `json:"content_warning" validate:"omitempty,max=100"`
+	// PostID and UserID come from the path and the token, Versions from the If-Match header. The
+	// update applies to any of Versions, or to whatever the current version is when it is empty
+	PostID   string `json:"-"`
+	UserID   string `json:"-"`
+	Versions []int  `json:"-"`
+	// Hashtags and Mentions are parsed from Content by the service
+	Hashtags []string  `json:"-"`
+	Mentions []Mention `json:"-"`
 }
 
 var (
@@ -45,6 +144,11 @@ var (
 	ErrFolloweeNotFound    = errors.New("followee not found")
 	ErrCanNotFollowSelf    = errors.New("can not follow yourself")
 	ErrCanNotUnfollowSelf  = errors.New("can not unfollow yourself")
+	ErrCanNotBlockSelf     = errors.New("can not block yourself")
+	ErrCanNotMuteSelf      = errors.New("can not mute yourself")
+	ErrUserBlocked         = errors.New("user is blocked")
+	ErrPrivateAccount      = errors.New("account is private")
+	ErrNoFollowRequest     = errors.New("follow request not found")
 	ErrContentTooLong      = errors.New("post content exceeds character limit")
 	ErrMissingUserID       = errors.New("user_id is required")
 	ErrInvalidJSON         = errors.New("invalid JSON format")
@@ -57,33 +161,261 @@ var (
 	ErrInvalidInput        = errors.New("invalid input")
 	ErrCouldNotUpdate      = errors.New("could not update post")
 	ErrPostNotFound        = errors.New("post not found")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrMissingToken        = errors.New("missing bearer token")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrTokenExpired        = errors.New("token expired")
+	ErrUnauthorized        = errors.New("authentication required")
+	ErrForbidden           = errors.New("not allowed to act on behalf of another user")
+	ErrMissingPostID       = errors.New("post_id is required")
+	ErrPostDeleted         = errors.New("post has been deleted")
+	ErrEditWindowExpired   = errors.New("post can no longer be edited")
+	ErrVersionMismatch     = errors.New("post was modified since it was read")
+	ErrEmptyPatch          = errors.New("nothing to update")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrSinceWithBefore     = errors.New("since cannot be combined with before or cursor")
+	ErrParentNotFound      = errors.New("parent post not found")
+	ErrSharedPostNotFound  = errors.New("shared post not found")
+	ErrAlreadyReposted     = errors.New("post already reposted")
+	ErrInvalidHashtag      = errors.New("invalid hashtag")
+	ErrInvalidUsername     = errors.New("name can only contain letters, digits and underscores")
+	ErrInvalidIDs          = errors.New("ids must be a list of uuids")
+	ErrStreamUnsupported   = errors.New("streaming not supported")
+	ErrInvalidChannel      = errors.New("invalid channel")
+	ErrInvalidAction       = errors.New("action must be subscribe or unsubscribe")
 )
 
 type FollowRequest struct {
-	FollowerID string `json:"follower_id" validate:"required,uuid" db:"follower_id"`
+	FollowerID string `json:"follower_id" validate:"omitempty,uuid" db:"follower_id"`
 	FolloweeID string `json:"followee_id" validate:"required,uuid" db:"followee_id"`
 }
 
+// Follow states returned by FollowUser: follows of private accounts stay pending until approved
+const (
+	FollowActive  = "active"
+	FollowPending = "pending"
+)
+
 type CreateUserRequest struct {
-	Name     string `json:"name" validate:"required,min=3,max=50"`
+	Name      string `json:"name" validate:"required,min=3,max=50"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required,min=6"`
+	IsPrivate bool   `json:"is_private"`
+}
+
+// PrivacyRequest makes an account private or public, going public approves the pending follow requests
+type PrivacyRequest struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
+}
+
+type UserCredentials struct {
+	ID           string `db:"id"`
+	PasswordHash string `db:"password"`
 }
 
 type User struct {
 	ID         string    `json:"id" db:"id"`
 	Name       string    `json:"name" db:"user_name"`
+	IsPrivate  bool      `json:"is_private" db:"is_private"`
 	LastPostID uuid.UUID `json:"last_post_id" db:"last_post_id"`
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
 
+type UserSummary struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"user_name"`
+}
+
+// FollowListRequest pages through followers or followees ordered by user id.
+// After is the id of the last user of the previous page.
+type FollowListRequest struct {
+	UserID string
+	Limit  int
+	After  string
+}
+
+type FollowListResponse struct {
+	Users      []UserSummary `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// UserProfile is the public representation of a user, it never carries the email or password hash
+type UserProfile struct {
+	ID            string    `json:"id" db:"id"`
+	Name          string    `json:"name" db:"user_name"`
+	IsPrivate     bool      `json:"is_private" db:"is_private"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	LastPost      *Post     `json:"last_post,omitempty" db:"-"`
+	FollowerCount int       `json:"follower_count" db:"follower_count"`
+	FolloweeCount int       `json:"followee_count" db:"followee_count"`
+}
+
+// TimelineRequest pages through posts ordered by (created_at, id) descending.
+// Posts strictly before the (Before, BeforeID) tuple are returned, an empty BeforeID
+// only keeps posts created before Before.
+// When After is set the request polls for newer posts instead: posts strictly after the
+// (After, AfterID) tuple are returned oldest first and Before is ignored.
+//
+// ViewerID is the authenticated reader of a page of another user's posts, reposts and quotes of
+// private accounts the viewer does not follow are left out.
 type TimelineRequest struct {
-	UserID string    `json:"user_id"`
-	Limit  int       `json:"limit"`
-	Before time.Time `json:"before"`
+	UserID   string    `json:"user_id"`
+	ViewerID string    `json:"-"`
+	Limit    int       `json:"limit"`
+	Before   time.Time `json:"before"`
+	BeforeID string    `json:"before_id"`
+	After    time.Time `json:"after"`
+	AfterID  string    `json:"after_id"`
+}
+
+// Since reports whether the request polls for posts newer than (After, AfterID)
+func (t TimelineRequest) Since() bool {
+	return !t.After.IsZero()
 }
 
 type TimelineResponse struct {
 	Posts []Post `json:"posts"`
 }
+
+// ThreadRequest pages through the replies below PostID, oldest first.
+// Replies strictly after the (After, AfterID) tuple are returned.
+// ViewerID is the authenticated reader, the posts of private accounts are only shown to their followers.
+type ThreadRequest struct {
+	PostID   string    `json:"post_id"`
+	ViewerID string    `json:"-"`
+	Limit    int       `json:"limit"`
+	After    time.Time `json:"after"`
+	AfterID  string    `json:"after_id"`
+}
+
+// ThreadNode is a post of a conversation with the replies it received
+type ThreadNode struct {
+	Post
+	Replies []ThreadNode `json:"replies"`
+}
+
+// Thread is the conversation around a post. Ancestors go down to the parent of Post from Root, the
+// post that started the conversation, which is nil when the viewer may not read it.
+// Replies holds one page of the descendants of Post; replies whose parent was on a previous page
+// are returned at the top level, their in_reply_to tells where they belong.
+type Thread struct {
+	Root      *Post        `json:"root"`
+	Ancestors []Post       `json:"ancestors"`
+	Post      Post         `json:"post"`
+	Replies   []ThreadNode `json:"replies"`
+	// LastReply is the newest reply of a full page, the next page starts after it
+	LastReply *Post `json:"-"`
+}
+
+// Notification types, one per event a user is told about
+const (
+	NotificationFollow  = "follow"
+	NotificationLike    = "like"
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+)
+
+// NotificationGroup gathers the notifications of a user sharing a type, a post and a read state,
+// like "alice and 4 others liked your post". Follows have no post, replies point to the replied post.
+type NotificationGroup struct {
+	// ID is the newest notification of the group, marking it read marks the whole group
+	ID     string  `json:"id" db:"id"`
+	Type   string  `json:"type" db:"type"`
+	PostID *string `json:"post_id,omitempty" db:"post_id"`
+	// Actors are the newest users behind the group, at most 3 of ActorCount
+	Actors     []UserSummary `json:"actors" db:"-"`
+	ActorCount int           `json:"actor_count" db:"actor_count"`
+	Message    string        `json:"message" db:"-"`
+	Read       bool          `json:"read" db:"read"`
+	// CreatedAt is the time of the newest notification of the group
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type NotificationsResponse struct {
+	Notifications []NotificationGroup `json:"notifications"`
+	UnreadCount   int                 `json:"unread_count"`
+}
+
+// ReadNotificationsRequest lists the groups to mark read, every notification is marked read when empty
+type ReadNotificationsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type ReadNotificationsResponse struct {
+	Marked      int `json:"marked"`
+	UnreadCount int `json:"unread_count"`
+}
+
+// Live event channels: the timeline and the notifications of a user, and the replies of a thread
+const (
+	ChannelTimeline      = "timeline"
+	ChannelNotifications = "notifications"
+	ChannelThread        = "thread"
+)
+
+// Live event types, the websocket gateway also answers its clients with events
+const (
+	EventPost         = "post"
+	EventNotification = "notification"
+	EventReply        = "reply"
+	EventSubscribed   = "subscribed"
+	EventUnsubscribed = "unsubscribed"
+	EventError        = "error"
+)
+
+// Websocket gateway actions
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+)
+
+// SubscriptionRequest is sent by websocket clients to join or leave a channel, PostID selects the
+// thread of the thread channel
+type SubscriptionRequest struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+	PostID  string `json:"post_id,omitempty"`
+}
+
+// Topic is what a live subscription listens to: a channel of a user, or of a post for threads
+type Topic struct {
+	Channel string
+	ID      string
+}
+
+// TimelineTopic is the topic of the new posts of the followees of userID
+func TimelineTopic(userID string) Topic {
+	return Topic{Channel: ChannelTimeline, ID: userID}
+}
+
+// NotificationsTopic is the topic of the new notifications of userID
+func NotificationsTopic(userID string) Topic {
+	return Topic{Channel: ChannelNotifications, ID: userID}
+}
+
+// ThreadTopic is the topic of the new replies below postID, at any depth
+func ThreadTopic(postID string) Topic {
+	return Topic{Channel: ChannelThread, ID: postID}
+}
+
+// Event is pushed to the subscribers of a topic. Data is a Post for "post" and "reply" events and a
+// NotificationEvent for "notification" events.
+type Event struct {
+	Channel string      `json:"channel"`
+	PostID  string      `json:"post_id,omitempty"`
+	Type    string      `json:"type"`
+	Data    interface{} `json:"data"`
+}
+
+// NotificationEvent announces a new notification, clients fetch the notifications to render it
+type NotificationEvent struct {
+	Type    string  `json:"type"`
+	ActorID string  `json:"actor_id"`
+	PostID  *string `json:"post_id,omitempty"`
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"microblogging/model"
+
+	"go.uber.org/zap"
+)
+
+// Blocks cut every follow between two users and keep them from following each other again, and
+// mentions by a blocked user do not notify. Mutes only hide the muted user from the muter's timeline.
+
+// BlockUser blocks blockedID on behalf of blockerID and removes the follows and follow requests
+// between them. Blocking twice is a no-op.
+func (r *DBConnector) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	exists, err := r.checkUsers(ctx, blockerID, blockedID)
+	if !exists {
+		return err
+	}
+
+	const blockQuery = `
+		INSERT INTO blocks (blocker_id, blocked_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING;
+	`
+	const unfollowQuery = `
+		UPDATE follows
+		SET is_active = FALSE, is_pending = FALSE
+		WHERE (follower_id = $1 AND followee_id = $2)
+		OR (follower_id = $2 AND followee_id = $1);
+	`
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		if _, err := tx.db().ExecContext(ctx, blockQuery, blockerID, blockedID, time.Now().UTC()); err != nil {
+			r.Logger.Sugar().Errorw("Error blocking user", "error", err, "user_id", blockerID, "blocked_id", blockedID)
+			return err
+		}
+		if _, err := tx.db().ExecContext(ctx, unfollowQuery, blockerID, blockedID); err != nil {
+			r.Logger.Sugar().Errorw("Error removing follows of blocked user", "error", err, "user_id", blockerID, "blocked_id", blockedID)
+			return err
+		}
+		if err := tx.retractFollowNotification(ctx, blockerID, blockedID); err != nil {
+			return err
+		}
+		return tx.retractFollowNotification(ctx, blockedID, blockerID)
+	})
+	if err != nil {
+		return err
+	}
+	r.Logger.Sugar().Infow("User blocked", "user_id", blockerID, "blocked_id", blockedID)
+	return nil
+}
+
+// UnblockUser removes the block of blockedID by blockerID, if any. Follows are not restored.
+func (r *DBConnector) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	exists, err := r.checkUsers(ctx, blockerID, blockedID)
+	if !exists {
+		return err
+	}
+
+	const query = `DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;`
+	if _, err := r.db().ExecContext(ctx, query, blockerID, blockedID); err != nil {
+		r.Logger.Sugar().Errorw("Error unblocking user", "error", err, "user_id", blockerID, "blocked_id", blockedID)
+		return err
+	}
+	return nil
+}
+
+// GetBlockedUsers returns the users blocked by req.UserID using keyset pagination on user id
+func (r *DBConnector) GetBlockedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	var blocked []model.UserSummary
+	query := `SELECT u.id, u.user_name
+			  FROM blocks b
+			  JOIN users u ON u.id = b.blocked_id
+			  WHERE b.blocker_id = $1
+			  AND u.id > $2
+			  ORDER BY u.id
+			  LIMIT $3`
+	if err := r.db().SelectContext(ctx, &blocked, query, req.UserID, keysetAfter(req.After), req.Limit+1); err != nil {
+		r.Logger.Error("Error getting blocked users", zap.Error(err))
+		return model.FollowListResponse{}, err
+	}
+	return newFollowListResponse(blocked, req.Limit), nil
+}
+
+// Blocked reports whether userID or otherID blocked the other
+func (r *DBConnector) Blocked(ctx context.Context, userID, otherID string) (bool, error) {
+	var blocked bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2)
+			OR (blocker_id = $2 AND blocked_id = $1)
+		);
+	`
+	if err := r.db().QueryRowxContext(ctx, query, userID, otherID).Scan(&blocked); err != nil {
+		r.Logger.Sugar().Errorw("Error checking blocks", "error", err, "user_id", userID, "other_id", otherID)
+		return false, err
+	}
+	return blocked, nil
+}
+
+// MuteUser hides the posts of mutedID from the timeline of muterID. Muting twice is a no-op.
+func (r *DBConnector) MuteUser(ctx context.Context, muterID, mutedID string) error {
+	exists, err := r.checkUsers(ctx, muterID, mutedID)
+	if !exists {
+		return err
+	}
+
+	const query = `
+		INSERT INTO mutes (muter_id, muted_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := r.db().ExecContext(ctx, query, muterID, mutedID, time.Now().UTC()); err != nil {
+		r.Logger.Sugar().Errorw("Error muting user", "error", err, "user_id", muterID, "muted_id", mutedID)
+		return err
+	}
+	return nil
+}
+
+// UnmuteUser removes the mute of mutedID by muterID, if any
+func (r *DBConnector) UnmuteUser(ctx context.Context, muterID, mutedID string) error {
+	exists, err := r.checkUsers(ctx, muterID, mutedID)
+	if !exists {
+		return err
+	}
+
+	const query = `DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2;`
+	if _, err := r.db().ExecContext(ctx, query, muterID, mutedID); err != nil {
+		r.Logger.Sugar().Errorw("Error unmuting user", "error", err, "user_id", muterID, "muted_id", mutedID)
+		return err
+	}
+	return nil
+}
+
+// Muted reports whether muterID muted mutedID
+func (r *DBConnector) Muted(ctx context.Context, muterID, mutedID string) (bool, error) {
+	var muted bool
+	query := `SELECT EXISTS (SELECT 1 FROM mutes WHERE muter_id = $1 AND muted_id = $2);`
+	if err := r.db().QueryRowxContext(ctx, query, muterID, mutedID).Scan(&muted); err != nil {
+		r.Logger.Sugar().Errorw("Error checking mutes", "error", err, "user_id", muterID, "muted_id", mutedID)
+		return false, err
+	}
+	return muted, nil
+}
+
+// GetMutedUsers returns the users muted by req.UserID using keyset pagination on user id
+func (r *DBConnector) GetMutedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	var muted []model.UserSummary
+	query := `SELECT u.id, u.user_name
+			  FROM mutes mu
+			  JOIN users u ON u.id = mu.muted_id
+			  WHERE mu.muter_id = $1
+			  AND u.id > $2
+			  ORDER BY u.id
+			  LIMIT $3`
+	if err := r.db().SelectContext(ctx, &muted, query, req.UserID, keysetAfter(req.After), req.Limit+1); err != nil {
+		r.Logger.Error("Error getting muted users", zap.Error(err))
+		return model.FollowListResponse{}, err
+	}
+	return newFollowListResponse(muted, req.Limit), nil
+}
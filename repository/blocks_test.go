@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"testing"
+
+	"microblogging/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// expectUsersExist expects the existence checks of checkUsers
+func expectUsersExist(mock sqlmock.Sqlmock, userIDs ...string) {
+	for range userIDs {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$1\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	}
+}
+
+func TestBlockUser(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.MatchExpectationsInOrder(false)
+	expectUsersExist(mock, "user1", "user2")
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO blocks \(blocker_id, blocked_id, created_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT DO NOTHING`).
+		WithArgs("user1", "user2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE follows SET is_active = FALSE, is_pending = FALSE WHERE \(follower_id = \$1 AND followee_id = \$2\) OR \(follower_id = \$2 AND followee_id = \$1\)`).
+		WithArgs("user1", "user2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM notifications WHERE type = 'follow'`).
+		WithArgs("user2", "user1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM notifications WHERE type = 'follow'`).
+		WithArgs("user1", "user2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.BlockUser(t.Context(), "user1", "user2"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMuteUser(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.MatchExpectationsInOrder(false)
+	expectUsersExist(mock, "user1", "user2")
+	mock.ExpectExec(`INSERT INTO mutes \(muter_id, muted_id, created_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT DO NOTHING`).
+		WithArgs("user1", "user2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM mutes WHERE muter_id = \$1 AND muted_id = \$2\)`).
+		WithArgs("user1", "user2").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	assert.NoError(t, repo.MuteUser(t.Context(), "user1", "user2"))
+	muted, err := repo.Muted(t.Context(), "user1", "user2")
+	assert.NoError(t, err)
+	assert.True(t, muted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBlockedUsers(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT u.id, u.user_name FROM blocks b JOIN users u ON u.id = b.blocked_id WHERE b.blocker_id = \$1`).
+		WithArgs("user1", "user2", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow("user3", "carol").AddRow("user4", "dave"))
+
+	blocked, err := repo.GetBlockedUsers(t.Context(), model.FollowListRequest{UserID: "user1", Limit: 1, After: "user2"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: "user3", Name: "carol"}}, blocked.Users)
+	assert.Equal(t, "user3", blocked.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTimelineHidesBlockedMutedAndBlockingUsers(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT blocked_id FROM blocks WHERE blocker_id = \$1 UNION ALL SELECT blocker_id FROM blocks WHERE blocked_id = \$1 UNION ALL SELECT muted_id FROM mutes WHERE muter_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: "user1", Limit: 10})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTimelineDedupIgnoresHiddenReposts(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`AND \(n\.created_at, n\.id\) > \(p\.created_at, p\.id\) AND NOT EXISTS \( SELECT 1 FROM posts o WHERE o\.id = COALESCE\(n\.repost_of, n\.id\) AND o\.user_id IN \(`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: "user1", Limit: 10})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const defaultFanoutQueueSize = 1024
+
+// FanoutConfig configures fan-out-on-write of the home timeline
+type FanoutConfig struct {
+	// CelebrityThreshold is the follower count above which posts are not fanned out.
+	// Timelines read those posts from the posts table instead (fan-in on read).
+	CelebrityThreshold int
+	// QueueSize bounds the number of pending jobs, defaults to 1024
+	QueueSize int
+}
+
+type fanoutJob struct {
+	// a new post to push to the author's followers
+	postID    uuid.UUID
+	authorID  string
+	createdAt time.Time
+	// or a new follow, whose follower gets the followee's fanned out posts
+	followerID string
+	followeeID string
+}
+
+// FanoutWorker materializes the home_timeline table in the background.
+// A post is only marked as fanned out once every follower row is written, until then (or when
+// the queue is full or the author is a celebrity) it keeps being served by fan-in on read.
+type FanoutWorker struct {
+	db        *sqlx.DB
+	logger    *zap.Logger
+	threshold int
+	jobs      chan fanoutJob
+}
+
+// NewFanoutWorker returns a worker that does nothing until Run is called
+func NewFanoutWorker(db *sqlx.DB, logger *zap.Logger, cfg FanoutConfig) *FanoutWorker {
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultFanoutQueueSize
+	}
+	return &FanoutWorker{
+		db:        db,
+		logger:    logger,
+		threshold: cfg.CelebrityThreshold,
+		jobs:      make(chan fanoutJob, size),
+	}
+}
+
+// Run processes jobs until ctx is done
+func (w *FanoutWorker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-w.jobs:
+			if job.followerID != "" {
+				w.backfill(ctx, job.followerID, job.followeeID)
+			} else {
+				w.fanout(ctx, job.postID, job.authorID, job.createdAt)
+			}
+		}
+	}
+}
+
+// enqueuePost schedules the fan-out of a new post, it never blocks the caller
+func (w *FanoutWorker) enqueuePost(postID uuid.UUID, authorID string, createdAt time.Time) {
+	w.enqueue(fanoutJob{postID: postID, authorID: authorID, createdAt: createdAt})
+}
+
+// enqueueFollow schedules the backfill of a new follower's home timeline
+func (w *FanoutWorker) enqueueFollow(followerID, followeeID string) {
+	w.enqueue(fanoutJob{followerID: followerID, followeeID: followeeID})
+}
+
+func (w *FanoutWorker) enqueue(job fanoutJob) {
+	select {
+	case w.jobs <- job:
+	default:
+		w.logger.Sugar().Warnw("Fan-out queue is full, dropping job", "post_id", job.postID.String(), "follower_id", job.followerID)
+	}
+}
+
+func (w *FanoutWorker) fanout(ctx context.Context, postID uuid.UUID, authorID string, createdAt time.Time) {
+	var followers int
+	const countQuery = `SELECT COUNT(*) FROM follows WHERE followee_id = $1 AND is_active = TRUE;`
+	if err := w.db.QueryRowContext(ctx, countQuery, authorID).Scan(&followers); err != nil {
+		w.logger.Error("Error counting followers for fan-out", zap.Error(err))
+		return
+	}
+	if followers > w.threshold {
+		w.logger.Sugar().Infow("Skipping fan-out for celebrity account", "user_id", authorID, "followers", followers)
+		return
+	}
+
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		w.logger.Error("Error starting fan-out transaction", zap.Error(err))
+		return
+	}
+	defer tx.Rollback()
+
+	const insertQuery = `
+		INSERT INTO home_timeline (user_id, post_id, created_at)
+		SELECT follower_id, $1, $2
+		FROM follows
+		WHERE followee_id = $3 AND is_active = TRUE
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := tx.ExecContext(ctx, insertQuery, postID, createdAt, authorID); err != nil {
+		w.logger.Error("Error fanning out post", zap.Error(err))
+		return
+	}
+
+	const markQuery = `UPDATE posts SET fanned_out = TRUE WHERE id = $1;`
+	if _, err := tx.ExecContext(ctx, markQuery, postID); err != nil {
+		w.logger.Error("Error marking post as fanned out", zap.Error(err))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		w.logger.Error("Error committing fan-out", zap.Error(err))
+		return
+	}
+	w.logger.Sugar().Infow("Post fanned out", "post_id", postID.String(), "followers", followers)
+}
+
+func (w *FanoutWorker) backfill(ctx context.Context, followerID, followeeID string) {
+	const backfillQuery = `
+		INSERT INTO home_timeline (user_id, post_id, created_at)
+		SELECT $1, id, created_at
+		FROM posts
+		WHERE user_id = $2 AND fanned_out = TRUE AND deleted_at IS NULL
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := w.db.ExecContext(ctx, backfillQuery, followerID, followeeID); err != nil {
+		w.logger.Error("Error backfilling home timeline", zap.Error(err))
+		return
+	}
+	w.logger.Sugar().Infow("Home timeline backfilled", "user_id", followerID, "followee_id", followeeID)
+}
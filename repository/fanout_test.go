@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFanoutWorker(t *testing.T) {
+	postID := uuid.New()
+	authorID := uuid.New().String()
+	createdAt := time.Now().UTC()
+
+	t.Run("fans_out_to_followers", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		w := NewFanoutWorker(sqlx.NewDb(db, "sqlmock"), zap.NewNop(), FanoutConfig{CelebrityThreshold: 10})
+
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM follows WHERE followee_id = \$1`).
+			WithArgs(authorID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO home_timeline`).
+			WithArgs(postID, createdAt, authorID).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE posts SET fanned_out = TRUE WHERE id = \$1`).
+			WithArgs(postID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w.fanout(t.Context(), postID, authorID, createdAt)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("skips_celebrities", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		w := NewFanoutWorker(sqlx.NewDb(db, "sqlmock"), zap.NewNop(), FanoutConfig{CelebrityThreshold: 10})
+
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM follows`).
+			WithArgs(authorID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+
+		w.fanout(t.Context(), postID, authorID, createdAt)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("backfills_new_follow", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		w := NewFanoutWorker(sqlx.NewDb(db, "sqlmock"), zap.NewNop(), FanoutConfig{})
+		followerID := uuid.New().String()
+
+		mock.ExpectExec(`INSERT INTO home_timeline \(user_id, post_id, created_at\) SELECT \$1, id, created_at FROM posts`).
+			WithArgs(followerID, authorID).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+		w.enqueueFollow(followerID, authorID)
+		assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+	})
+
+	t.Run("full_queue_drops_jobs", func(t *testing.T) {
+		w := NewFanoutWorker(nil, zap.NewNop(), FanoutConfig{QueueSize: 1})
+		w.enqueuePost(postID, authorID, createdAt)
+		w.enqueuePost(uuid.New(), authorID, createdAt)
+		assert.Len(t, w.jobs, 1)
+	})
+}
+
+func TestGetHomeTimeline(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "sqlmock")
+	repo := &DBConnector{DB: sqlxDB, Logger: zap.NewNop(), Fanout: NewFanoutWorker(sqlxDB, zap.NewNop(), FanoutConfig{})}
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM home_timeline h .* AND \(h.created_at, h.post_id\) < \(\$2, \$3\) .* UNION ALL .* AND p.fanned_out = FALSE`).
+		WithArgs("user-id-123", now, uuid.Nil.String(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "user-id-123", "Hello!", now, now))
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: "user-id-123", Before: now, Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, timeline.Posts, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
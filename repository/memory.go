@@ -0,0 +1,1277 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"microblogging/model"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// memoryRepo is a concurrency-safe in-memory PostRepository with the same semantics as DBConnector.
+// It is meant for running the service and integration tests without Postgres. Contexts are ignored
+// since none of its operations wait on I/O.
+type memoryRepo struct {
+	*memoryStore
+	// held is set on the repository a WithTx call hands to its function, which runs with the lock
+	// already held
+	held bool
+}
+
+type memoryStore struct {
+	mu     sync.RWMutex
+	logger *zap.Logger
+	now    func() time.Time
+	memoryState
+}
+
+// memoryState is the data of the repository, WithTx restores a copy of it when its function fails
+type memoryState struct {
+	users   map[string]*memoryUser
+	posts   map[string]*model.Post
+	follows map[followKey]bool // value is follows.is_active
+	// requests are the pending follows of private accounts, follows.is_pending
+	requests map[followKey]bool
+	likes    map[likeKey]bool
+	blocks   map[relationKey]bool
+	mutes    map[relationKey]bool
+	// revisions are the previous contents of each post, oldest first
+	revisions map[string][]model.PostRevision
+	// contentUpdatedAt is when the content of each post was last written, posts.content_updated_at
+	contentUpdatedAt map[string]time.Time
+	// notifications are kept oldest first
+	notifications []*memoryNotification
+}
+
+type memoryUser struct {
+	model.User
+	Email    string
+	Password string
+}
+
+type followKey struct {
+	followerID string
+	followeeID string
+}
+
+type likeKey struct {
+	userID string
+	postID string
+}
+
+// relationKey is a block or a mute of otherID by userID
+type relationKey struct {
+	userID  string
+	otherID string
+}
+
+type memoryNotification struct {
+	id        string
+	userID    string
+	actorID   string
+	kind      string
+	postID    string // empty for follows
+	createdAt time.Time
+	read      bool
+}
+
+func NewMemoryRepository(logger *zap.Logger) PostRepository {
+	return &memoryRepo{memoryStore: &memoryStore{
+		logger: logger,
+		now:    func() time.Time { return time.Now().UTC() },
+		memoryState: memoryState{
+			users:            make(map[string]*memoryUser),
+			posts:            make(map[string]*model.Post),
+			follows:          make(map[followKey]bool),
+			requests:         make(map[followKey]bool),
+			likes:            make(map[likeKey]bool),
+			blocks:           make(map[relationKey]bool),
+			mutes:            make(map[relationKey]bool),
+			revisions:        make(map[string][]model.PostRevision),
+			contentUpdatedAt: make(map[string]time.Time),
+		},
+	}}
+}
+
+// WithTx implements PostRepository. fn runs with the lock held and every change it made is undone
+// when it returns an error.
+func (p *memoryRepo) WithTx(ctx context.Context, fn func(repo PostRepository) error) error {
+	if p.held {
+		return fn(p)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	saved := p.memoryState.clone()
+	if err := fn(&memoryRepo{memoryStore: p.memoryStore, held: true}); err != nil {
+		p.memoryState = saved
+		return err
+	}
+	return nil
+}
+
+// lock takes the write lock and returns its release
+func (p *memoryRepo) lock() func() {
+	if p.held {
+		return func() {}
+	}
+	p.mu.Lock()
+	return p.mu.Unlock
+}
+
+// rlock takes the read lock and returns its release
+func (p *memoryRepo) rlock() func() {
+	if p.held {
+		return func() {}
+	}
+	p.mu.RLock()
+	return p.mu.RUnlock
+}
+
+// clone copies s deep enough that no later update of the repository changes the copy
+func (s memoryState) clone() memoryState {
+	c := memoryState{
+		users:            make(map[string]*memoryUser, len(s.users)),
+		posts:            make(map[string]*model.Post, len(s.posts)),
+		follows:          maps.Clone(s.follows),
+		requests:         maps.Clone(s.requests),
+		likes:            maps.Clone(s.likes),
+		blocks:           maps.Clone(s.blocks),
+		mutes:            maps.Clone(s.mutes),
+		revisions:        make(map[string][]model.PostRevision, len(s.revisions)),
+		contentUpdatedAt: maps.Clone(s.contentUpdatedAt),
+		notifications:    make([]*memoryNotification, len(s.notifications)),
+	}
+	for id, user := range s.users {
+		copied := *user
+		c.users[id] = &copied
+	}
+	for id, post := range s.posts {
+		copied := *post
+		c.posts[id] = &copied
+	}
+	for id, revisions := range s.revisions {
+		c.revisions[id] = slices.Clone(revisions)
+	}
+	for i, notification := range s.notifications {
+		copied := *notification
+		c.notifications[i] = &copied
+	}
+	return c
+}
+
+// Save implements PostRepository.
+func (p *memoryRepo) Save(ctx context.Context, post *model.Post) (uuid.UUID, error) {
+	defer p.lock()()
+
+	if post.InReplyTo != nil {
+		if parent, ok := p.posts[*post.InReplyTo]; !ok || parent.DeletedAt != nil || p.unreadable(parent, post.UserID) {
+			p.logger.Sugar().Errorw("in_reply_to post does not exist", "post_id", *post.InReplyTo)
+			return uuid.Nil, model.ErrParentNotFound
+		}
+	}
+	kind := post.Kind
+	if kind == "" {
+		kind = model.PostKindPost
+	}
+	if post.RepostOf != nil {
+		if shared, ok := p.posts[*post.RepostOf]; !ok || shared.DeletedAt != nil {
+			p.logger.Sugar().Errorw("shared post does not exist", "post_id", *post.RepostOf)
+			return uuid.Nil, model.ErrSharedPostNotFound
+		}
+	}
+	if kind == model.PostKindRepost {
+		for _, stored := range p.posts {
+			if stored.Kind == model.PostKindRepost && stored.UserID == post.UserID && stored.DeletedAt == nil && *stored.RepostOf == *post.RepostOf {
+				return uuid.Nil, model.ErrAlreadyReposted
+			}
+		}
+	}
+
+	postID := uuid.New()
+	now := p.now()
+	p.posts[postID.String()] = &model.Post{
+		ID:        postID.String(),
+		UserID:    post.UserID,
+		Content:   post.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+		InReplyTo: post.InReplyTo,
+		Kind:      kind,
+		RepostOf:  post.RepostOf,
+		Hashtags:  slices.Clone(post.Hashtags),
+		Mentions:  p.resolveMentions(post.Mentions),
+		Version:   1,
+	}
+	p.contentUpdatedAt[postID.String()] = now
+	p.updateUserLastPost(postID, post.UserID, now)
+	if post.InReplyTo != nil {
+		p.notify(model.NotificationReply, p.posts[*post.InReplyTo].UserID, post.UserID, *post.InReplyTo)
+	}
+	p.notifyMentioned(p.posts[postID.String()])
+
+	p.logger.Sugar().Infow("Post saved", "post_id", postID.String())
+	return postID, nil
+}
+
+// UpdatePostPut implements PostRepository.
+func (p *memoryRepo) UpdatePostPut(ctx context.Context, post model.CreatePostRequest) error {
+	postUUID, err := uuid.Parse(post.PostID)
+	if err != nil {
+		p.logger.Error("Invalid post_id UUID", zap.Error(err))
+		return model.ErrInvalidUUID
+	}
+
+	defer p.lock()()
+
+	stored, err := p.existPost(postUUID, post.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := p.now()
+	p.editContent(stored, post.Content, post.Hashtags, post.Mentions, now)
+	stored.UpdatedAt = now
+	stored.Version++
+
+	p.logger.Sugar().Infow("Post updated", "post_id", post.PostID)
+	return nil
+}
+
+// PatchPost implements PostRepository.
+func (p *memoryRepo) PatchPost(ctx context.Context, post model.PatchPostRequest) (int, error) {
+	postUUID, err := uuid.Parse(post.PostID)
+	if err != nil {
+		p.logger.Error("Invalid post_id UUID", zap.Error(err))
+		return 0, model.ErrInvalidUUID
+	}
+
+	defer p.lock()()
+
+	stored, err := p.existPost(postUUID, post.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if len(post.Versions) > 0 && !slices.Contains(post.Versions, stored.Version) {
+		return 0, model.ErrVersionMismatch
+	}
+
+	now := p.now()
+	if post.Content != nil {
+		p.editContent(stored, *post.Content, post.Hashtags, post.Mentions, now)
+	}
+	if post.ContentWarning != nil {
+		stored.ContentWarning = nil
+		if *post.ContentWarning != "" {
+			warning := *post.ContentWarning
+			stored.ContentWarning = &warning
+		}
+	}
+	stored.UpdatedAt = now
+	stored.Version++
+
+	p.logger.Sugar().Infow("Post patched", "post_id", post.PostID, "version", stored.Version)
+	return stored.Version, nil
+}
+
+// editContent keeps the content of stored as its next revision and replaces it with content written
+// at now. It must be called with the lock held.
+func (p *memoryRepo) editContent(stored *model.Post, content string, hashtags []string, mentions []model.Mention, now time.Time) {
+	p.revisions[stored.ID] = append(p.revisions[stored.ID], model.PostRevision{
+		PostID:    stored.ID,
+		Revision:  stored.EditCount + 1,
+		Content:   stored.Content,
+		CreatedAt: p.contentUpdatedAt[stored.ID],
+	})
+	p.contentUpdatedAt[stored.ID] = now
+	stored.EditCount++
+	stored.Edited = true
+	stored.Content = content
+	stored.Hashtags = slices.Clone(hashtags)
+	stored.Mentions = p.resolveMentions(mentions)
+	p.notifyMentioned(stored)
+}
+
+// DeletePost implements PostRepository.
+func (p *memoryRepo) DeletePost(ctx context.Context, postID, userID string) error {
+	postUUID, err := uuid.Parse(postID)
+	if err != nil {
+		p.logger.Error("Invalid post_id UUID", zap.Error(err))
+		return model.ErrInvalidUUID
+	}
+
+	defer p.lock()()
+
+	stored, err := p.existPost(postUUID, userID)
+	if err != nil {
+		return err
+	}
+
+	now := p.now()
+	stored.DeletedAt = &now
+	stored.UpdatedAt = now
+
+	if user, ok := p.users[userID]; ok && user.LastPostID == postUUID {
+		user.LastPostID = p.latestPostID(userID)
+		user.UpdatedAt = now
+	}
+
+	p.logger.Sugar().Infow("Post deleted", "post_id", postID, "user_id", userID)
+	return nil
+}
+
+// LikePost implements PostRepository.
+func (p *memoryRepo) LikePost(ctx context.Context, userID, postID string) (bool, error) {
+	return p.updateLike(userID, postID, true)
+}
+
+// UnlikePost implements PostRepository.
+func (p *memoryRepo) UnlikePost(ctx context.Context, userID, postID string) (bool, error) {
+	return p.updateLike(userID, postID, false)
+}
+
+func (p *memoryRepo) updateLike(userID, postID string, liked bool) (bool, error) {
+	defer p.lock()()
+
+	post, ok := p.posts[postID]
+	if !ok || post.DeletedAt != nil || (liked && p.unreadable(post, userID)) {
+		return false, model.ErrPostNotFound
+	}
+	key := likeKey{userID: userID, postID: postID}
+	if p.likes[key] == liked {
+		return false, nil
+	}
+	if liked {
+		p.likes[key] = true
+		post.LikeCount++
+		p.notify(model.NotificationLike, post.UserID, userID, postID)
+	} else {
+		delete(p.likes, key)
+		post.LikeCount--
+		p.retractNotification(model.NotificationLike, post.UserID, userID, postID)
+	}
+	p.logger.Sugar().Infow("Like updated", "user_id", userID, "post_id", postID, "liked", liked)
+	return true, nil
+}
+
+// GetTimeline implements PostRepository.
+func (p *memoryRepo) GetTimeline(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	defer p.rlock()()
+
+	var posts model.TimelineResponse
+	for _, post := range p.posts {
+		if post.DeletedAt != nil || !p.follows[followKey{followerID: info.UserID, followeeID: post.UserID}] {
+			continue
+		}
+		if info.Since() {
+			if !postAfter(*post, info.After, info.AfterID) {
+				continue
+			}
+		} else if !postBefore(*post, info.Before, info.BeforeID) {
+			continue
+		}
+		if p.supersededInTimeline(post, info.UserID) || p.hiddenInTimeline(post, info.UserID) || p.privateShared(post, info.UserID) {
+			continue
+		}
+		timelinePost := p.withOriginal(*post)
+		timelinePost.LikedByViewer = p.likes[likeKey{userID: info.UserID, postID: post.ID}]
+		posts.Posts = append(posts.Posts, timelinePost)
+	}
+
+	sortNewestFirst(posts.Posts)
+	if info.Since() {
+		slices.Reverse(posts.Posts)
+	}
+	if len(posts.Posts) > info.Limit {
+		posts.Posts = posts.Posts[:info.Limit]
+	}
+	return posts, nil
+}
+
+// GetPost implements PostRepository.
+func (p *memoryRepo) GetPost(ctx context.Context, postID string) (model.Post, error) {
+	defer p.rlock()()
+
+	post, ok := p.posts[postID]
+	if !ok {
+		return model.Post{}, model.ErrPostNotFound
+	}
+	return p.withOriginal(*post), nil
+}
+
+// GetPostRevisions implements PostRepository.
+func (p *memoryRepo) GetPostRevisions(ctx context.Context, postID string) ([]model.PostRevision, error) {
+	defer p.rlock()()
+
+	return append([]model.PostRevision{}, p.revisions[postID]...), nil
+}
+
+// GetAncestors implements PostRepository.
+func (p *memoryRepo) GetAncestors(ctx context.Context, viewerID, postID string) ([]model.Post, error) {
+	defer p.rlock()()
+
+	var ancestors []model.Post
+	post, ok := p.posts[postID]
+	for ok && post.InReplyTo != nil {
+		post, ok = p.posts[*post.InReplyTo]
+		if ok && !p.hiddenInFeed(post, viewerID) {
+			ancestors = append(ancestors, p.withOriginal(*post))
+		}
+	}
+	slices.Reverse(ancestors)
+	return ancestors, nil
+}
+
+// GetReplies implements PostRepository.
+func (p *memoryRepo) GetReplies(ctx context.Context, req model.ThreadRequest) ([]model.Post, error) {
+	defer p.rlock()()
+
+	var replies []model.Post
+	for _, post := range p.posts {
+		if p.descendsFrom(post, req.PostID) && postAfter(*post, req.After, req.AfterID) && !p.hiddenInFeed(post, req.ViewerID) {
+			replies = append(replies, p.withOriginal(*post))
+		}
+	}
+	sortNewestFirst(replies)
+	slices.Reverse(replies)
+	if len(replies) > req.Limit {
+		replies = replies[:req.Limit]
+	}
+	return replies, nil
+}
+
+// GetUserPosts implements PostRepository.
+func (p *memoryRepo) GetUserPosts(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	defer p.rlock()()
+
+	if err := p.existUser(info.UserID); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	viewerID := info.ViewerID
+	if viewerID == "" {
+		viewerID = info.UserID
+	}
+
+	var posts model.TimelineResponse
+	for _, post := range p.posts {
+		if post.UserID != info.UserID || post.DeletedAt != nil || !postBefore(*post, info.Before, info.BeforeID) {
+			continue
+		}
+		if p.privateShared(post, viewerID) {
+			continue
+		}
+		posts.Posts = append(posts.Posts, p.withOriginal(*post))
+	}
+	sortNewestFirst(posts.Posts)
+	if len(posts.Posts) > info.Limit {
+		posts.Posts = posts.Posts[:info.Limit]
+	}
+	return posts, nil
+}
+
+// GetHashtagPosts implements PostRepository.
+func (p *memoryRepo) GetHashtagPosts(ctx context.Context, tag string, info model.TimelineRequest) (model.TimelineResponse, error) {
+	defer p.rlock()()
+
+	var posts model.TimelineResponse
+	for _, post := range p.posts {
+		if post.DeletedAt != nil || !slices.Contains(post.Hashtags, tag) || !postBefore(*post, info.Before, info.BeforeID) {
+			continue
+		}
+		if p.hiddenInFeed(post, info.UserID) {
+			continue
+		}
+		taggedPost := p.withOriginal(*post)
+		taggedPost.LikedByViewer = p.likes[likeKey{userID: info.UserID, postID: post.ID}]
+		posts.Posts = append(posts.Posts, taggedPost)
+	}
+	sortNewestFirst(posts.Posts)
+	if len(posts.Posts) > info.Limit {
+		posts.Posts = posts.Posts[:info.Limit]
+	}
+	return posts, nil
+}
+
+// GetMentions implements PostRepository.
+func (p *memoryRepo) GetMentions(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	defer p.rlock()()
+
+	if err := p.existUser(info.UserID); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	viewerID := info.ViewerID
+	if viewerID == "" {
+		viewerID = info.UserID
+	}
+
+	var posts model.TimelineResponse
+	for _, post := range p.posts {
+		mentioned := slices.ContainsFunc(post.Mentions, func(mention model.Mention) bool {
+			return mention.UserID == info.UserID
+		})
+		if !mentioned || post.DeletedAt != nil || !postBefore(*post, info.Before, info.BeforeID) {
+			continue
+		}
+		if p.hiddenInFeed(post, viewerID) {
+			continue
+		}
+		mentionPost := p.withOriginal(*post)
+		mentionPost.LikedByViewer = p.likes[likeKey{userID: viewerID, postID: post.ID}]
+		posts.Posts = append(posts.Posts, mentionPost)
+	}
+	sortNewestFirst(posts.Posts)
+	if len(posts.Posts) > info.Limit {
+		posts.Posts = posts.Posts[:info.Limit]
+	}
+	return posts, nil
+}
+
+// FollowUser implements PostRepository.
+func (p *memoryRepo) FollowUser(ctx context.Context, followerID string, followeeID string) (string, bool, error) {
+	defer p.lock()()
+
+	if err := p.checkUsers(followerID, followeeID); err != nil {
+		return "", false, err
+	}
+	if p.blocked(followerID, followeeID) {
+		return "", false, model.ErrUserBlocked
+	}
+	key := followKey{followerID: followerID, followeeID: followeeID}
+	if p.follows[key] {
+		return model.FollowActive, false, nil
+	}
+	if p.users[followeeID].IsPrivate {
+		p.requests[key] = true
+		return model.FollowPending, true, nil
+	}
+	p.follows[key] = true
+	p.notify(model.NotificationFollow, followeeID, followerID, "")
+	return model.FollowActive, true, nil
+}
+
+// UnfollowUser implements PostRepository.
+func (p *memoryRepo) UnfollowUser(ctx context.Context, followerID string, followeeID string) error {
+	defer p.lock()()
+
+	if err := p.checkUsers(followerID, followeeID); err != nil {
+		return err
+	}
+	key := followKey{followerID: followerID, followeeID: followeeID}
+	if _, ok := p.follows[key]; ok {
+		p.follows[key] = false
+	}
+	delete(p.requests, key)
+	p.retractNotification(model.NotificationFollow, followeeID, followerID, "")
+	return nil
+}
+
+// GetFollowees implements PostRepository.
+func (p *memoryRepo) GetFollowees(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	defer p.rlock()()
+
+	var followees []model.UserSummary
+	for key, active := range p.follows {
+		if active && key.followerID == req.UserID {
+			followees = p.appendSummary(followees, key.followeeID, req.After)
+		}
+	}
+	p.logger.Sugar().Infow("Got followees info", "user_id", req.UserID)
+	return newFollowListResponse(sortSummaries(followees, req.Limit), req.Limit), nil
+}
+
+// GetFollowers implements PostRepository.
+func (p *memoryRepo) GetFollowers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	defer p.rlock()()
+
+	var followers []model.UserSummary
+	for key, active := range p.follows {
+		if active && key.followeeID == req.UserID {
+			followers = p.appendSummary(followers, key.followerID, req.After)
+		}
+	}
+	p.logger.Sugar().Infow("Got followers info", "user_id", req.UserID)
+	return newFollowListResponse(sortSummaries(followers, req.Limit), req.Limit), nil
+}
+
+// FollowersAmong implements PostRepository.
+func (p *memoryRepo) FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error) {
+	defer p.rlock()()
+
+	var followers []string
+	for _, userID := range userIDs {
+		key := relationKey{userID: userID, otherID: followeeID}
+		if p.follows[followKey{followerID: userID, followeeID: followeeID}] && !p.blocks[key] && !p.mutes[key] {
+			followers = append(followers, userID)
+		}
+	}
+	return followers, nil
+}
+
+// ReadersAmong implements PostRepository.
+func (p *memoryRepo) ReadersAmong(ctx context.Context, postID string, userIDs []string) ([]string, error) {
+	defer p.rlock()()
+
+	post, ok := p.posts[postID]
+	if !ok {
+		return nil, nil
+	}
+	var readers []string
+	for _, userID := range userIDs {
+		if !p.hiddenInFeed(post, userID) {
+			readers = append(readers, userID)
+		}
+	}
+	return readers, nil
+}
+
+// GetFollowRequests implements PostRepository.
+func (p *memoryRepo) GetFollowRequests(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	defer p.rlock()()
+
+	var requesters []model.UserSummary
+	for key := range p.requests {
+		if key.followeeID == req.UserID {
+			requesters = p.appendSummary(requesters, key.followerID, req.After)
+		}
+	}
+	return newFollowListResponse(sortSummaries(requesters, req.Limit), req.Limit), nil
+}
+
+// ApproveFollowRequest implements PostRepository.
+func (p *memoryRepo) ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	defer p.lock()()
+
+	key := followKey{followerID: followerID, followeeID: followeeID}
+	if !p.requests[key] {
+		return model.ErrNoFollowRequest
+	}
+	delete(p.requests, key)
+	p.follows[key] = true
+	return nil
+}
+
+// RejectFollowRequest implements PostRepository.
+func (p *memoryRepo) RejectFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	defer p.lock()()
+
+	key := followKey{followerID: followerID, followeeID: followeeID}
+	if !p.requests[key] {
+		return model.ErrNoFollowRequest
+	}
+	delete(p.requests, key)
+	return nil
+}
+
+// SetPrivate implements PostRepository.
+func (p *memoryRepo) SetPrivate(ctx context.Context, userID string, private bool) error {
+	defer p.lock()()
+
+	user, ok := p.users[userID]
+	if !ok {
+		return model.ErrUserNotFound
+	}
+	user.IsPrivate = private
+	user.UpdatedAt = p.now()
+	if !private {
+		for key := range p.requests {
+			if key.followeeID == userID {
+				delete(p.requests, key)
+				p.follows[key] = true
+			}
+		}
+	}
+	return nil
+}
+
+// CanViewPosts implements PostRepository.
+func (p *memoryRepo) CanViewPosts(ctx context.Context, viewerID, authorID string) (bool, error) {
+	defer p.rlock()()
+
+	if err := p.existUser(authorID); err != nil {
+		return false, err
+	}
+	return p.canView(viewerID, authorID), nil
+}
+
+// BlockUser implements PostRepository.
+func (p *memoryRepo) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	defer p.lock()()
+
+	if err := p.checkUsers(blockerID, blockedID); err != nil {
+		return err
+	}
+	p.blocks[relationKey{userID: blockerID, otherID: blockedID}] = true
+	for _, key := range []followKey{{followerID: blockerID, followeeID: blockedID}, {followerID: blockedID, followeeID: blockerID}} {
+		if _, ok := p.follows[key]; ok {
+			p.follows[key] = false
+		}
+		delete(p.requests, key)
+		p.retractNotification(model.NotificationFollow, key.followeeID, key.followerID, "")
+	}
+	return nil
+}
+
+// UnblockUser implements PostRepository.
+func (p *memoryRepo) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	defer p.lock()()
+
+	if err := p.checkUsers(blockerID, blockedID); err != nil {
+		return err
+	}
+	delete(p.blocks, relationKey{userID: blockerID, otherID: blockedID})
+	return nil
+}
+
+// GetBlockedUsers implements PostRepository.
+func (p *memoryRepo) GetBlockedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	defer p.rlock()()
+
+	return p.relationList(p.blocks, req), nil
+}
+
+// Blocked implements PostRepository.
+func (p *memoryRepo) Blocked(ctx context.Context, userID, otherID string) (bool, error) {
+	defer p.rlock()()
+
+	return p.blocked(userID, otherID), nil
+}
+
+// Muted implements PostRepository.
+func (p *memoryRepo) Muted(ctx context.Context, muterID, mutedID string) (bool, error) {
+	defer p.rlock()()
+
+	return p.mutes[relationKey{userID: muterID, otherID: mutedID}], nil
+}
+
+// MuteUser implements PostRepository.
+func (p *memoryRepo) MuteUser(ctx context.Context, muterID, mutedID string) error {
+	defer p.lock()()
+
+	if err := p.checkUsers(muterID, mutedID); err != nil {
+		return err
+	}
+	p.mutes[relationKey{userID: muterID, otherID: mutedID}] = true
+	return nil
+}
+
+// UnmuteUser implements PostRepository.
+func (p *memoryRepo) UnmuteUser(ctx context.Context, muterID, mutedID string) error {
+	defer p.lock()()
+
+	if err := p.checkUsers(muterID, mutedID); err != nil {
+		return err
+	}
+	delete(p.mutes, relationKey{userID: muterID, otherID: mutedID})
+	return nil
+}
+
+// GetMutedUsers implements PostRepository.
+func (p *memoryRepo) GetMutedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	defer p.rlock()()
+
+	return p.relationList(p.mutes, req), nil
+}
+
+// relationList pages through the users blocked or muted by req.UserID, it must be called with the lock held
+func (p *memoryRepo) relationList(relations map[relationKey]bool, req model.FollowListRequest) model.FollowListResponse {
+	var users []model.UserSummary
+	for key := range relations {
+		if key.userID == req.UserID {
+			users = p.appendSummary(users, key.otherID, req.After)
+		}
+	}
+	return newFollowListResponse(sortSummaries(users, req.Limit), req.Limit)
+}
+
+// CreateUser implements PostRepository.
+func (p *memoryRepo) CreateUser(ctx context.Context, userData model.CreateUserRequest) (uuid.UUID, error) {
+	defer p.lock()()
+
+	for _, user := range p.users {
+		if user.Name == userData.Name || user.Email == userData.Email {
+			return uuid.Nil, fmt.Errorf("failed to insert user: user_name or email already registered")
+		}
+	}
+
+	userID := uuid.New()
+	now := p.now()
+	p.users[userID.String()] = &memoryUser{
+		User: model.User{
+			ID:        userID.String(),
+			Name:      userData.Name,
+			IsPrivate: userData.IsPrivate,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Email:    userData.Email,
+		Password: userData.Password,
+	}
+	p.logger.Sugar().Infow("User created successfully", "user_id", userID.String())
+	return userID, nil
+}
+
+// DeleteUser implements PostRepository.
+func (p *memoryRepo) DeleteUser(ctx context.Context, userID string) error {
+	defer p.lock()()
+
+	if err := p.existUser(userID); err != nil {
+		return err
+	}
+	delete(p.users, userID)
+	// follows, follow requests, blocks, mutes and likes cascade on user deletion
+	for _, follows := range []map[followKey]bool{p.follows, p.requests} {
+		for key := range follows {
+			if key.followerID == userID || key.followeeID == userID {
+				delete(follows, key)
+			}
+		}
+	}
+	for _, relations := range []map[relationKey]bool{p.blocks, p.mutes} {
+		for key := range relations {
+			if key.userID == userID || key.otherID == userID {
+				delete(relations, key)
+			}
+		}
+	}
+	for key := range p.likes {
+		if key.userID == userID {
+			delete(p.likes, key)
+			p.posts[key.postID].LikeCount--
+		}
+	}
+	p.notifications = slices.DeleteFunc(p.notifications, func(n *memoryNotification) bool {
+		return n.userID == userID || n.actorID == userID
+	})
+	for _, post := range p.posts {
+		// copy on write, readers may still hold the previous slice
+		post.Mentions = slices.DeleteFunc(slices.Clone(post.Mentions), func(mention model.Mention) bool {
+			return mention.UserID == userID
+		})
+	}
+	p.logger.Sugar().Infow("User is deleted", "user_id", userID)
+	return nil
+}
+
+// GetUser implements PostRepository.
+func (p *memoryRepo) GetUser(ctx context.Context, userID string) (model.User, error) {
+	defer p.rlock()()
+
+	user, ok := p.users[userID]
+	if !ok {
+		return model.User{}, model.ErrUserNotFound
+	}
+	return user.User, nil
+}
+
+// GetUserProfile implements PostRepository.
+func (p *memoryRepo) GetUserProfile(ctx context.Context, userID string) (model.UserProfile, error) {
+	defer p.rlock()()
+
+	user, ok := p.users[userID]
+	if !ok {
+		return model.UserProfile{}, model.ErrUserNotFound
+	}
+
+	profile := model.UserProfile{
+		ID:        user.ID,
+		Name:      user.Name,
+		IsPrivate: user.IsPrivate,
+		CreatedAt: user.CreatedAt,
+	}
+	for key, active := range p.follows {
+		if !active {
+			continue
+		}
+		if key.followeeID == userID {
+			profile.FollowerCount++
+		}
+		if key.followerID == userID {
+			profile.FolloweeCount++
+		}
+	}
+	if post, ok := p.posts[user.LastPostID.String()]; ok && post.DeletedAt == nil {
+		lastPost := *post
+		profile.LastPost = &lastPost
+	}
+	return profile, nil
+}
+
+// GetUserCredentials implements PostRepository.
+func (p *memoryRepo) GetUserCredentials(ctx context.Context, email string) (model.UserCredentials, error) {
+	defer p.rlock()()
+
+	for _, user := range p.users {
+		if user.Email == email {
+			return model.UserCredentials{ID: user.ID, PasswordHash: user.Password}, nil
+		}
+	}
+	return model.UserCredentials{}, model.ErrUserNotFound
+}
+
+// checkUsers must be called with the lock held
+func (p *memoryRepo) checkUsers(followerID, followeeID string) error {
+	if err := p.existUser(followerID); err != nil {
+		return err
+	}
+	return p.existUser(followeeID)
+}
+
+// existUser must be called with the lock held
+func (p *memoryRepo) existUser(userID string) error {
+	if _, ok := p.users[userID]; !ok {
+		p.logger.Sugar().Errorw("user_id does not exist", "user_id", userID)
+		return model.ErrUserNotFound
+	}
+	return nil
+}
+
+// updateUserLastPost must be called with the lock held
+func (p *memoryRepo) updateUserLastPost(postID uuid.UUID, userID string, updatedAt time.Time) {
+	user, ok := p.users[userID]
+	if !ok {
+		return
+	}
+	user.LastPostID = postID
+	user.UpdatedAt = updatedAt
+}
+
+// existPost must be called with the lock held
+func (p *memoryRepo) existPost(postID uuid.UUID, userID string) (*model.Post, error) {
+	stored, ok := p.posts[postID.String()]
+	if !ok || stored.UserID != userID || stored.DeletedAt != nil {
+		p.logger.Sugar().Errorw("post_id does not exist for user_id", "post_id", postID.String(), "user_id", userID)
+		return nil, model.ErrPostNotFound
+	}
+	return stored, nil
+}
+
+// supersededInTimeline mirrors timelineDedup: it reports whether a followee of readerID reposted the
+// post shared by post later in a repost readerID gets, or whether post is a repost of a deleted post. It must be called with the lock held.
+func (p *memoryRepo) supersededInTimeline(post *model.Post, readerID string) bool {
+	target := post.ID
+	if post.Kind == model.PostKindRepost {
+		target = *post.RepostOf
+		if original, ok := p.posts[target]; !ok || original.DeletedAt != nil {
+			return true
+		}
+	}
+	for _, other := range p.posts {
+		if other.Kind != model.PostKindRepost || other.DeletedAt != nil || *other.RepostOf != target {
+			continue
+		}
+		if !p.follows[followKey{followerID: readerID, followeeID: other.UserID}] || !postAfter(*other, post.CreatedAt, post.ID) {
+			continue
+		}
+		// a later repost the reader does not get does not replace the entry
+		if !p.hiddenInTimeline(other, readerID) && !p.privateShared(other, readerID) {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenInTimeline mirrors timelineHidden: it reports whether readerID blocked, muted or was blocked
+// by the author of post or of the post it shares. It must be called with the lock held.
+func (p *memoryRepo) hiddenInTimeline(post *model.Post, readerID string) bool {
+	authors := []string{post.UserID}
+	if post.RepostOf != nil {
+		if original, ok := p.posts[*post.RepostOf]; ok {
+			authors = append(authors, original.UserID)
+		}
+	}
+	for _, authorID := range authors {
+		key := relationKey{userID: readerID, otherID: authorID}
+		if p.blocked(readerID, authorID) || p.mutes[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenInFeed mirrors feedHidden of the postgres repository: it reports whether post is left out of
+// the hashtag and mention feeds, and the threads, read by viewerID. It must be called with the lock held.
+func (p *memoryRepo) hiddenInFeed(post *model.Post, viewerID string) bool {
+	return p.unreadable(post, viewerID) || p.hiddenInTimeline(post, viewerID)
+}
+
+// unreadable mirrors existReadablePost: it reports whether post, or the post it shares, was written
+// by a private account viewerID does not follow. It must be called with the lock held.
+func (p *memoryRepo) unreadable(post *model.Post, viewerID string) bool {
+	return !p.canView(viewerID, post.UserID) || p.privateShared(post, viewerID)
+}
+
+// privateShared mirrors privateShared of the postgres repository: it reports whether post shares a
+// post of a private account viewerID does not follow. It must be called with the lock held.
+func (p *memoryRepo) privateShared(post *model.Post, viewerID string) bool {
+	if post.RepostOf == nil {
+		return false
+	}
+	original, ok := p.posts[*post.RepostOf]
+	return ok && !p.canView(viewerID, original.UserID)
+}
+
+// canView reports whether viewerID may read the posts of authorID, it must be called with the lock held
+func (p *memoryRepo) canView(viewerID, authorID string) bool {
+	author, ok := p.users[authorID]
+	return viewerID == authorID || !ok || !author.IsPrivate || p.follows[followKey{followerID: viewerID, followeeID: authorID}]
+}
+
+// blocked reports whether userID or otherID blocked the other, it must be called with the lock held
+func (p *memoryRepo) blocked(userID, otherID string) bool {
+	return p.blocks[relationKey{userID: userID, otherID: otherID}] || p.blocks[relationKey{userID: otherID, otherID: userID}]
+}
+
+// withOriginal returns post with the shared post of reposts and quotes attached, deleted originals
+// are tombstones without content. It must be called with the lock held.
+func (p *memoryRepo) withOriginal(post model.Post) model.Post {
+	if post.RepostOf == nil {
+		return post
+	}
+	if stored, ok := p.posts[*post.RepostOf]; ok {
+		original := *stored
+		if original.DeletedAt != nil {
+			original.Content = ""
+			original.ContentWarning = nil
+		}
+		post.Original = &original
+	}
+	return post
+}
+
+// resolveMentions mirrors indexMentions: it keeps the mentions whose username matches a user, with
+// its id. It must be called with the lock held.
+func (p *memoryRepo) resolveMentions(mentions []model.Mention) model.Mentions {
+	var resolved model.Mentions
+	for _, mention := range mentions {
+		for id, user := range p.users {
+			if user.Name == mention.Username {
+				resolved = append(resolved, model.Mention{Offset: mention.Offset, Length: mention.Length, UserID: id})
+				break
+			}
+		}
+	}
+	return resolved
+}
+
+// descendsFrom reports whether post is a direct or indirect reply to ancestorID, it must be called
+// with the lock held
+func (p *memoryRepo) descendsFrom(post *model.Post, ancestorID string) bool {
+	for post.InReplyTo != nil {
+		if *post.InReplyTo == ancestorID {
+			return true
+		}
+		parent, ok := p.posts[*post.InReplyTo]
+		if !ok {
+			return false
+		}
+		post = parent
+	}
+	return false
+}
+
+// latestPostID returns the newest non deleted post of the user, it must be called with the lock held
+func (p *memoryRepo) latestPostID(userID string) uuid.UUID {
+	var latest *model.Post
+	for _, post := range p.posts {
+		if post.UserID != userID || post.DeletedAt != nil {
+			continue
+		}
+		if latest == nil || post.CreatedAt.After(latest.CreatedAt) {
+			latest = post
+		}
+	}
+	if latest == nil {
+		return uuid.Nil
+	}
+	return uuid.MustParse(latest.ID)
+}
+
+// sortNewestFirst orders posts by (created_at, id) descending, like the Postgres queries
+func sortNewestFirst(posts []model.Post) {
+	sort.Slice(posts, func(i, j int) bool {
+		return postBefore(posts[j], posts[i].CreatedAt, posts[i].ID)
+	})
+}
+
+// postBefore reports whether (post.created_at, post.id) < (createdAt, cursorPostID(postID))
+func postBefore(post model.Post, createdAt time.Time, postID string) bool {
+	if !post.CreatedAt.Equal(createdAt) {
+		return post.CreatedAt.Before(createdAt)
+	}
+	return post.ID < cursorPostID(postID)
+}
+
+// postAfter reports whether (post.created_at, post.id) > (createdAt, sinceCursorPostID(postID))
+func postAfter(post model.Post, createdAt time.Time, postID string) bool {
+	if !post.CreatedAt.Equal(createdAt) {
+		return post.CreatedAt.After(createdAt)
+	}
+	return post.ID > sinceCursorPostID(postID)
+}
+
+// appendSummary adds the user when it sorts after the keyset cursor, it must be called with the lock held
+func (p *memoryRepo) appendSummary(summaries []model.UserSummary, userID, after string) []model.UserSummary {
+	user, ok := p.users[userID]
+	if !ok || userID <= keysetAfter(after) {
+		return summaries
+	}
+	return append(summaries, model.UserSummary{ID: user.ID, Name: user.Name})
+}
+
+// sortSummaries orders by id and keeps limit+1 users so the caller can tell if there is a next page
+func sortSummaries(summaries []model.UserSummary, limit int) []model.UserSummary {
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].ID < summaries[j].ID
+	})
+	if len(summaries) > limit+1 {
+		summaries = summaries[:limit+1]
+	}
+	return summaries
+}
+
+// notify mirrors the postgres notifications: repeated events are recorded once and users are not
+// notified of their own actions nor of those of users blocking or blocked by them. It must be called
+// with the lock held.
+func (p *memoryRepo) notify(kind, recipientID, actorID, postID string) {
+	if recipientID == actorID || p.blocked(recipientID, actorID) {
+		return
+	}
+	for _, n := range p.notifications {
+		if n.kind == kind && n.userID == recipientID && n.actorID == actorID && n.postID == postID {
+			return
+		}
+	}
+	p.notifications = append(p.notifications, &memoryNotification{
+		id:        uuid.NewString(),
+		userID:    recipientID,
+		actorID:   actorID,
+		kind:      kind,
+		postID:    postID,
+		createdAt: p.now(),
+	})
+}
+
+// notifyMentioned notifies the users mentioned by post but those blocking or blocked by its author.
+// It must be called with the lock held.
+func (p *memoryRepo) notifyMentioned(post *model.Post) {
+	for _, mention := range post.Mentions {
+		p.notify(model.NotificationMention, mention.UserID, post.UserID, post.ID)
+	}
+}
+
+// retractNotification deletes the notification of an undone event, it must be called with the lock held
+func (p *memoryRepo) retractNotification(kind, recipientID, actorID, postID string) {
+	p.notifications = slices.DeleteFunc(p.notifications, func(n *memoryNotification) bool {
+		return n.kind == kind && n.userID == recipientID && n.actorID == actorID && n.postID == postID
+	})
+}
+
+// visibleNotification reports whether n belongs to userID and is not about a deleted post, it must
+// be called with the lock held
+func (p *memoryRepo) visibleNotification(n *memoryNotification, userID string) bool {
+	if n.userID != userID {
+		return false
+	}
+	if n.postID == "" {
+		return true
+	}
+	post, ok := p.posts[n.postID]
+	return ok && post.DeletedAt == nil
+}
+
+// GetNotifications implements PostRepository.
+func (p *memoryRepo) GetNotifications(ctx context.Context, info model.TimelineRequest) ([]model.NotificationGroup, error) {
+	defer p.rlock()()
+
+	type groupKey struct {
+		kind   string
+		postID string
+		read   bool
+	}
+	groups := make(map[groupKey]*model.NotificationGroup)
+	// newest first, so that the first notification of a group names it
+	for i := len(p.notifications) - 1; i >= 0; i-- {
+		n := p.notifications[i]
+		if !p.visibleNotification(n, info.UserID) {
+			continue
+		}
+		key := groupKey{kind: n.kind, postID: n.postID, read: n.read}
+		group, ok := groups[key]
+		if !ok {
+			group = &model.NotificationGroup{ID: n.id, Type: n.kind, Read: n.read, CreatedAt: n.createdAt}
+			if n.postID != "" {
+				postID := n.postID
+				group.PostID = &postID
+			}
+			groups[key] = group
+		}
+		group.ActorCount++
+		if len(group.Actors) < 3 {
+			group.Actors = append(group.Actors, model.UserSummary{ID: n.actorID, Name: p.users[n.actorID].Name})
+		}
+	}
+
+	var page []model.NotificationGroup
+	for _, group := range groups {
+		if postBefore(model.Post{ID: group.ID, CreatedAt: group.CreatedAt}, info.Before, info.BeforeID) {
+			page = append(page, *group)
+		}
+	}
+	slices.SortFunc(page, func(a, b model.NotificationGroup) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if len(page) > info.Limit {
+		page = page[:info.Limit]
+	}
+	return page, nil
+}
+
+// CountUnreadNotifications implements PostRepository.
+func (p *memoryRepo) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	defer p.rlock()()
+
+	var count int
+	for _, n := range p.notifications {
+		if !n.read && p.visibleNotification(n, userID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MarkNotificationsRead implements PostRepository.
+func (p *memoryRepo) MarkNotificationsRead(ctx context.Context, userID string, ids []string) (int, error) {
+	defer p.lock()()
+
+	var newest []*memoryNotification
+	for _, n := range p.notifications {
+		if n.userID == userID && slices.Contains(ids, n.id) {
+			newest = append(newest, n)
+		}
+	}
+
+	var marked int
+	for _, n := range p.notifications {
+		if n.userID != userID || n.read {
+			continue
+		}
+		inGroup := len(ids) == 0 || slices.ContainsFunc(newest, func(g *memoryNotification) bool {
+			return g.kind == n.kind && g.postID == n.postID && !n.createdAt.After(g.createdAt)
+		})
+		if inGroup {
+			n.read = true
+			marked++
+		}
+	}
+	return marked, nil
+}
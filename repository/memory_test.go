@@ -0,0 +1,1024 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newTestMemoryRepo returns an in-memory repository whose clock advances one second per call
+func newTestMemoryRepo() *memoryRepo {
+	repo := NewMemoryRepository(zap.NewNop()).(*memoryRepo)
+	clock := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	repo.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	return repo
+}
+
+func createTestUser(t *testing.T, repo PostRepository, name string) string {
+	t.Helper()
+	id, err := repo.CreateUser(t.Context(), model.CreateUserRequest{Name: name, Email: name + "@example.com", Password: "hash"})
+	require.NoError(t, err)
+	return id.String()
+}
+
+// followTestUser follows followeeID on behalf of followerID and requires the follow to be active
+func followTestUser(t *testing.T, repo PostRepository, followerID, followeeID string) {
+	t.Helper()
+	state, _, err := repo.FollowUser(t.Context(), followerID, followeeID)
+	require.NoError(t, err)
+	require.Equal(t, model.FollowActive, state)
+}
+
+// likeTestPost likes postID on behalf of userID and reports whether the like is new
+func likeTestPost(t *testing.T, repo PostRepository, userID, postID string) bool {
+	t.Helper()
+	liked, err := repo.LikePost(t.Context(), userID, postID)
+	require.NoError(t, err)
+	return liked
+}
+
+func TestMemoryCreateUser(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+
+	t.Run("duplicated_name", func(t *testing.T) {
+		_, err := repo.CreateUser(t.Context(), model.CreateUserRequest{Name: "alice", Email: "other@example.com"})
+		assert.Error(t, err)
+	})
+
+	t.Run("credentials_by_email", func(t *testing.T) {
+		creds, err := repo.GetUserCredentials(t.Context(), "alice@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, model.UserCredentials{ID: aliceID, PasswordHash: "hash"}, creds)
+
+		_, err = repo.GetUserCredentials(t.Context(), "nobody@example.com")
+		assert.Equal(t, model.ErrUserNotFound, err)
+	})
+
+	t.Run("delete_user", func(t *testing.T) {
+		assert.NoError(t, repo.DeleteUser(t.Context(), aliceID))
+		_, err := repo.GetUser(t.Context(), aliceID)
+		assert.Equal(t, model.ErrUserNotFound, err)
+		assert.Equal(t, model.ErrUserNotFound, repo.DeleteUser(t.Context(), aliceID))
+	})
+}
+
+func TestMemorySaveAndUpdatePost(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "Hello world"})
+	require.NoError(t, err)
+
+	user, err := repo.GetUser(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, postID, user.LastPostID)
+
+	tests := []struct {
+		name        string
+		input       model.CreatePostRequest
+		expectedErr error
+	}{
+		{
+			name:        "success",
+			input:       model.CreatePostRequest{PostID: postID.String(), UserID: aliceID, Content: "Edited"},
+			expectedErr: nil,
+		},
+		{
+			name:        "other_author",
+			input:       model.CreatePostRequest{PostID: postID.String(), UserID: bobID, Content: "Edited"},
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:        "unknown_post",
+			input:       model.CreatePostRequest{PostID: uuid.New().String(), UserID: aliceID, Content: "Edited"},
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:        "invalid_uuid",
+			input:       model.CreatePostRequest{PostID: "not-a-uuid", UserID: aliceID, Content: "Edited"},
+			expectedErr: model.ErrInvalidUUID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedErr, repo.UpdatePostPut(t.Context(), tt.input))
+		})
+	}
+	assert.Equal(t, "Edited", repo.posts[postID.String()].Content)
+
+	// editing an older post keeps the latest one as the last post
+	latestID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "Latest"})
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdatePostPut(t.Context(), model.CreatePostRequest{PostID: postID.String(), UserID: aliceID, Content: "Edited again"}))
+	user, err = repo.GetUser(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, latestID, user.LastPostID)
+}
+
+func TestMemoryDeletePost(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	followTestUser(t, repo, bobID, aliceID)
+
+	first, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "first"})
+	require.NoError(t, err)
+	second, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "second"})
+	require.NoError(t, err)
+
+	assert.Equal(t, model.ErrPostNotFound, repo.DeletePost(t.Context(), second.String(), bobID))
+	require.NoError(t, repo.DeletePost(t.Context(), second.String(), aliceID))
+	assert.Equal(t, model.ErrPostNotFound, repo.DeletePost(t.Context(), second.String(), aliceID))
+
+	user, err := repo.GetUser(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, first, user.LastPostID)
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: bobID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, timeline.Posts, 1)
+	assert.Equal(t, first.String(), timeline.Posts[0].ID)
+
+	// deleted posts can not be edited
+	err = repo.UpdatePostPut(t.Context(), model.CreatePostRequest{PostID: second.String(), UserID: aliceID, Content: "edit"})
+	assert.Equal(t, model.ErrPostNotFound, err)
+
+	require.NoError(t, repo.DeletePost(t.Context(), first.String(), aliceID))
+	user, err = repo.GetUser(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, user.LastPostID)
+}
+
+func TestMemoryGetPosts(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		id, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: fmt.Sprintf("post %d", i)})
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.NoError(t, repo.DeletePost(t.Context(), ids[2].String(), aliceID))
+
+	post, err := repo.GetPost(t.Context(), ids[2].String())
+	require.NoError(t, err)
+	assert.NotNil(t, post.DeletedAt)
+
+	_, err = repo.GetPost(t.Context(), uuid.New().String())
+	assert.Equal(t, model.ErrPostNotFound, err)
+
+	posts, err := repo.GetUserPosts(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, posts.Posts, 2)
+	assert.Equal(t, ids[1].String(), posts.Posts[0].ID)
+
+	_, err = repo.GetUserPosts(t.Context(), model.TimelineRequest{UserID: uuid.New().String(), Before: time.Now(), Limit: 10})
+	assert.Equal(t, model.ErrUserNotFound, err)
+}
+
+func TestMemoryGetUserProfile(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	followTestUser(t, repo, bobID, aliceID)
+	followTestUser(t, repo, carolID, aliceID)
+	followTestUser(t, repo, aliceID, bobID)
+	require.NoError(t, repo.UnfollowUser(t.Context(), carolID, aliceID))
+
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "Hello"})
+	require.NoError(t, err)
+
+	profile, err := repo.GetUserProfile(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", profile.Name)
+	assert.Equal(t, 1, profile.FollowerCount)
+	assert.Equal(t, 1, profile.FolloweeCount)
+	require.NotNil(t, profile.LastPost)
+	assert.Equal(t, postID.String(), profile.LastPost.ID)
+
+	_, err = repo.GetUserProfile(t.Context(), uuid.New().String())
+	assert.Equal(t, model.ErrUserNotFound, err)
+}
+
+func TestMemoryFollows(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+
+	_, _, err := repo.FollowUser(t.Context(), aliceID, uuid.New().String())
+	assert.Equal(t, model.ErrUserNotFound, err)
+	followTestUser(t, repo, aliceID, bobID)
+	followTestUser(t, repo, aliceID, bobID) // upsert
+
+	followees, err := repo.GetFollowees(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: bobID, Name: "bob"}}, followees.Users)
+
+	followers, err := repo.GetFollowers(t.Context(), model.FollowListRequest{UserID: bobID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: aliceID, Name: "alice"}}, followers.Users)
+
+	among, err := repo.FollowersAmong(t.Context(), bobID, []string{aliceID, bobID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{aliceID}, among)
+
+	assert.NoError(t, repo.UnfollowUser(t.Context(), aliceID, bobID))
+	assert.False(t, repo.follows[followKey{followerID: aliceID, followeeID: bobID}])
+
+	followees, err = repo.GetFollowees(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, followees.Users)
+}
+
+func TestMemoryFollowListPagination(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	var followees []string
+	for i := 0; i < 5; i++ {
+		id := createTestUser(t, repo, fmt.Sprintf("user%d", i))
+		followTestUser(t, repo, aliceID, id)
+		followees = append(followees, id)
+	}
+	sort.Strings(followees)
+
+	var got []string
+	req := model.FollowListRequest{UserID: aliceID, Limit: 2}
+	for {
+		page, err := repo.GetFollowees(t.Context(), req)
+		require.NoError(t, err)
+		for _, u := range page.Users {
+			got = append(got, u.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.After = page.NextCursor
+	}
+	assert.Equal(t, followees, got)
+}
+
+func TestMemoryGetTimeline(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	followTestUser(t, repo, aliceID, bobID)
+	followTestUser(t, repo, aliceID, carolID)
+
+	var bobPosts []uuid.UUID
+	for i := 0; i < 3; i++ {
+		id, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: fmt.Sprintf("bob %d", i)})
+		require.NoError(t, err)
+		bobPosts = append(bobPosts, id)
+	}
+	_, err := repo.Save(t.Context(), &model.Post{UserID: carolID, Content: "carol"})
+	require.NoError(t, err)
+	_, err = repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "own post"})
+	require.NoError(t, err)
+
+	t.Run("newest_first_with_limit", func(t *testing.T) {
+		timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 2})
+		assert.NoError(t, err)
+		require.Len(t, timeline.Posts, 2)
+		assert.Equal(t, "carol", timeline.Posts[0].Content)
+		assert.Equal(t, bobPosts[2].String(), timeline.Posts[1].ID)
+	})
+
+	t.Run("before_filter", func(t *testing.T) {
+		before := repo.posts[bobPosts[1].String()].CreatedAt
+		timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: before, Limit: 10})
+		assert.NoError(t, err)
+		require.Len(t, timeline.Posts, 1)
+		assert.Equal(t, bobPosts[0].String(), timeline.Posts[0].ID)
+	})
+
+	t.Run("since_returns_newer_posts_oldest_first", func(t *testing.T) {
+		after := repo.posts[bobPosts[0].String()].CreatedAt
+		timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, After: after, AfterID: bobPosts[0].String(), Limit: 2})
+		assert.NoError(t, err)
+		require.Len(t, timeline.Posts, 2)
+		assert.Equal(t, bobPosts[1].String(), timeline.Posts[0].ID)
+		assert.Equal(t, bobPosts[2].String(), timeline.Posts[1].ID)
+	})
+
+	t.Run("inactive_follow_is_ignored", func(t *testing.T) {
+		require.NoError(t, repo.UnfollowUser(t.Context(), aliceID, carolID))
+		timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, timeline.Posts, 3)
+	})
+}
+
+func TestMemoryGetTimelineSameTimestamp(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	followTestUser(t, repo, aliceID, bobID)
+
+	createdAt := time.Date(2025, 4, 18, 13, 0, 0, 0, time.UTC)
+	repo.now = func() time.Time { return createdAt }
+	var want []string
+	for i := 0; i < 5; i++ {
+		id, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: fmt.Sprintf("bob %d", i)})
+		require.NoError(t, err)
+		want = append(want, id.String())
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(want)))
+
+	var got []string
+	req := model.TimelineRequest{UserID: aliceID, Before: createdAt.Add(time.Second), Limit: 2}
+	for {
+		page, err := repo.GetTimeline(t.Context(), req)
+		require.NoError(t, err)
+		for _, p := range page.Posts {
+			got = append(got, p.ID)
+		}
+		if len(page.Posts) < req.Limit {
+			break
+		}
+		last := page.Posts[len(page.Posts)-1]
+		req.Before, req.BeforeID = last.CreatedAt, last.ID
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestMemoryConcurrentSave(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	followTestUser(t, repo, aliceID, bobID)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: fmt.Sprintf("post %d", i)})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 100})
+	assert.NoError(t, err)
+	assert.Len(t, timeline.Posts, 50)
+}
+
+func TestMemoryThread(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+
+	reply := func(parentID uuid.UUID, userID, content string) uuid.UUID {
+		t.Helper()
+		parent := parentID.String()
+		id, err := repo.Save(t.Context(), &model.Post{UserID: userID, Content: content, InReplyTo: &parent})
+		require.NoError(t, err)
+		return id
+	}
+	rootID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "root"})
+	require.NoError(t, err)
+	firstID := reply(rootID, bobID, "first")
+	nestedID := reply(firstID, aliceID, "nested")
+	secondID := reply(rootID, bobID, "second")
+	likeTestPost(t, repo, aliceID, firstID.String())
+	parent := secondID.String()
+	rootRef := rootID.String()
+	quoteID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "quoting the root", InReplyTo: &parent, Kind: model.PostKindQuote, RepostOf: &rootRef})
+	require.NoError(t, err)
+
+	t.Run("missing_parent", func(t *testing.T) {
+		missing := uuid.New().String()
+		_, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "orphan", InReplyTo: &missing})
+		assert.Equal(t, model.ErrParentNotFound, err)
+	})
+
+	t.Run("ancestors_root_first", func(t *testing.T) {
+		ancestors, err := repo.GetAncestors(t.Context(), bobID, nestedID.String())
+		assert.NoError(t, err)
+		require.Len(t, ancestors, 2)
+		assert.Equal(t, rootID.String(), ancestors[0].ID)
+		assert.Equal(t, firstID.String(), ancestors[1].ID)
+		assert.Equal(t, 1, ancestors[1].LikeCount)
+		assert.Equal(t, model.PostKindPost, ancestors[1].Kind)
+
+		ancestors, err = repo.GetAncestors(t.Context(), bobID, rootID.String())
+		assert.NoError(t, err)
+		assert.Empty(t, ancestors)
+	})
+
+	t.Run("replies_paginated_oldest_first", func(t *testing.T) {
+		page, err := repo.GetReplies(t.Context(), model.ThreadRequest{PostID: rootID.String(), ViewerID: bobID, Limit: 2})
+		assert.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, firstID.String(), page[0].ID)
+		assert.Equal(t, nestedID.String(), page[1].ID)
+
+		page, err = repo.GetReplies(t.Context(), model.ThreadRequest{PostID: rootID.String(), ViewerID: bobID, Limit: 2, After: page[1].CreatedAt, AfterID: page[1].ID})
+		assert.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, secondID.String(), page[0].ID)
+		quote := page[1]
+		assert.Equal(t, quoteID.String(), quote.ID)
+		assert.Equal(t, model.PostKindQuote, quote.Kind)
+		assert.Equal(t, 1, quote.Version)
+		require.NotNil(t, quote.Original, "the quoted post is attached")
+		assert.Equal(t, "root", quote.Original.Content)
+	})
+}
+
+func TestMemoryThreadVisibility(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID, err := repo.CreateUser(t.Context(), model.CreateUserRequest{Name: "carol", Email: "carol@example.com", Password: "hash", IsPrivate: true})
+	require.NoError(t, err)
+
+	rootID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "root"})
+	require.NoError(t, err)
+	root := rootID.String()
+	privateID, err := repo.Save(t.Context(), &model.Post{UserID: carolID.String(), Content: "private reply", InReplyTo: &root})
+	require.NoError(t, err)
+	private := privateID.String()
+	// alice may read carol's reply, bob may not
+	_, _, err = repo.FollowUser(t.Context(), aliceID, carolID.String())
+	require.NoError(t, err)
+	require.NoError(t, repo.ApproveFollowRequest(t.Context(), carolID.String(), aliceID))
+	publicID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "public reply", InReplyTo: &private})
+	require.NoError(t, err)
+
+	t.Run("private_posts_are_left_out", func(t *testing.T) {
+		ancestors, err := repo.GetAncestors(t.Context(), bobID, publicID.String())
+		require.NoError(t, err)
+		require.Len(t, ancestors, 1)
+		assert.Equal(t, root, ancestors[0].ID)
+
+		replies, err := repo.GetReplies(t.Context(), model.ThreadRequest{PostID: root, ViewerID: bobID, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, replies, 1)
+		assert.Equal(t, publicID.String(), replies[0].ID)
+	})
+
+	t.Run("authors_can_read_their_posts", func(t *testing.T) {
+		replies, err := repo.GetReplies(t.Context(), model.ThreadRequest{PostID: root, ViewerID: carolID.String(), Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, replies, 2)
+	})
+
+	t.Run("muted_authors_are_left_out", func(t *testing.T) {
+		require.NoError(t, repo.MuteUser(t.Context(), bobID, aliceID))
+		ancestors, err := repo.GetAncestors(t.Context(), bobID, publicID.String())
+		require.NoError(t, err)
+		assert.Empty(t, ancestors)
+		replies, err := repo.GetReplies(t.Context(), model.ThreadRequest{PostID: root, ViewerID: bobID, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, replies)
+	})
+}
+
+func TestMemoryLikes(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	followTestUser(t, repo, aliceID, bobID)
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "like me"})
+	require.NoError(t, err)
+
+	assert.True(t, likeTestPost(t, repo, aliceID, postID.String()))
+	assert.False(t, likeTestPost(t, repo, aliceID, postID.String()), "liking twice is a no-op")
+	assert.True(t, likeTestPost(t, repo, carolID, postID.String()))
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, timeline.Posts, 1)
+	assert.Equal(t, 2, timeline.Posts[0].LikeCount)
+	assert.True(t, timeline.Posts[0].LikedByViewer)
+
+	unliked, err := repo.UnlikePost(t.Context(), aliceID, postID.String())
+	require.NoError(t, err)
+	assert.True(t, unliked)
+	unliked, err = repo.UnlikePost(t.Context(), aliceID, postID.String())
+	require.NoError(t, err)
+	assert.False(t, unliked, "unliking twice is a no-op")
+	timeline, err = repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, timeline.Posts[0].LikeCount)
+	assert.False(t, timeline.Posts[0].LikedByViewer)
+
+	require.NoError(t, repo.DeleteUser(t.Context(), carolID))
+	post, err := repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, 0, post.LikeCount, "deleting a user releases their likes")
+
+	_, err = repo.LikePost(t.Context(), aliceID, uuid.New().String())
+	assert.Equal(t, model.ErrPostNotFound, err)
+}
+
+func TestMemoryReposts(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	daveID := createTestUser(t, repo, "dave")
+	for _, followee := range []string{bobID, carolID, daveID} {
+		followTestUser(t, repo, aliceID, followee)
+	}
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "original"})
+	require.NoError(t, err)
+	original := postID.String()
+
+	_, err = repo.Save(t.Context(), &model.Post{UserID: carolID, Kind: model.PostKindRepost, RepostOf: &original})
+	require.NoError(t, err)
+	_, err = repo.Save(t.Context(), &model.Post{UserID: carolID, Kind: model.PostKindRepost, RepostOf: &original})
+	assert.Equal(t, model.ErrAlreadyReposted, err)
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, timeline.Posts, 1, "the original and its repost are one entry")
+	assert.Equal(t, carolID, timeline.Posts[0].UserID)
+	assert.Equal(t, model.PostKindRepost, timeline.Posts[0].Kind)
+	require.NotNil(t, timeline.Posts[0].Original)
+	assert.Equal(t, "original", timeline.Posts[0].Original.Content)
+
+	_, err = repo.Save(t.Context(), &model.Post{UserID: daveID, Content: "so true", Kind: model.PostKindQuote, RepostOf: &original})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeletePost(t.Context(), original, bobID))
+
+	timeline, err = repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, timeline.Posts, 1, "reposts of deleted posts are dropped, quotes stay")
+	assert.Equal(t, model.PostKindQuote, timeline.Posts[0].Kind)
+	require.NotNil(t, timeline.Posts[0].Original)
+	assert.Empty(t, timeline.Posts[0].Original.Content)
+	assert.NotNil(t, timeline.Posts[0].Original.DeletedAt)
+
+	missing := uuid.New().String()
+	_, err = repo.Save(t.Context(), &model.Post{UserID: carolID, Kind: model.PostKindRepost, RepostOf: &missing})
+	assert.Equal(t, model.ErrSharedPostNotFound, err)
+}
+
+func TestMemoryRepostsHiddenFromReader(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	followTestUser(t, repo, aliceID, bobID)
+	followTestUser(t, repo, aliceID, carolID)
+	require.NoError(t, repo.MuteUser(t.Context(), aliceID, carolID))
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "original"})
+	require.NoError(t, err)
+	original := postID.String()
+	_, err = repo.Save(t.Context(), &model.Post{UserID: carolID, Kind: model.PostKindRepost, RepostOf: &original})
+	require.NoError(t, err)
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, timeline.Posts, 1, "the repost of a muted user does not replace the original")
+	assert.Equal(t, original, timeline.Posts[0].ID)
+}
+
+func TestMemoryHashtagPosts(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	first, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "#go #db", Hashtags: []string{"go", "db"}})
+	require.NoError(t, err)
+	second, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "#go", Hashtags: []string{"go"}})
+	require.NoError(t, err)
+	_, err = repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "untagged"})
+	require.NoError(t, err)
+
+	page, err := repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Posts, 2)
+	assert.Equal(t, second.String(), page.Posts[0].ID)
+
+	// editing re-indexes the post
+	require.NoError(t, repo.UpdatePostPut(t.Context(), model.CreatePostRequest{PostID: first.String(), UserID: aliceID, Content: "#db only", Hashtags: []string{"db"}}))
+	page, err = repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Posts, 1)
+	assert.Equal(t, second.String(), page.Posts[0].ID)
+
+	require.NoError(t, repo.DeletePost(t.Context(), second.String(), bobID))
+	page, err = repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts)
+}
+
+func TestMemoryMentions(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "hi @alice and @nobody", Mentions: model.Mentions{
+		{Offset: 3, Length: 6, Username: "alice"},
+		{Offset: 14, Length: 7, Username: "nobody"},
+	}})
+	require.NoError(t, err)
+
+	post, err := repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, model.Mentions{{Offset: 3, Length: 6, UserID: aliceID}}, post.Mentions, "unknown usernames are dropped")
+
+	page, err := repo.GetMentions(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Posts, 1)
+	assert.Equal(t, postID.String(), page.Posts[0].ID)
+
+	require.NoError(t, repo.UpdatePostPut(t.Context(), model.CreatePostRequest{PostID: postID.String(), UserID: bobID, Content: "hi all"}))
+	page, err = repo.GetMentions(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now(), Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts, "editing re-resolves mentions")
+
+	_, err = repo.GetMentions(t.Context(), model.TimelineRequest{UserID: uuid.New().String(), Before: time.Now(), Limit: 10})
+	assert.Equal(t, model.ErrUserNotFound, err)
+}
+
+func TestMemoryNotifications(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "hello"})
+	require.NoError(t, err)
+
+	followTestUser(t, repo, bobID, aliceID)
+	followTestUser(t, repo, bobID, aliceID) // following twice does not notify twice
+	likeTestPost(t, repo, bobID, postID.String())
+	likeTestPost(t, repo, carolID, postID.String())
+	likeTestPost(t, repo, aliceID, postID.String()) // own likes are not notified
+
+	groups, err := repo.GetNotifications(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, model.NotificationLike, groups[0].Type)
+	assert.Equal(t, 2, groups[0].ActorCount)
+	assert.Equal(t, []model.UserSummary{{ID: carolID, Name: "carol"}, {ID: bobID, Name: "bob"}}, groups[0].Actors)
+	assert.Equal(t, model.NotificationFollow, groups[1].Type)
+	unread, err := repo.CountUnreadNotifications(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, unread)
+
+	marked, err := repo.MarkNotificationsRead(t.Context(), aliceID, []string{groups[0].ID})
+	require.NoError(t, err)
+	assert.Equal(t, 2, marked)
+	unread, err = repo.CountUnreadNotifications(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, unread)
+
+	_, err = repo.UnlikePost(t.Context(), carolID, postID.String())
+	require.NoError(t, err)
+	require.NoError(t, repo.UnfollowUser(t.Context(), bobID, aliceID))
+	groups, err = repo.GetNotifications(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, groups, 1, "undone events are retracted")
+	assert.Equal(t, 1, groups[0].ActorCount)
+	assert.True(t, groups[0].Read)
+
+	marked, err = repo.MarkNotificationsRead(t.Context(), aliceID, nil)
+	require.NoError(t, err)
+	assert.Zero(t, marked)
+
+	require.NoError(t, repo.BlockUser(t.Context(), aliceID, carolID))
+	likeTestPost(t, repo, carolID, postID.String())
+	unread, err = repo.CountUnreadNotifications(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Zero(t, unread, "likes of blocked users are not notified")
+}
+
+func TestMemoryBlocksAndMutes(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	followTestUser(t, repo, aliceID, bobID)
+	followTestUser(t, repo, bobID, aliceID)
+	followTestUser(t, repo, aliceID, carolID)
+	_, err := repo.Save(t.Context(), &model.Post{UserID: carolID, Content: "from carol"})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.BlockUser(t.Context(), aliceID, bobID))
+	require.NoError(t, repo.BlockUser(t.Context(), aliceID, bobID), "blocking twice is a no-op")
+	followers, err := repo.FollowersAmong(t.Context(), aliceID, []string{bobID})
+	require.NoError(t, err)
+	assert.Empty(t, followers, "blocking removes the follows in both directions")
+	followers, err = repo.FollowersAmong(t.Context(), bobID, []string{aliceID})
+	require.NoError(t, err)
+	assert.Empty(t, followers)
+	_, _, err = repo.FollowUser(t.Context(), bobID, aliceID)
+	assert.Equal(t, model.ErrUserBlocked, err)
+	blocked, err := repo.Blocked(t.Context(), bobID, aliceID)
+	require.NoError(t, err)
+	assert.True(t, blocked)
+
+	_, err = repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "hi @alice", Mentions: model.Mentions{{Offset: 3, Length: 6, Username: "alice"}}})
+	require.NoError(t, err)
+	unread, err := repo.CountUnreadNotifications(t.Context(), aliceID)
+	require.NoError(t, err)
+	assert.Zero(t, unread, "the follow of bob is retracted and mentions by blocked users are not notified")
+
+	require.NoError(t, repo.MuteUser(t.Context(), aliceID, carolID))
+	page, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts, "muted users are hidden from the timeline")
+	followees, err := repo.GetFollowees(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: carolID, Name: "carol"}}, followees.Users, "muting keeps the follow")
+	followers, err = repo.FollowersAmong(t.Context(), carolID, []string{aliceID})
+	require.NoError(t, err)
+	assert.Empty(t, followers, "the live timeline of the muter skips the muted user")
+
+	list, err := repo.GetBlockedUsers(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: bobID, Name: "bob"}}, list.Users)
+	list, err = repo.GetMutedUsers(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: carolID, Name: "carol"}}, list.Users)
+
+	require.NoError(t, repo.UnmuteUser(t.Context(), aliceID, carolID))
+	page, err = repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: aliceID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 1)
+	require.NoError(t, repo.UnblockUser(t.Context(), aliceID, bobID))
+	followTestUser(t, repo, bobID, aliceID)
+
+	assert.Equal(t, model.ErrUserNotFound, repo.BlockUser(t.Context(), aliceID, uuid.New().String()))
+}
+
+func TestMemoryPrivateAccounts(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID, err := repo.CreateUser(t.Context(), model.CreateUserRequest{Name: "alice", Email: "alice@example.com", Password: "hash", IsPrivate: true})
+	require.NoError(t, err)
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID.String(), Content: "private"})
+	require.NoError(t, err)
+
+	state, _, err := repo.FollowUser(t.Context(), bobID, aliceID.String())
+	require.NoError(t, err)
+	assert.Equal(t, model.FollowPending, state)
+	visible, err := repo.CanViewPosts(t.Context(), bobID, aliceID.String())
+	require.NoError(t, err)
+	assert.False(t, visible, "pending followers do not see the posts")
+	_, err = repo.LikePost(t.Context(), bobID, postID.String())
+	assert.Equal(t, model.ErrPostNotFound, err)
+	parentID := postID.String()
+	_, err = repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "reply", InReplyTo: &parentID})
+	assert.Equal(t, model.ErrParentNotFound, err)
+	unread, err := repo.CountUnreadNotifications(t.Context(), aliceID.String())
+	require.NoError(t, err)
+	assert.Zero(t, unread, "the like and the reply were not recorded")
+	requests, err := repo.GetFollowRequests(t.Context(), model.FollowListRequest{UserID: aliceID.String(), Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: bobID, Name: "bob"}}, requests.Users)
+
+	require.NoError(t, repo.ApproveFollowRequest(t.Context(), aliceID.String(), bobID))
+	assert.Equal(t, model.ErrNoFollowRequest, repo.ApproveFollowRequest(t.Context(), aliceID.String(), bobID))
+	visible, err = repo.CanViewPosts(t.Context(), bobID, aliceID.String())
+	require.NoError(t, err)
+	assert.True(t, visible)
+	likeTestPost(t, repo, bobID, postID.String())
+
+	// bob shares the private post with carol, who does not follow alice
+	original := postID.String()
+	_, err = repo.Save(t.Context(), &model.Post{UserID: bobID, Kind: model.PostKindRepost, RepostOf: &original})
+	require.NoError(t, err)
+	followTestUser(t, repo, carolID, bobID)
+	page, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: carolID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts, "reposts of private accounts are hidden from non-followers")
+	page, err = repo.GetUserPosts(t.Context(), model.TimelineRequest{UserID: bobID, ViewerID: carolID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts)
+
+	state, _, err = repo.FollowUser(t.Context(), carolID, aliceID.String())
+	require.NoError(t, err)
+	assert.Equal(t, model.FollowPending, state)
+	require.NoError(t, repo.SetPrivate(t.Context(), aliceID.String(), false))
+	page, err = repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: carolID, Before: time.Now().Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 1, "going public approves the pending requests")
+	profile, err := repo.GetUserProfile(t.Context(), aliceID.String())
+	require.NoError(t, err)
+	assert.False(t, profile.IsPrivate)
+	assert.Equal(t, 2, profile.FollowerCount)
+}
+
+func TestMemoryReadersAmong(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID, err := repo.CreateUser(t.Context(), model.CreateUserRequest{Name: "alice", Email: "alice@example.com", Password: "hash", IsPrivate: true})
+	require.NoError(t, err)
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	daveID := createTestUser(t, repo, "dave")
+	_, _, err = repo.FollowUser(t.Context(), bobID, aliceID.String())
+	require.NoError(t, err)
+	require.NoError(t, repo.ApproveFollowRequest(t.Context(), aliceID.String(), bobID))
+	_, _, err = repo.FollowUser(t.Context(), daveID, aliceID.String())
+	require.NoError(t, err)
+	require.NoError(t, repo.ApproveFollowRequest(t.Context(), aliceID.String(), daveID))
+	require.NoError(t, repo.MuteUser(t.Context(), daveID, aliceID.String()))
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID.String(), Content: "hello"})
+	require.NoError(t, err)
+
+	readers, err := repo.ReadersAmong(t.Context(), postID.String(), []string{aliceID.String(), bobID, carolID, daveID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{aliceID.String(), bobID}, readers, "non-followers of private accounts and muters are left out")
+}
+
+func TestMemoryPrivateFeeds(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID, err := repo.CreateUser(t.Context(), model.CreateUserRequest{Name: "carol", Email: "carol@example.com", Password: "hash", IsPrivate: true})
+	require.NoError(t, err)
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: carolID.String(), Content: "#go @alice", Hashtags: []string{"go"}, Mentions: model.Mentions{
+		{Offset: 4, Length: 6, Username: "alice"},
+	}})
+	require.NoError(t, err)
+	before := time.Now().Add(time.Hour)
+
+	t.Run("non_followers_get_nothing", func(t *testing.T) {
+		page, err := repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: bobID, Before: before, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, page.Posts)
+		page, err = repo.GetMentions(t.Context(), model.TimelineRequest{UserID: aliceID, Before: before, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, page.Posts, "being mentioned by a private account does not reveal the post")
+	})
+
+	t.Run("followers_read_the_post", func(t *testing.T) {
+		_, _, err := repo.FollowUser(t.Context(), aliceID, carolID.String())
+		require.NoError(t, err)
+		require.NoError(t, repo.ApproveFollowRequest(t.Context(), carolID.String(), aliceID))
+		page, err := repo.GetMentions(t.Context(), model.TimelineRequest{UserID: aliceID, Before: before, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, page.Posts, 1)
+		assert.Equal(t, postID.String(), page.Posts[0].ID)
+		page, err = repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: aliceID, Before: before, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, page.Posts, 1)
+	})
+
+	t.Run("muted_authors_are_hidden", func(t *testing.T) {
+		require.NoError(t, repo.MuteUser(t.Context(), aliceID, carolID.String()))
+		page, err := repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: aliceID, Before: before, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, page.Posts)
+		page, err = repo.GetMentions(t.Context(), model.TimelineRequest{UserID: aliceID, Before: before, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, page.Posts)
+	})
+}
+
+func TestMemoryPostRevisions(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "first"})
+	require.NoError(t, err)
+	created, err := repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.False(t, created.Edited)
+
+	for _, content := range []string{"second", "third"} {
+		require.NoError(t, repo.UpdatePostPut(t.Context(), model.CreatePostRequest{PostID: postID.String(), UserID: aliceID, Content: content}))
+	}
+
+	post, err := repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "third", post.Content)
+	assert.True(t, post.Edited)
+	assert.Equal(t, 2, post.EditCount)
+	revisions, err := repo.GetPostRevisions(t.Context(), postID.String())
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, model.PostRevision{PostID: postID.String(), Revision: 1, Content: "first", CreatedAt: created.CreatedAt}, revisions[0])
+	assert.Equal(t, "second", revisions[1].Content)
+	assert.True(t, revisions[1].CreatedAt.After(revisions[0].CreatedAt))
+}
+
+func TestMemoryPatchPost(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "first"})
+	require.NoError(t, err)
+	warning, empty, content := "spoilers", "", "second"
+
+	version, err := repo.PatchPost(t.Context(), model.PatchPostRequest{PostID: postID.String(), UserID: aliceID, ContentWarning: &warning, Versions: []int{1}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	post, err := repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, &warning, post.ContentWarning)
+	assert.False(t, post.Edited, "a content warning does not edit the content")
+
+	_, err = repo.PatchPost(t.Context(), model.PatchPostRequest{PostID: postID.String(), UserID: aliceID, Content: &content, Versions: []int{1}})
+	assert.Equal(t, model.ErrVersionMismatch, err)
+	version, err = repo.PatchPost(t.Context(), model.PatchPostRequest{PostID: postID.String(), UserID: aliceID, Content: &content, ContentWarning: &empty})
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	post, err = repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "second", post.Content)
+	assert.Nil(t, post.ContentWarning)
+	assert.Equal(t, 1, post.EditCount)
+	revisions, err := repo.GetPostRevisions(t.Context(), postID.String())
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, post.CreatedAt, revisions[0].CreatedAt, "the warning patch did not write the first content")
+
+	_, err = repo.PatchPost(t.Context(), model.PatchPostRequest{PostID: postID.String(), UserID: createTestUser(t, repo, "bob"), Content: &content})
+	assert.Equal(t, model.ErrPostNotFound, err)
+}
+
+func TestMemoryWithTx(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: bobID, Content: "Hello"})
+	require.NoError(t, err)
+	errWork := errors.New("work failed")
+
+	err = repo.WithTx(t.Context(), func(tx PostRepository) error {
+		followTestUser(t, tx, aliceID, bobID)
+		likeTestPost(t, tx, aliceID, postID.String())
+		// a nested unit of work joins the outer one
+		return tx.WithTx(t.Context(), func(tx PostRepository) error {
+			require.NoError(t, tx.UpdatePostPut(t.Context(), model.CreatePostRequest{PostID: postID.String(), UserID: bobID, Content: "Edited"}))
+			return errWork
+		})
+	})
+	assert.ErrorIs(t, err, errWork)
+	post, err := repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", post.Content)
+	assert.Zero(t, post.LikeCount)
+	assert.Zero(t, post.EditCount)
+	followees, err := repo.GetFollowees(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, followees.Users)
+	unread, err := repo.CountUnreadNotifications(t.Context(), bobID)
+	require.NoError(t, err)
+	assert.Zero(t, unread)
+
+	require.NoError(t, repo.WithTx(t.Context(), func(tx PostRepository) error {
+		followTestUser(t, tx, aliceID, bobID)
+		_, err := tx.LikePost(t.Context(), aliceID, postID.String())
+		return err
+	}))
+	post, err = repo.GetPost(t.Context(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, 1, post.LikeCount)
+	followees, err = repo.GetFollowees(t.Context(), model.FollowListRequest{UserID: aliceID, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, followees.Users, 1)
+}
+
+func TestMemoryBlockersAreHidden(t *testing.T) {
+	repo := newTestMemoryRepo()
+	aliceID := createTestUser(t, repo, "alice")
+	bobID := createTestUser(t, repo, "bob")
+	carolID := createTestUser(t, repo, "carol")
+	followTestUser(t, repo, bobID, carolID)
+	postID, err := repo.Save(t.Context(), &model.Post{UserID: aliceID, Content: "#go", Hashtags: []string{"go"}})
+	require.NoError(t, err)
+	original := postID.String()
+	_, err = repo.Save(t.Context(), &model.Post{UserID: carolID, Kind: model.PostKindRepost, RepostOf: &original})
+	require.NoError(t, err)
+	before := time.Now().Add(time.Hour)
+
+	// alice blocks bob, who still reads her posts through carol and the hashtag feed until then
+	page, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: bobID, Before: before, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Posts, 1)
+	require.NoError(t, repo.BlockUser(t.Context(), aliceID, bobID))
+
+	page, err = repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: bobID, Before: before, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts, "reposts of a user who blocked the reader are hidden")
+	page, err = repo.GetHashtagPosts(t.Context(), "go", model.TimelineRequest{UserID: bobID, Before: before, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Posts)
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/lib/pq"
+)
+
+// Notifications are written in the transaction of the event they report. Repeating an event is
+// a no-op thanks to the unique (user_id, type, actor_id, post_id) key, and undoing it (unlike,
+// unfollow) retracts its notification so that doing it again notifies again.
+
+// notifyUser records a notification of type kind for recipientID, users are never notified of
+// their own actions
+func (r *DBConnector) notifyUser(ctx context.Context, kind, recipientID, actorID string, at time.Time) error {
+	if recipientID == actorID {
+		return nil
+	}
+	const insertQuery = `
+		INSERT INTO notifications (user_id, actor_id, type, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := r.db().ExecContext(ctx, insertQuery, recipientID, actorID, kind, at); err != nil {
+		r.Logger.Sugar().Errorw("Error writing notification", "error", err, "type", kind, "user_id", recipientID)
+		return err
+	}
+	return nil
+}
+
+// notifyAuthor records a notification of type kind about postID for its author, unless actorID wrote it
+// or the author and actorID are blocking one another
+func (r *DBConnector) notifyAuthor(ctx context.Context, kind, actorID, postID string, at time.Time) error {
+	const insertQuery = `
+		INSERT INTO notifications (user_id, actor_id, type, post_id, created_at)
+		SELECT user_id, $1, $2, id, $3
+		FROM posts
+		WHERE id = $4 AND user_id <> $1
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = posts.user_id AND b.blocked_id = $1)
+			OR (b.blocker_id = $1 AND b.blocked_id = posts.user_id)
+		)
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := r.db().ExecContext(ctx, insertQuery, actorID, kind, at, postID); err != nil {
+		r.Logger.Sugar().Errorw("Error writing notification", "error", err, "type", kind, "post_id", postID)
+		return err
+	}
+	return nil
+}
+
+// notifyMentioned records a notification for every user mentioned by postID but its author and
+// the users blocking or blocked by the author
+func (r *DBConnector) notifyMentioned(ctx context.Context, authorID, postID string, at time.Time) error {
+	const insertQuery = `
+		INSERT INTO notifications (user_id, actor_id, type, post_id, created_at)
+		SELECT DISTINCT pm.user_id, $1, 'mention', pm.post_id, $2
+		FROM post_mentions pm
+		WHERE pm.post_id = $3 AND pm.user_id <> $1
+		AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = pm.user_id AND b.blocked_id = $1)
+			OR (b.blocker_id = $1 AND b.blocked_id = pm.user_id)
+		)
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := r.db().ExecContext(ctx, insertQuery, authorID, at, postID); err != nil {
+		r.Logger.Sugar().Errorw("Error writing mention notifications", "error", err, "post_id", postID)
+		return err
+	}
+	return nil
+}
+
+// notificationGroupRow is a model.NotificationGroup with its newest actors as read from postgres
+type notificationGroupRow struct {
+	model.NotificationGroup
+	ActorIDs   pq.StringArray `db:"actor_ids"`
+	ActorNames pq.StringArray `db:"actor_names"`
+}
+
+// GetNotifications returns a page of the notification groups of info.UserID, newest first.
+// Notifications about deleted posts are hidden.
+func (r *DBConnector) GetNotifications(ctx context.Context, info model.TimelineRequest) ([]model.NotificationGroup, error) {
+	var rows []notificationGroupRow
+	query := `
+		SELECT id, type, post_id, actor_count, read, created_at, actor_ids, actor_names FROM (
+			SELECT
+				(array_agg(n.id ORDER BY n.created_at DESC, n.id DESC))[1] AS id,
+				n.type,
+				n.post_id,
+				COUNT(*) AS actor_count,
+				n.read_at IS NOT NULL AS read,
+				MAX(n.created_at) AS created_at,
+				(array_agg(n.actor_id::text ORDER BY n.created_at DESC, n.id DESC))[1:3] AS actor_ids,
+				(array_agg(u.user_name ORDER BY n.created_at DESC, n.id DESC))[1:3] AS actor_names
+			FROM notifications n
+			JOIN users u ON u.id = n.actor_id
+			LEFT JOIN posts p ON p.id = n.post_id
+			WHERE n.user_id = $1
+			AND (n.post_id IS NULL OR p.deleted_at IS NULL)
+			GROUP BY n.type, n.post_id, n.read_at IS NOT NULL
+		) groups
+		WHERE (created_at, id) < ($2, $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+	err := r.db().SelectContext(ctx, &rows, query, info.UserID, info.Before, cursorPostID(info.BeforeID), info.Limit)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error getting notifications", "error", err, "user_id", info.UserID, "limit", info.Limit)
+		return nil, err
+	}
+
+	groups := make([]model.NotificationGroup, len(rows))
+	for i, row := range rows {
+		groups[i] = row.NotificationGroup
+		groups[i].Actors = make([]model.UserSummary, len(row.ActorIDs))
+		for j := range row.ActorIDs {
+			groups[i].Actors[j] = model.UserSummary{ID: row.ActorIDs[j], Name: row.ActorNames[j]}
+		}
+	}
+	return groups, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications of userID, not of groups
+func (r *DBConnector) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM notifications n
+		LEFT JOIN posts p ON p.id = n.post_id
+		WHERE n.user_id = $1
+		AND n.read_at IS NULL
+		AND (n.post_id IS NULL OR p.deleted_at IS NULL);
+	`
+	if err := r.db().GetContext(ctx, &count, query, userID); err != nil {
+		r.Logger.Sugar().Errorw("Error counting unread notifications", "error", err, "user_id", userID)
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkNotificationsRead marks the groups whose newest notification is in ids as read, up to that
+// notification so that newer events stay unread. Every notification is marked when ids is empty.
+// It returns the number of notifications marked.
+func (r *DBConnector) MarkNotificationsRead(ctx context.Context, userID string, ids []string) (int, error) {
+	now := time.Now().UTC()
+	var (
+		query string
+		args  []interface{}
+	)
+	if len(ids) == 0 {
+		query = `UPDATE notifications SET read_at = $2 WHERE user_id = $1 AND read_at IS NULL;`
+		args = []interface{}{userID, now}
+	} else {
+		query = `
+			UPDATE notifications n
+			SET read_at = $2
+			FROM notifications g
+			WHERE g.user_id = $1
+			AND g.id = ANY($3::uuid[])
+			AND n.user_id = $1
+			AND n.type = g.type
+			AND n.post_id IS NOT DISTINCT FROM g.post_id
+			AND n.created_at <= g.created_at
+			AND n.read_at IS NULL;
+		`
+		args = []interface{}{userID, now, pq.Array(ids)}
+	}
+
+	result, err := r.db().ExecContext(ctx, query, args...)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error marking notifications read", "error", err, "user_id", userID)
+		return 0, err
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	r.Logger.Sugar().Infow("Notifications marked read", "user_id", userID, "marked", marked)
+	return int(marked), nil
+}
+
+// retractNotification deletes the notification of an undone event about postID
+func (r *DBConnector) retractNotification(ctx context.Context, kind, actorID, postID string) error {
+	const deleteQuery = `DELETE FROM notifications WHERE type = $1 AND actor_id = $2 AND post_id = $3;`
+	if _, err := r.db().ExecContext(ctx, deleteQuery, kind, actorID, postID); err != nil {
+		r.Logger.Sugar().Errorw("Error retracting notification", "error", err, "type", kind, "post_id", postID)
+		return err
+	}
+	return nil
+}
+
+// retractFollowNotification deletes the notification of a follow that was undone
+func (r *DBConnector) retractFollowNotification(ctx context.Context, followerID, followeeID string) error {
+	const deleteQuery = `DELETE FROM notifications WHERE type = 'follow' AND user_id = $1 AND actor_id = $2;`
+	if _, err := r.db().ExecContext(ctx, deleteQuery, followeeID, followerID); err != nil {
+		r.Logger.Sugar().Errorw("Error retracting follow notification", "error", err, "user_id", followeeID)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestGetNotifications(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+	userID := uuid.New().String()
+	postID := uuid.New().String()
+	groupID := uuid.New().String()
+
+	mock.ExpectQuery(`FROM notifications n JOIN users u ON u.id = n.actor_id .* GROUP BY n.type, n.post_id, n.read_at IS NOT NULL \) groups WHERE \(created_at, id\) < \(\$2, \$3\) ORDER BY created_at DESC, id DESC LIMIT \$4`).
+		WithArgs(userID, now, uuid.Nil.String(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "post_id", "actor_count", "read", "created_at", "actor_ids", "actor_names"}).
+			AddRow(groupID, model.NotificationLike, postID, 5, false, now, "{a1,a2,a3}", "{alice,bob,carol}"))
+
+	groups, err := repo.GetNotifications(t.Context(), model.TimelineRequest{UserID: userID, Before: now, Limit: 10})
+
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, groupID, groups[0].ID)
+	assert.Equal(t, 5, groups[0].ActorCount)
+	assert.Equal(t, []model.UserSummary{{ID: "a1", Name: "alice"}, {ID: "a2", Name: "bob"}, {ID: "a3", Name: "carol"}}, groups[0].Actors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	userID := uuid.New().String()
+
+	t.Run("all", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+		mock.ExpectExec(`UPDATE notifications SET read_at = \$2 WHERE user_id = \$1 AND read_at IS NULL`).
+			WithArgs(userID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 7))
+
+		marked, err := repo.MarkNotificationsRead(t.Context(), userID, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 7, marked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		defer db.Close()
+		repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+		ids := []string{uuid.New().String()}
+
+		mock.ExpectExec(`UPDATE notifications n SET read_at = \$2 FROM notifications g WHERE g.user_id = \$1 AND g.id = ANY\(\$3::uuid\[\]\) .* AND n.created_at <= g.created_at AND n.read_at IS NULL`).
+			WithArgs(userID, sqlmock.AnyArg(), pq.Array(ids)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		marked, err := repo.MarkNotificationsRead(t.Context(), userID, ids)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, marked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSaveReplyNotifiesParentAuthor(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	parentID := uuid.New().String()
+
+	mock.ExpectQuery(readablePostQuery).
+		WithArgs("user-id-123", parentID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec(`INSERT INTO notifications \(user_id, actor_id, type, post_id, created_at\) SELECT user_id, \$1, \$2, id, \$3 FROM posts`).
+		WithArgs("user-id-123", model.NotificationReply, sqlmock.AnyArg(), parentID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET last_post_id`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err := repo.Save(t.Context(), &model.Post{UserID: "user-id-123", Content: "me too", InReplyTo: &parentID})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
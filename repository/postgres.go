@@ -1,13 +1,19 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"microblogging/model"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
@@ -15,35 +21,90 @@ import (
 type DBConnector struct {
 	DB     *sqlx.DB
 	Logger *zap.Logger
+	// Fanout enables fan-out-on-write of the home timeline, timelines are built on read when nil
+	Fanout *FanoutWorker
+	// unit is set on the connector a WithTx call hands to its function
+	unit *unitOfWork
 }
 
-func (r *DBConnector) NewPostRepository() PostRepository {
-	return &postRepo{db: r.DB, logger: r.Logger}
-}
-
-func (r *DBConnector) Save(post *model.Post) (uuid.UUID, error) {
+// Save inserts a post. Replies need a live parent, reposts and quotes a live shared post, and a
+// user can only repost a post once.
+func (r *DBConnector) Save(ctx context.Context, post *model.Post) (uuid.UUID, error) {
 	var postID uuid.UUID
 	now := time.Now().UTC()
 
+	if post.InReplyTo != nil {
+		if err := r.existReadablePost(ctx, post.UserID, *post.InReplyTo); err != nil {
+			if errors.Is(err, model.ErrPostNotFound) {
+				return uuid.Nil, model.ErrParentNotFound
+			}
+			return uuid.Nil, err
+		}
+	}
+	kind := post.Kind
+	if kind == "" {
+		kind = model.PostKindPost
+	}
+	if post.RepostOf != nil {
+		if err := r.existLivePost(ctx, *post.RepostOf); err != nil {
+			if errors.Is(err, model.ErrPostNotFound) {
+				return uuid.Nil, model.ErrSharedPostNotFound
+			}
+			return uuid.Nil, err
+		}
+	}
+	if kind == model.PostKindRepost {
+		if err := r.notReposted(ctx, post.UserID, *post.RepostOf); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
 	const insertQuery = `
-		INSERT INTO posts (user_id, content, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO posts (user_id, content, created_at, updated_at, content_updated_at, in_reply_to, kind, repost_of)
+		VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
 		RETURNING id;
 	`
-
-	err := r.DB.QueryRow(insertQuery, post.UserID, post.Content, now, now).Scan(&postID)
+	err := r.withTx(ctx, func(tx *DBConnector) error {
+		err := tx.db().QueryRowContext(ctx, insertQuery, post.UserID, post.Content, now, now, post.InReplyTo, kind, post.RepostOf).Scan(&postID)
+		if err != nil {
+			r.Logger.Error("Error inserting post", zap.Error(err))
+			return err
+		}
+		if err := tx.indexHashtags(ctx, postID, now, post.Hashtags); err != nil {
+			return err
+		}
+		if err := tx.indexMentions(ctx, postID, post.Mentions); err != nil {
+			return err
+		}
+		if post.InReplyTo != nil {
+			if err := tx.notifyAuthor(ctx, model.NotificationReply, post.UserID, *post.InReplyTo, now); err != nil {
+				return err
+			}
+		}
+		if len(post.Mentions) > 0 {
+			if err := tx.notifyMentioned(ctx, post.UserID, postID.String(), now); err != nil {
+				return err
+			}
+		}
+		if err := tx.updateUserLastPost(ctx, postID, post.UserID, now); err != nil {
+			return err
+		}
+		// the post is inserted with fanned_out = FALSE, which is the outbox entry of its fan-out
+		if r.Fanout != nil {
+			tx.afterCommit(func() { r.Fanout.enqueuePost(postID, post.UserID, now) })
+		}
+		return nil
+	})
 	if err != nil {
-		r.Logger.Error("Error inserting post", zap.Error(err))
 		return uuid.Nil, err
 	}
-	// Update the user's last post asynchronously
-	r.updateUserLastPostAsync(postID, post.UserID, now)
 
 	r.Logger.Sugar().Infow("Post saved", "post_id", postID.String())
 	return postID, nil
 }
 
-func (r *DBConnector) UpdatePostPut(post model.CreatePostRequest) error {
+// UpdatePostPut replaces the content of a post, the previous content is kept in post_revisions
+func (r *DBConnector) UpdatePostPut(ctx context.Context, post model.CreatePostRequest) error {
 	now := time.Now().UTC()
 	postUUID, err := uuid.Parse(post.PostID)
 	if err != nil {
@@ -51,69 +112,705 @@ func (r *DBConnector) UpdatePostPut(post model.CreatePostRequest) error {
 		return model.ErrInvalidUUID
 	}
 
-	if err := r.existPost(postUUID, post.UserID); err != nil {
+	if err := r.existPost(ctx, postUUID, post.UserID); err != nil {
 		return model.ErrPostNotFound
 	}
 
 	const updateQuery = `
 		UPDATE posts
-		SET content = $1, updated_at = $2
-		WHERE id = $3 AND user_id = $4;
+		SET content = $1, updated_at = $2, content_updated_at = $2, edit_count = edit_count + 1, version = version + 1
+		WHERE id = $3 AND user_id = $4
+		RETURNING created_at;
 	`
-	_, err = r.DB.Exec(updateQuery, post.Content, now, post.PostID, post.UserID)
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		if err := tx.saveRevision(ctx, postUUID, post.UserID); err != nil {
+			return err
+		}
+		var createdAt time.Time
+		if err := tx.db().QueryRowContext(ctx, updateQuery, post.Content, now, post.PostID, post.UserID).Scan(&createdAt); err != nil {
+			r.Logger.Error("Error updating post", zap.Error(err))
+			return err
+		}
+		return tx.reindexContent(ctx, postUUID, post.UserID, createdAt, post.Hashtags, post.Mentions, now)
+	})
 	if err != nil {
-		r.Logger.Error("Error updating post", zap.Error(err))
 		return err
 	}
 
-	// Update the user's last post asynchronously
-	r.updateUserLastPostAsync(postUUID, post.UserID, now)
 	r.Logger.Sugar().Infow("Post updated", "post_id", post.PostID)
-	return err
+	return nil
+}
+
+// PatchPost applies the fields set in post to a post of post.UserID and returns its new version.
+// When post.Versions is set and the current version is not one of them, ErrVersionMismatch is
+// returned.
+func (r *DBConnector) PatchPost(ctx context.Context, post model.PatchPostRequest) (int, error) {
+	now := time.Now().UTC()
+	postUUID, err := uuid.Parse(post.PostID)
+	if err != nil {
+		r.Logger.Error("Invalid post_id UUID", zap.Error(err))
+		return 0, model.ErrInvalidUUID
+	}
+
+	// the row stays locked until the transaction ends, its version cannot change before the update
+	const lockQuery = `SELECT version FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE;`
+	var version int
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		if err := tx.db().QueryRowContext(ctx, lockQuery, postUUID, post.UserID).Scan(&version); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrPostNotFound
+			}
+			r.Logger.Error("Error locking post", zap.Error(err))
+			return err
+		}
+		if len(post.Versions) > 0 && !slices.Contains(post.Versions, version) {
+			return model.ErrVersionMismatch
+		}
+
+		sets := []string{"updated_at = $3", "version = version + 1"}
+		args := []interface{}{postUUID, post.UserID, now}
+		if post.Content != nil {
+			if err := tx.saveRevision(ctx, postUUID, post.UserID); err != nil {
+				return err
+			}
+			args = append(args, *post.Content)
+			sets = append(sets, fmt.Sprintf("content = $%d", len(args)), "content_updated_at = $3", "edit_count = edit_count + 1")
+		}
+		if post.ContentWarning != nil {
+			args = append(args, *post.ContentWarning)
+			sets = append(sets, fmt.Sprintf("content_warning = NULLIF($%d, '')", len(args)))
+		}
+		updateQuery := fmt.Sprintf(`
+			UPDATE posts
+			SET %s
+			WHERE id = $1 AND user_id = $2
+			RETURNING version, created_at;
+		`, strings.Join(sets, ", "))
+		var createdAt time.Time
+		if err := tx.db().QueryRowContext(ctx, updateQuery, args...).Scan(&version, &createdAt); err != nil {
+			r.Logger.Error("Error patching post", zap.Error(err))
+			return err
+		}
+		if post.Content == nil {
+			return nil
+		}
+		return tx.reindexContent(ctx, postUUID, post.UserID, createdAt, post.Hashtags, post.Mentions, now)
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.Logger.Sugar().Infow("Post patched", "post_id", post.PostID, "version", version)
+	return version, nil
+}
+
+// reindexContent replaces the hashtags and mentions of a post whose content changed
+func (r *DBConnector) reindexContent(ctx context.Context, postID uuid.UUID, userID string, createdAt time.Time, hashtags []string, mentions []model.Mention, now time.Time) error {
+	// the new content replaces every tag and mention of the previous one
+	const clearTagsQuery = `DELETE FROM post_hashtags WHERE post_id = $1;`
+	if _, err := r.db().ExecContext(ctx, clearTagsQuery, postID); err != nil {
+		r.Logger.Error("Error clearing post hashtags", zap.Error(err))
+		return err
+	}
+	if err := r.indexHashtags(ctx, postID, createdAt, hashtags); err != nil {
+		return err
+	}
+	const clearMentionsQuery = `DELETE FROM post_mentions WHERE post_id = $1;`
+	if _, err := r.db().ExecContext(ctx, clearMentionsQuery, postID); err != nil {
+		r.Logger.Error("Error clearing post mentions", zap.Error(err))
+		return err
+	}
+	if err := r.indexMentions(ctx, postID, mentions); err != nil {
+		return err
+	}
+	// users mentioned before the edit were already notified
+	if len(mentions) > 0 {
+		if err := r.notifyMentioned(ctx, userID, postID.String(), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePost soft deletes a post by setting deleted_at. When it was the author's latest post,
+// users.last_post_id is recomputed in the same transaction.
+func (r *DBConnector) DeletePost(ctx context.Context, postID, userID string) error {
+	now := time.Now().UTC()
+	postUUID, err := uuid.Parse(postID)
+	if err != nil {
+		r.Logger.Error("Invalid post_id UUID", zap.Error(err))
+		return model.ErrInvalidUUID
+	}
+
+	if err := r.existPost(ctx, postUUID, userID); err != nil {
+		return err
+	}
+
+	const deleteQuery = `
+		UPDATE posts
+		SET deleted_at = $1, updated_at = $1
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL;
+	`
+	const recomputeLastPostQuery = `
+		UPDATE users
+		SET last_post_id = (
+			SELECT id FROM posts
+			WHERE user_id = $1 AND deleted_at IS NULL
+			ORDER BY created_at DESC
+			LIMIT 1
+		), updated_at = $2
+		WHERE id = $1 AND last_post_id = $3;
+	`
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		if _, err := tx.db().ExecContext(ctx, deleteQuery, now, postUUID, userID); err != nil {
+			r.Logger.Error("Error deleting post", zap.Error(err))
+			return err
+		}
+		if _, err := tx.db().ExecContext(ctx, recomputeLastPostQuery, userID, now, postUUID); err != nil {
+			r.Logger.Error("Error recomputing user's last_post_id", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Logger.Sugar().Infow("Post deleted", "post_id", postID, "user_id", userID)
+	return nil
+}
+
+// LikePost records that userID likes postID and reports whether the like is new. Liking twice is
+// a no-op, posts.like_count is only incremented when a new like row is inserted.
+func (r *DBConnector) LikePost(ctx context.Context, userID, postID string) (bool, error) {
+	return r.updateLike(ctx, userID, postID, true)
+}
+
+// UnlikePost removes the like of userID on postID and reports whether there was one, unliking a
+// post that was not liked is a no-op
+func (r *DBConnector) UnlikePost(ctx context.Context, userID, postID string) (bool, error) {
+	return r.updateLike(ctx, userID, postID, false)
+}
+
+// updateLike adds or removes the like of userID on postID and reports whether that changed a row.
+// When it did, posts.like_count and the notification of the author are updated in the same transaction.
+func (r *DBConnector) updateLike(ctx context.Context, userID, postID string, liked bool) (bool, error) {
+	if _, err := uuid.Parse(postID); err != nil {
+		r.Logger.Error("Invalid post_id UUID", zap.Error(err))
+		return false, model.ErrInvalidUUID
+	}
+	// a post can only be liked by the users who may read it, a like is removed whatever the post became
+	var err error
+	if liked {
+		err = r.existReadablePost(ctx, userID, postID)
+	} else {
+		err = r.existLivePost(ctx, postID)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	delta := 1
+	var changed int64
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		var (
+			res sql.Result
+			err error
+		)
+		if liked {
+			const likeQuery = `
+				INSERT INTO likes (user_id, post_id, created_at)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (user_id, post_id) DO NOTHING;
+			`
+			res, err = tx.db().ExecContext(ctx, likeQuery, userID, postID, now)
+		} else {
+			const unlikeQuery = `DELETE FROM likes WHERE user_id = $1 AND post_id = $2;`
+			delta = -1
+			res, err = tx.db().ExecContext(ctx, unlikeQuery, userID, postID)
+		}
+		if err != nil {
+			r.Logger.Sugar().Errorw("Error updating like", "error", err, "post_id", postID)
+			return err
+		}
+		if changed, err = res.RowsAffected(); err != nil || changed == 0 {
+			return err
+		}
+		const countQuery = `UPDATE posts SET like_count = like_count + $1 WHERE id = $2;`
+		if _, err := tx.db().ExecContext(ctx, countQuery, delta, postID); err != nil {
+			r.Logger.Error("Error updating like_count", zap.Error(err))
+			return err
+		}
+		if liked {
+			return tx.notifyAuthor(ctx, model.NotificationLike, userID, postID, now)
+		}
+		return tx.retractNotification(ctx, model.NotificationLike, userID, postID)
+	})
+	if err != nil {
+		return false, err
+	}
+	r.Logger.Sugar().Infow("Like updated", "post_id", postID, "delta", delta, "changed", changed > 0)
+	return changed > 0, nil
+}
+
+// mentionsAgg aggregates rows of post_mentions into the JSON array scanned by model.Mentions
+const mentionsAgg = `SELECT json_agg(json_build_object('offset', pm.char_offset, 'length', pm.char_length, 'user_id', pm.user_id) ORDER BY pm.char_offset)
+	FROM post_mentions pm`
+
+// postMentionsColumn reads the mentions of the posts table when it is not aliased
+const postMentionsColumn = `COALESCE((` + mentionsAgg + ` WHERE pm.post_id = posts.id), '[]') AS mentions`
+
+// timelineColumns are the post columns read by timelines, $1 is the reader
+const timelineColumns = `p.id, p.user_id, p.content, p.created_at, p.updated_at, p.in_reply_to, p.like_count,
+	p.edited, p.edit_count, p.content_warning, p.version,
+	EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = $1) AS liked_by_viewer, p.kind, p.repost_of,
+	COALESCE((` + mentionsAgg + ` WHERE pm.post_id = p.id), '[]') AS mentions`
+
+// timelineDedup keeps a single entry per shared post: an entry is dropped when an active followee of $1
+// reposted the same post later and that repost is shown to $1, and reposts of deleted posts are dropped.
+var timelineDedup = `
+	AND NOT EXISTS (
+		SELECT 1 FROM posts n
+		JOIN follows nf ON nf.followee_id = n.user_id AND nf.follower_id = $1 AND nf.is_active = TRUE
+		WHERE n.kind = 'repost'
+		AND n.deleted_at IS NULL
+		AND n.repost_of = CASE WHEN p.kind = 'repost' THEN p.repost_of ELSE p.id END
+		AND (n.created_at, n.id) > (p.created_at, p.id)` + hiddenFrom("n", "$1") + privateShared("n", "$1") + `
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM posts o
+		WHERE p.kind = 'repost' AND o.id = p.repost_of AND o.deleted_at IS NOT NULL
+	)`
+
+// hiddenFrom drops the posts, aliased post, of the users reader blocked or muted and of the users
+// who blocked reader, and the reposts and quotes of their posts. reader is the placeholder of the reader.
+func hiddenFrom(post, reader string) string {
+	hiddenUsers := fmt.Sprintf(`
+		SELECT blocked_id FROM blocks WHERE blocker_id = %[1]s
+		UNION ALL
+		SELECT blocker_id FROM blocks WHERE blocked_id = %[1]s
+		UNION ALL
+		SELECT muted_id FROM mutes WHERE muter_id = %[1]s`, reader)
+	return fmt.Sprintf(`
+	AND NOT EXISTS (
+		SELECT 1 FROM posts o
+		WHERE o.id = COALESCE(%[1]s.repost_of, %[1]s.id)
+		AND o.user_id IN (%[2]s
+		)
+	)
+	AND %[1]s.user_id NOT IN (%[2]s
+	)`, post, hiddenUsers)
 }
 
-func (r *DBConnector) GetTimeline(info model.TimelineRequest) (model.TimelineResponse, error) {
+// timelineHidden is hiddenFrom for the timeline queries, $1 is the reader
+var timelineHidden = hiddenFrom("p", "$1")
+
+// GetTimeline returns the posts, reposts and quotes of the users info.UserID follows.
+// Reposts and quotes come with the shared post in Original.
+func (r *DBConnector) GetTimeline(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	if r.Fanout != nil {
+		return r.getHomeTimeline(ctx, info)
+	}
+	if info.Since() {
+		return r.getTimelineSince(ctx, info)
+	}
+
 	var posts model.TimelineResponse
-	// if info.Before is not set, it previously used a default value of 3 days from now
 	query := `
-		SELECT p.id, p.user_id, p.content, p.created_at
+		SELECT ` + timelineColumns + `
 		FROM posts p
 		JOIN follows f ON f.followee_id = p.user_id
 		WHERE f.follower_id = $1
 	    AND f.is_active = TRUE
-		AND p.created_at < $2
-		ORDER BY p.created_at DESC
-		LIMIT $3
+		AND p.deleted_at IS NULL` + timelineDedup + timelineHidden + timelinePrivate + `
+		AND (p.created_at, p.id) < ($2, $3)
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $4
 	`
-	err := r.DB.Select(&posts.Posts, query, info.UserID, info.Before, info.Limit)
+	err := r.db().SelectContext(ctx, &posts.Posts, query, info.UserID, info.Before, cursorPostID(info.BeforeID), info.Limit)
 
 	if err != nil {
 		r.Logger.Sugar().Errorw("Error getting timeline", "error", err, "user_id", info.UserID, "before", info.Before, "limit", info.Limit)
 		return model.TimelineResponse{}, err
 	}
+	if err := r.attachOriginals(ctx, posts.Posts); err != nil {
+		return model.TimelineResponse{}, err
+	}
 	return posts, nil
 }
 
-func (r *DBConnector) FollowUser(followerID, followeeID string) error {
-	exists, err := r.checkUsers(followerID, followeeID)
-	if !exists {
+// getTimelineSince returns the timeline posts newer than (info.After, info.AfterID), oldest first
+func (r *DBConnector) getTimelineSince(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	var posts model.TimelineResponse
+	query := `
+		SELECT ` + timelineColumns + `
+		FROM posts p
+		JOIN follows f ON f.followee_id = p.user_id
+		WHERE f.follower_id = $1
+	    AND f.is_active = TRUE
+		AND p.deleted_at IS NULL` + timelineDedup + timelineHidden + timelinePrivate + `
+		AND (p.created_at, p.id) > ($2, $3)
+		ORDER BY p.created_at ASC, p.id ASC
+		LIMIT $4
+	`
+	err := r.db().SelectContext(ctx, &posts.Posts, query, info.UserID, info.After, sinceCursorPostID(info.AfterID), info.Limit)
+
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error polling timeline", "error", err, "user_id", info.UserID, "after", info.After, "limit", info.Limit)
+		return model.TimelineResponse{}, err
+	}
+	if err := r.attachOriginals(ctx, posts.Posts); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	return posts, nil
+}
+
+// getHomeTimeline reads the timeline materialized by the fan-out worker. Posts that were not fanned
+// out yet, or never will be because their author is a celebrity, are joined from posts on read.
+// A follow must still be active for its posts to show up, home_timeline rows are never removed.
+func (r *DBConnector) getHomeTimeline(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	op, order, at, postID := "<", "DESC", info.Before, cursorPostID(info.BeforeID)
+	if info.Since() {
+		op, order, at, postID = ">", "ASC", info.After, sinceCursorPostID(info.AfterID)
+	}
+
+	var posts model.TimelineResponse
+	query := fmt.Sprintf(`
+		SELECT id, user_id, content, created_at, updated_at, in_reply_to, like_count, edited, edit_count, content_warning, version, liked_by_viewer, kind, repost_of, mentions FROM (
+			(SELECT %[3]s
+			FROM home_timeline h
+			JOIN posts p ON p.id = h.post_id
+			JOIN follows f ON f.follower_id = h.user_id AND f.followee_id = p.user_id
+			WHERE h.user_id = $1
+			AND f.is_active = TRUE
+			AND p.deleted_at IS NULL%[4]s
+			AND (h.created_at, h.post_id) %[1]s ($2, $3)
+			ORDER BY h.created_at %[2]s, h.post_id %[2]s
+			LIMIT $4)
+			UNION ALL
+			(SELECT %[3]s
+			FROM posts p
+			JOIN follows f ON f.followee_id = p.user_id
+			WHERE f.follower_id = $1
+			AND f.is_active = TRUE
+			AND p.deleted_at IS NULL
+			AND p.fanned_out = FALSE%[4]s
+			AND (p.created_at, p.id) %[1]s ($2, $3)
+			ORDER BY p.created_at %[2]s, p.id %[2]s
+			LIMIT $4)
+		) timeline
+		ORDER BY created_at %[2]s, id %[2]s
+		LIMIT $4
+	`, op, order, timelineColumns, timelineDedup+timelineHidden+timelinePrivate)
+	err := r.db().SelectContext(ctx, &posts.Posts, query, info.UserID, at, postID, info.Limit)
+
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error getting home timeline", "error", err, "user_id", info.UserID, "limit", info.Limit)
+		return model.TimelineResponse{}, err
+	}
+	if err := r.attachOriginals(ctx, posts.Posts); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	return posts, nil
+}
+
+// attachOriginals loads the shared post of every repost and quote in posts into Original.
+// Deleted originals are kept as tombstones without content.
+func (r *DBConnector) attachOriginals(ctx context.Context, posts []model.Post) error {
+	var ids []string
+	for _, post := range posts {
+		if post.RepostOf != nil {
+			ids = append(ids, *post.RepostOf)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var originals []model.Post
+	query, args, err := sqlx.In(`
+		SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, `+postMentionsColumn+`
+		FROM posts
+		WHERE id IN (?)
+	`, ids)
+	if err != nil {
+		return err
+	}
+	if err := r.db().SelectContext(ctx, &originals, r.db().Rebind(query), args...); err != nil {
+		r.Logger.Sugar().Errorw("Error getting shared posts", "error", err, "post_ids", ids)
 		return err
 	}
 
+	byID := make(map[string]model.Post, len(originals))
+	for _, original := range originals {
+		if original.DeletedAt != nil {
+			original.Content = ""
+			original.ContentWarning = nil
+			original.Mentions = nil
+		}
+		byID[original.ID] = original
+	}
+	for i := range posts {
+		if posts[i].RepostOf == nil {
+			continue
+		}
+		if original, ok := byID[*posts[i].RepostOf]; ok {
+			posts[i].Original = &original
+		}
+	}
+	return nil
+}
+
+// GetPost returns a post by id, soft deleted posts are returned with deleted_at set
+func (r *DBConnector) GetPost(ctx context.Context, postID string) (model.Post, error) {
+	var post model.Post
+	query := `
+		SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, ` + postMentionsColumn + `
+		FROM posts
+		WHERE id = $1
+	`
+	if err := r.db().GetContext(ctx, &post, query, postID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Post{}, model.ErrPostNotFound
+		}
+		r.Logger.Sugar().Errorw("Error getting post", "error", err, "post_id", postID)
+		return model.Post{}, err
+	}
+	posts := []model.Post{post}
+	if err := r.attachOriginals(ctx, posts); err != nil {
+		return model.Post{}, err
+	}
+	return posts[0], nil
+}
+
+// threadColumns are the post columns read by threads, they are those of GetPost
+const threadColumns = `p.id, p.user_id, p.content, p.created_at, p.updated_at, p.deleted_at, p.in_reply_to, p.like_count,
+	p.edited, p.edit_count, p.content_warning, p.version, p.kind, p.repost_of,
+	COALESCE((` + mentionsAgg + ` WHERE pm.post_id = p.id), '[]') AS mentions`
+
+// GetAncestors returns the posts postID replies to that viewerID may read, from the conversation
+// root down to its parent. Deleted ancestors are kept so that the chain is not broken.
+func (r *DBConnector) GetAncestors(ctx context.Context, viewerID, postID string) ([]model.Post, error) {
+	var posts []model.Post
 	query := `
-		INSERT INTO follows (follower_id, followee_id) 
-		VALUES ($1, $2) 
+		WITH RECURSIVE ancestors AS (
+			SELECT p.id, p.in_reply_to, 1 AS depth
+			FROM posts p
+			JOIN posts child ON child.in_reply_to = p.id
+			WHERE child.id = $2
+			UNION ALL
+			SELECT p.id, p.in_reply_to, a.depth + 1
+			FROM posts p
+			JOIN ancestors a ON p.id = a.in_reply_to
+		)
+		SELECT ` + threadColumns + `
+		FROM ancestors a
+		JOIN posts p ON p.id = a.id
+		WHERE TRUE` + feedHidden + `
+		ORDER BY a.depth DESC
+	`
+	if err := r.db().SelectContext(ctx, &posts, query, viewerID, postID); err != nil {
+		r.Logger.Sugar().Errorw("Error getting post ancestors", "error", err, "post_id", postID)
+		return nil, err
+	}
+	if err := r.attachOriginals(ctx, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetReplies returns one page of the descendants of req.PostID that req.ViewerID may read, ordered
+// by (created_at, id). A reply is always created after its parent, so parents come before their replies.
+func (r *DBConnector) GetReplies(ctx context.Context, req model.ThreadRequest) ([]model.Post, error) {
+	var posts []model.Post
+	query := `
+		WITH RECURSIVE descendants AS (
+			SELECT id
+			FROM posts
+			WHERE in_reply_to = $2
+			UNION ALL
+			SELECT p.id
+			FROM posts p
+			JOIN descendants d ON p.in_reply_to = d.id
+		)
+		SELECT ` + threadColumns + `
+		FROM descendants d
+		JOIN posts p ON p.id = d.id
+		WHERE (p.created_at, p.id) > ($3, $4)` + feedHidden + `
+		ORDER BY p.created_at, p.id
+		LIMIT $5
+	`
+	err := r.db().SelectContext(ctx, &posts, query, req.ViewerID, req.PostID, req.After, sinceCursorPostID(req.AfterID), req.Limit)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error getting post replies", "error", err, "post_id", req.PostID, "limit", req.Limit)
+		return nil, err
+	}
+	if err := r.attachOriginals(ctx, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetUserPosts returns the posts written by info.UserID, newest first. Reposts and quotes of
+// private accounts info.ViewerID does not follow are left out.
+func (r *DBConnector) GetUserPosts(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	if _, err := r.existUser(ctx, info.UserID); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	viewerID := info.ViewerID
+	if viewerID == "" {
+		viewerID = info.UserID
+	}
+
+	var posts model.TimelineResponse
+	query := `
+		SELECT id, user_id, content, created_at, updated_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, ` + postMentionsColumn + `
+		FROM posts
+		WHERE user_id = $1
+		AND deleted_at IS NULL` + privateShared("posts", "$5") + `
+		AND (created_at, id) < ($2, $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+	err := r.db().SelectContext(ctx, &posts.Posts, query, info.UserID, info.Before, cursorPostID(info.BeforeID), info.Limit, viewerID)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error getting user posts", "error", err, "user_id", info.UserID, "before", info.Before, "limit", info.Limit)
+		return model.TimelineResponse{}, err
+	}
+	if err := r.attachOriginals(ctx, posts.Posts); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	return posts, nil
+}
+
+// GetHashtagPosts returns a page of the live posts tagged with tag that info.UserID may read, newest first
+func (r *DBConnector) GetHashtagPosts(ctx context.Context, tag string, info model.TimelineRequest) (model.TimelineResponse, error) {
+	var posts model.TimelineResponse
+	query := `
+		SELECT ` + timelineColumns + `
+		FROM post_hashtags h
+		JOIN posts p ON p.id = h.post_id
+		WHERE h.tag = $2
+		AND p.deleted_at IS NULL` + feedHidden + `
+		AND (h.created_at, h.post_id) < ($3, $4)
+		ORDER BY h.created_at DESC, h.post_id DESC
+		LIMIT $5
+	`
+	err := r.db().SelectContext(ctx, &posts.Posts, query, info.UserID, tag, info.Before, cursorPostID(info.BeforeID), info.Limit)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error getting hashtag posts", "error", err, "hashtag", tag, "before", info.Before, "limit", info.Limit)
+		return model.TimelineResponse{}, err
+	}
+	if err := r.attachOriginals(ctx, posts.Posts); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	return posts, nil
+}
+
+// GetMentions returns a page of the live posts mentioning info.UserID that info.ViewerID may read,
+// newest first. The viewer defaults to the mentioned user.
+func (r *DBConnector) GetMentions(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	if _, err := r.existUser(ctx, info.UserID); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	viewerID := info.ViewerID
+	if viewerID == "" {
+		viewerID = info.UserID
+	}
+
+	var posts model.TimelineResponse
+	query := `
+		SELECT ` + timelineColumns + `
+		FROM posts p
+		WHERE p.id IN (SELECT post_id FROM post_mentions WHERE user_id = $2)
+		AND p.deleted_at IS NULL` + feedHidden + `
+		AND (p.created_at, p.id) < ($3, $4)
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $5
+	`
+	err := r.db().SelectContext(ctx, &posts.Posts, query, viewerID, info.UserID, info.Before, cursorPostID(info.BeforeID), info.Limit)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error getting mentions", "error", err, "user_id", info.UserID, "before", info.Before, "limit", info.Limit)
+		return model.TimelineResponse{}, err
+	}
+	if err := r.attachOriginals(ctx, posts.Posts); err != nil {
+		return model.TimelineResponse{}, err
+	}
+	return posts, nil
+}
+
+// FollowUser follows followeeID on behalf of followerID and returns the state of the follow:
+// model.FollowPending when followeeID is private and has to approve it, model.FollowActive otherwise.
+// It also reports whether the follow changed, following an active followee again changes nothing.
+func (r *DBConnector) FollowUser(ctx context.Context, followerID, followeeID string) (string, bool, error) {
+	exists, err := r.checkUsers(ctx, followerID, followeeID)
+	if !exists {
+		return "", false, err
+	}
+
+	// following an active followee again changes no row and does not notify twice, the follows of
+	// private accounts are pending requests instead
+	const followQuery = `
+		INSERT INTO follows (follower_id, followee_id, is_active, is_pending)
+		VALUES ($1, $2, NOT $3, $3)
 		ON CONFLICT (follower_id, followee_id)
-		DO UPDATE SET is_active = TRUE;
+		DO UPDATE SET is_active = EXCLUDED.is_active, is_pending = EXCLUDED.is_pending
+		WHERE follows.is_active = FALSE;
 	`
-	_, err = r.DB.Exec(query, followerID, followeeID)
+	state := model.FollowActive
+	var changed int64
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		blocked, err := tx.Blocked(ctx, followerID, followeeID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return model.ErrUserBlocked
+		}
+
+		var private bool
+		const privateQuery = `SELECT is_private FROM users WHERE id = $1;`
+		if err := tx.db().QueryRowContext(ctx, privateQuery, followeeID).Scan(&private); err != nil {
+			r.Logger.Sugar().Errorw("Error checking followee privacy", "error", err, "followee_id", followeeID)
+			return err
+		}
+
+		res, err := tx.db().ExecContext(ctx, followQuery, followerID, followeeID, private)
+		if err != nil {
+			r.Logger.Sugar().Errorw("Error following user", "error", err, "user_id", followerID, "followee_id", followeeID)
+			return err
+		}
+		if changed, err = res.RowsAffected(); err != nil || changed == 0 {
+			return err
+		}
+		if private {
+			state = model.FollowPending
+			return nil
+		}
+		if err := tx.notifyUser(ctx, model.NotificationFollow, followeeID, followerID, time.Now().UTC()); err != nil {
+			return err
+		}
+		if r.Fanout != nil {
+			tx.afterCommit(func() { r.Fanout.enqueueFollow(followerID, followeeID) })
+		}
+		return nil
+	})
 	if err != nil {
-		r.Logger.Sugar().Errorw("Error following user", "error", err, "user_id", followerID, "followee_id", followeeID)
+		return "", false, err
 	}
-	return err
+	return state, changed > 0, nil
 }
 
-func (r *DBConnector) checkUsers(followerID string, followeeID string) (bool, error) {
+func (r *DBConnector) checkUsers(ctx context.Context, followerID string, followeeID string) (bool, error) {
+	if r.unit != nil {
+		// a transaction runs one statement at a time
+		for _, userID := range []string{followerID, followeeID} {
+			if exists, err := r.existUser(ctx, userID); !exists {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
 	var (
 		g  errgroup.Group
 		wg sync.WaitGroup
@@ -125,7 +822,7 @@ func (r *DBConnector) checkUsers(followerID string, followeeID string) (bool, er
 	wg.Add(1)
 	g.Go(func() error {
 		defer wg.Done()
-		existsFollower, followerErr = r.existUser(followerID)
+		existsFollower, followerErr = r.existUser(ctx, followerID)
 		if followerErr != nil || !existsFollower {
 			return fmt.Errorf("%s: %s", model.ErrUserNotFound.Error(), followerID)
 		}
@@ -135,7 +832,7 @@ func (r *DBConnector) checkUsers(followerID string, followeeID string) (bool, er
 	wg.Add(1)
 	g.Go(func() error {
 		defer wg.Done()
-		existsFollowee, followeeErr = r.existUser(followeeID)
+		existsFollowee, followeeErr = r.existUser(ctx, followeeID)
 		if followeeErr != nil || !existsFollowee {
 			return fmt.Errorf("%s: %s", model.ErrUserNotFound.Error(), followeeID)
 		}
@@ -154,48 +851,111 @@ func (r *DBConnector) checkUsers(followerID string, followeeID string) (bool, er
 	return true, nil
 }
 
-func (r *DBConnector) UnfollowUser(followerID, followeeID string) error {
-	exists, err := r.checkUsers(followerID, followeeID)
+func (r *DBConnector) UnfollowUser(ctx context.Context, followerID, followeeID string) error {
+	exists, err := r.checkUsers(ctx, followerID, followeeID)
 	if !exists {
 		return err
 	}
 
+	// unfollowing also withdraws a pending request
 	query := `
 		UPDATE follows
-		SET is_active = FALSE
+		SET is_active = FALSE, is_pending = FALSE
 		WHERE follower_id = $1 AND followee_id = $2;
 	`
-	_, err = r.DB.Exec(query, followerID, followeeID)
+	return r.withTx(ctx, func(tx *DBConnector) error {
+		if _, err := tx.db().ExecContext(ctx, query, followerID, followeeID); err != nil {
+			r.Logger.Sugar().Errorw("Error unfollowing user", "error", err, "user_id", followerID, "followee_id", followeeID)
+			return err
+		}
+		return tx.retractFollowNotification(ctx, followerID, followeeID)
+	})
+}
+
+// GetFollowees returns the users actively followed by req.UserID using keyset pagination on user id
+func (r *DBConnector) GetFollowees(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	var followees []model.UserSummary
+	query := `SELECT u.id, u.user_name
+			  FROM follows f
+			  JOIN users u ON u.id = f.followee_id
+			  WHERE f.follower_id = $1
+			  AND f.is_active = TRUE
+			  AND u.id > $2
+			  ORDER BY u.id
+			  LIMIT $3`
+	err := r.db().SelectContext(ctx, &followees, query, req.UserID, keysetAfter(req.After), req.Limit+1)
 	if err != nil {
-		r.Logger.Sugar().Errorw("Error unfollowing user", "error", err, "user_id", followerID, "followee_id", followeeID)
+		r.Logger.Error("Error getting followees", zap.Error(err))
+		return model.FollowListResponse{}, err
 	}
-	return err
+	r.Logger.Sugar().Infow("Got followees info", "user_id", req.UserID)
+	return newFollowListResponse(followees, req.Limit), nil
 }
 
-func (r *DBConnector) GetFollowees(userID string, limit int) ([]string, error) {
-	var followees []string
-	query := `SELECT followee_id
-			  FROM follows 
-			  WHERE follower_id = $1
-			  LIMIT $2`
-	err := r.DB.Select(&followees, query, userID, limit)
+// GetFollowers returns the users actively following req.UserID using keyset pagination on user id
+func (r *DBConnector) GetFollowers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	var followers []model.UserSummary
+	query := `SELECT u.id, u.user_name
+			  FROM follows f
+			  JOIN users u ON u.id = f.follower_id
+			  WHERE f.followee_id = $1
+			  AND f.is_active = TRUE
+			  AND u.id > $2
+			  ORDER BY u.id
+			  LIMIT $3`
+	err := r.db().SelectContext(ctx, &followers, query, req.UserID, keysetAfter(req.After), req.Limit+1)
 	if err != nil {
-		r.Logger.Error("Error getting followees", zap.Error(err))
+		r.Logger.Error("Error getting followers", zap.Error(err))
+		return model.FollowListResponse{}, err
+	}
+	r.Logger.Sugar().Infow("Got followers info", "user_id", req.UserID)
+	return newFollowListResponse(followers, req.Limit), nil
+}
+
+// FollowersAmong returns the users of userIDs actively following followeeID who did not block or
+// mute it, those whose timeline shows the posts of followeeID
+func (r *DBConnector) FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error) {
+	var followers []string
+	query := `SELECT f.follower_id
+			  FROM follows f
+			  WHERE f.followee_id = $1
+			  AND f.is_active = TRUE
+			  AND f.follower_id = ANY($2::uuid[])
+			  AND NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = f.follower_id AND b.blocked_id = $1)
+			  AND NOT EXISTS (SELECT 1 FROM mutes mu WHERE mu.muter_id = f.follower_id AND mu.muted_id = $1)`
+	if err := r.db().SelectContext(ctx, &followers, query, followeeID, pq.Array(userIDs)); err != nil {
+		r.Logger.Error("Error filtering followers", zap.Error(err))
 		return nil, err
 	}
-	r.Logger.Sugar().Infow("Got followees info", "user_id", userID)
-	return followees, nil
+	return followers, nil
 }
 
-func (r *DBConnector) CreateUser(userData model.CreateUserRequest) (uuid.UUID, error) {
+// readersAmongQuery keeps the users u of $2 who may read the post $1, and the post it shares, and
+// who did not block or mute their authors nor were blocked by them
+var readersAmongQuery = `SELECT u.id
+	FROM users u
+	JOIN posts p ON p.id = $1
+	WHERE u.id = ANY($2::uuid[])` + privateAuthor("p", "u.id") + privateShared("p", "u.id") + hiddenFrom("p", "u.id")
+
+// ReadersAmong returns the users of userIDs whose feeds and threads show postID, in one query
+func (r *DBConnector) ReadersAmong(ctx context.Context, postID string, userIDs []string) ([]string, error) {
+	var readers []string
+	if err := r.db().SelectContext(ctx, &readers, readersAmongQuery, postID, pq.Array(userIDs)); err != nil {
+		r.Logger.Sugar().Errorw("Error filtering readers", "error", err, "post_id", postID)
+		return nil, err
+	}
+	return readers, nil
+}
+
+func (r *DBConnector) CreateUser(ctx context.Context, userData model.CreateUserRequest) (uuid.UUID, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 	var userID uuid.UUID
 	query := `
-		INSERT INTO users (user_name, password, email, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (user_name, password, email, is_private, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id;
 	`
-	err := r.DB.QueryRow(query, userData.Name, userData.Password, userData.Email, now, now).Scan(&userID)
+	err := r.db().QueryRowContext(ctx, query, userData.Name, userData.Password, userData.Email, userData.IsPrivate, now, now).Scan(&userID)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to insert user: %w", err)
 	}
@@ -203,10 +963,13 @@ func (r *DBConnector) CreateUser(userData model.CreateUserRequest) (uuid.UUID, e
 	return userID, nil
 }
 
-func (r *DBConnector) GetUser(userID string) (model.User, error) {
+func (r *DBConnector) GetUser(ctx context.Context, userID string) (model.User, error) {
 	var user model.User
-	query := `SELECT * FROM users WHERE id = $1`
-	if err := r.DB.Get(&user, query, userID); err != nil {
+	query := `SELECT id, user_name, is_private, last_post_id, created_at, updated_at FROM users WHERE id = $1`
+	if err := r.db().GetContext(ctx, &user, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.User{}, model.ErrUserNotFound
+		}
 		r.Logger.Sugar().Errorw("Error getting user", "error", err, "user_id", userID)
 		return model.User{}, err
 	}
@@ -214,25 +977,88 @@ func (r *DBConnector) GetUser(userID string) (model.User, error) {
 	return user, nil
 }
 
-func (r *DBConnector) DeleteUser(userID string) error {
-	exists, err := r.existUser(userID)
+// GetUserProfile returns the public profile of a user with its active follow counts and last post
+func (r *DBConnector) GetUserProfile(ctx context.Context, userID string) (model.UserProfile, error) {
+	var row struct {
+		model.UserProfile
+		LastPostID uuid.NullUUID `db:"last_post_id"`
+	}
+	query := `
+		SELECT u.id, u.user_name, u.is_private, u.created_at, u.last_post_id,
+			(SELECT COUNT(*) FROM follows f WHERE f.followee_id = u.id AND f.is_active = TRUE) AS follower_count,
+			(SELECT COUNT(*) FROM follows f WHERE f.follower_id = u.id AND f.is_active = TRUE) AS followee_count
+		FROM users u
+		WHERE u.id = $1
+	`
+	if err := r.db().GetContext(ctx, &row, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.UserProfile{}, model.ErrUserNotFound
+		}
+		r.Logger.Sugar().Errorw("Error getting user profile", "error", err, "user_id", userID)
+		return model.UserProfile{}, err
+	}
+
+	profile := row.UserProfile
+	if row.LastPostID.Valid {
+		post, err := r.GetPost(ctx, row.LastPostID.UUID.String())
+		if err != nil && !errors.Is(err, model.ErrPostNotFound) {
+			return model.UserProfile{}, err
+		}
+		if err == nil && post.DeletedAt == nil {
+			profile.LastPost = &post
+		}
+	}
+	return profile, nil
+}
+
+func (r *DBConnector) GetUserCredentials(ctx context.Context, email string) (model.UserCredentials, error) {
+	var creds model.UserCredentials
+	query := `SELECT id, password FROM users WHERE email = $1`
+	if err := r.db().GetContext(ctx, &creds, query, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			r.Logger.Sugar().Infow("No user registered with email", "email", email)
+			return model.UserCredentials{}, model.ErrUserNotFound
+		}
+		r.Logger.Sugar().Errorw("Error getting user credentials", "error", err, "email", email)
+		return model.UserCredentials{}, err
+	}
+	return creds, nil
+}
+
+func (r *DBConnector) DeleteUser(ctx context.Context, userID string) error {
+	exists, err := r.existUser(ctx, userID)
 	if err != nil || !exists {
 		r.Logger.Error("User not found", zap.Error(err))
 		return err
 	}
+
+	// likes cascade on user deletion, the counters they were part of are released first
+	const releaseLikesQuery = `
+		UPDATE posts SET like_count = like_count - 1
+		WHERE id IN (SELECT post_id FROM likes WHERE user_id = $1);
+	`
 	query := `DELETE FROM users WHERE id = $1`
-	_, err = r.DB.Exec(query, userID)
+	err = r.withTx(ctx, func(tx *DBConnector) error {
+		if _, err := tx.db().ExecContext(ctx, releaseLikesQuery, userID); err != nil {
+			r.Logger.Error("Error releasing user's likes", zap.Error(err))
+			return err
+		}
+		if _, err := tx.db().ExecContext(ctx, query, userID); err != nil {
+			r.Logger.Error("Error deleting user", zap.Error(err))
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		r.Logger.Error("Error deleting user", zap.Error(err))
 		return err
 	}
 	r.Logger.Sugar().Info("User is deleted", "user_id", userID)
-	return err
+	return nil
 }
-func (r *DBConnector) existUser(userID string) (bool, error) {
+func (r *DBConnector) existUser(ctx context.Context, userID string) (bool, error) {
 	var exists bool
 	checkPostQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1);`
-	err := r.DB.QueryRow(checkPostQuery, userID).Scan(&exists)
+	err := r.db().QueryRowContext(ctx, checkPostQuery, userID).Scan(&exists)
 	if err != nil {
 		r.Logger.Sugar().Errorw("Error checking if user exists", "error", err, "user_id", userID)
 		return false, err
@@ -245,24 +1071,120 @@ func (r *DBConnector) existUser(userID string) (bool, error) {
 	r.Logger.Sugar().Infow("Existing user", "user_id", userID)
 	return exists, nil
 }
-func (r *DBConnector) updateUserLastPostAsync(postID uuid.UUID, userID string, updatedAt time.Time) {
-	go func() {
-		const updateUserQuery = `
-			UPDATE users
-			SET last_post_id = $1, updated_at = $2
-			WHERE id = $3;
-		`
-		if _, err := r.DB.Exec(updateUserQuery, postID, updatedAt, userID); err != nil {
-			r.Logger.Error("Error updating user's last_post_id", zap.Error(err))
-		}
-		r.Logger.Sugar().Infow("User's last_post_id updated", "user_id", userID, "post_id", postID.String())
-	}()
+
+// updateUserLastPost points users.last_post_id of userID to postID, it is called within the unit of
+// work that wrote the post
+func (r *DBConnector) updateUserLastPost(ctx context.Context, postID uuid.UUID, userID string, updatedAt time.Time) error {
+	const updateUserQuery = `
+		UPDATE users
+		SET last_post_id = $1, updated_at = $2
+		WHERE id = $3;
+	`
+	if _, err := r.db().ExecContext(ctx, updateUserQuery, postID, updatedAt, userID); err != nil {
+		r.Logger.Sugar().Errorw("Error updating user's last_post_id", "error", err, "user_id", userID, "post_id", postID.String())
+		return err
+	}
+	return nil
+}
+
+// notReposted checks that userID has no live repost of postID, the unique index on
+// (user_id, repost_of) guards against concurrent reposts
+func (r *DBConnector) notReposted(ctx context.Context, userID, postID string) error {
+	var exists bool
+	checkRepostQuery := `SELECT EXISTS(SELECT 1 FROM posts WHERE user_id = $1 AND repost_of = $2 AND kind = 'repost' AND deleted_at IS NULL);`
+	if err := r.db().QueryRowContext(ctx, checkRepostQuery, userID, postID).Scan(&exists); err != nil {
+		r.Logger.Error("Error checking if post is already reposted", zap.Error(err))
+		return err
+	}
+	if exists {
+		return model.ErrAlreadyReposted
+	}
+	return nil
+}
+
+// indexHashtags stores the hashtags of a post, created_at is copied so that feeds page on the index alone
+func (r *DBConnector) indexHashtags(ctx context.Context, postID uuid.UUID, createdAt time.Time, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	const insertQuery = `
+		INSERT INTO post_hashtags (post_id, tag, created_at)
+		SELECT $1, tag, $2 FROM unnest($3::text[]) AS tag
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := r.db().ExecContext(ctx, insertQuery, postID, createdAt, pq.Array(tags)); err != nil {
+		r.Logger.Error("Error indexing post hashtags", zap.Error(err), zap.String("post_id", postID.String()))
+		return err
+	}
+	return nil
+}
+
+// indexMentions resolves the parsed usernames of a post against users.user_name and stores the
+// mentions that matched, unknown usernames are dropped
+func (r *DBConnector) indexMentions(ctx context.Context, postID uuid.UUID, mentions []model.Mention) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+	usernames := make([]string, len(mentions))
+	offsets := make([]int64, len(mentions))
+	lengths := make([]int64, len(mentions))
+	for i, mention := range mentions {
+		usernames[i] = mention.Username
+		offsets[i] = int64(mention.Offset)
+		lengths[i] = int64(mention.Length)
+	}
+	const insertQuery = `
+		INSERT INTO post_mentions (post_id, user_id, char_offset, char_length)
+		SELECT $1, u.id, m.char_offset, m.char_length
+		FROM unnest($2::text[], $3::int[], $4::int[]) AS m(user_name, char_offset, char_length)
+		JOIN users u ON u.user_name = m.user_name
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := r.db().ExecContext(ctx, insertQuery, postID, pq.Array(usernames), pq.Array(offsets), pq.Array(lengths)); err != nil {
+		r.Logger.Error("Error indexing post mentions", zap.Error(err), zap.String("post_id", postID.String()))
+		return err
+	}
+	return nil
+}
+
+// existLivePost checks that a post of any author exists and is not deleted
+func (r *DBConnector) existLivePost(ctx context.Context, postID string) error {
+	var exists bool
+	checkPostQuery := `SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL);`
+	err := r.db().QueryRowContext(ctx, checkPostQuery, postID).Scan(&exists)
+	if err != nil {
+		r.Logger.Error("Error checking if post exists", zap.Error(err))
+		return err
+	}
+
+	if !exists {
+		r.Logger.Sugar().Errorw("post_id does not exist", "post_id", postID)
+		return model.ErrPostNotFound
+	}
+	return nil
+}
+
+// existReadablePost checks that a post exists, is not deleted and that viewerID may read it and the
+// post it shares. The posts of private accounts viewerID does not follow are reported as not found.
+func (r *DBConnector) existReadablePost(ctx context.Context, viewerID, postID string) error {
+	var exists bool
+	checkPostQuery := `SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = $2 AND p.deleted_at IS NULL` +
+		privateAuthor("p", "$1") + privateShared("p", "$1") + `);`
+	if err := r.db().QueryRowContext(ctx, checkPostQuery, viewerID, postID).Scan(&exists); err != nil {
+		r.Logger.Error("Error checking if post is readable", zap.Error(err))
+		return err
+	}
+	if !exists {
+		r.Logger.Sugar().Errorw("post_id does not exist for viewer", "post_id", postID, "viewer_id", viewerID)
+		return model.ErrPostNotFound
+	}
+	return nil
 }
 
-func (r *DBConnector) existPost(postID uuid.UUID, userID string) error {
+func (r *DBConnector) existPost(ctx context.Context, postID uuid.UUID, userID string) error {
 	var exists bool
-	checkPostQuery := `SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2);`
-	err := r.DB.QueryRow(checkPostQuery, postID, userID).Scan(&exists)
+	checkPostQuery := `SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL);`
+	err := r.db().QueryRowContext(ctx, checkPostQuery, postID, userID).Scan(&exists)
 	if err != nil {
 		r.Logger.Error("Error checking if post exists", zap.Error(err))
 		return err
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -13,12 +14,14 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
 func TestSave(t *testing.T) {
+	parentID := uuid.New().String()
 	tests := []struct {
 		name         string
 		setupMock    func(sqlmock.Sqlmock)
@@ -29,17 +32,33 @@ func TestSave(t *testing.T) {
 		{
 			name: "Success",
 			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
 				mock.ExpectQuery(regexp.QuoteMeta(`
-				INSERT INTO posts (user_id, content, created_at, updated_at)
-				VALUES ($1, $2, $3, $4)
+				INSERT INTO posts (user_id, content, created_at, updated_at, content_updated_at, in_reply_to, kind, repost_of)
+				VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
 				RETURNING id;
 			`)).
-					WithArgs("user-id-123", "Hello world", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WithArgs("user-id-123", "Hello #world @alice", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "post", nil).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectExec(`INSERT INTO post_hashtags \(post_id, tag, created_at\) SELECT \$1, tag, \$2 FROM unnest\(\$3::text\[\]\)`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{"world"})).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO post_mentions \(post_id, user_id, char_offset, char_length\) SELECT \$1, u.id, m.char_offset, m.char_length FROM unnest\(\$2::text\[\], \$3::int\[\], \$4::int\[\]\) .* JOIN users u ON u.user_name = m.user_name`).
+					WithArgs(sqlmock.AnyArg(), pq.Array([]string{"alice"}), pq.Array([]int64{13}), pq.Array([]int64{6})).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO notifications \(user_id, actor_id, type, post_id, created_at\) SELECT DISTINCT pm.user_id, \$1, 'mention', pm.post_id, \$2 FROM post_mentions pm .* NOT EXISTS \( SELECT 1 FROM blocks b`).
+					WithArgs("user-id-123", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE users SET last_post_id = \$1, updated_at = \$2 WHERE id = \$3`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "user-id-123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
 			inputPost: &model.Post{
-				UserID:  "user-id-123",
-				Content: "Hello world",
+				UserID:   "user-id-123",
+				Content:  "Hello #world @alice",
+				Hashtags: []string{"world"},
+				Mentions: model.Mentions{{Offset: 13, Length: 6, Username: "alice"}},
 			},
 			expectedErr:  false,
 			expectedUUID: true,
@@ -47,13 +66,34 @@ func TestSave(t *testing.T) {
 		{
 			name: "DB error",
 			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
 				mock.ExpectQuery(regexp.QuoteMeta(`
-					INSERT INTO posts (user_id, content, created_at, updated_at)
-					VALUES ($1, $2, $3, $4)
+					INSERT INTO posts (user_id, content, created_at, updated_at, content_updated_at, in_reply_to, kind, repost_of)
+					VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
 					RETURNING id;
 				`)).
-					WithArgs("user-id-123", "Hello world", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WithArgs("user-id-123", "Hello world", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "post", nil).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			inputPost: &model.Post{
+				UserID:  "user-id-123",
+				Content: "Hello world",
+			},
+			expectedErr:  true,
+			expectedUUID: false,
+		},
+		{
+			name: "Last post update error rolls back the post",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO posts`).
+					WithArgs("user-id-123", "Hello world", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "post", nil).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectExec(`UPDATE users SET last_post_id = \$1, updated_at = \$2 WHERE id = \$3`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "user-id-123").
 					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
 			},
 			inputPost: &model.Post{
 				UserID:  "user-id-123",
@@ -62,6 +102,66 @@ func TestSave(t *testing.T) {
 			expectedErr:  true,
 			expectedUUID: false,
 		},
+		{
+			name: "Reply to unreadable parent",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				// the parent is missing, deleted or written by a private account the author does not follow
+				mock.ExpectQuery(readablePostQuery).
+					WithArgs("user-id-123", parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			inputPost: &model.Post{
+				UserID:    "user-id-123",
+				Content:   "Hello world",
+				InReplyTo: &parentID,
+			},
+			expectedErr:  true,
+			expectedUUID: false,
+		},
+		{
+			name: "Repost",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM posts WHERE id = \$1 AND deleted_at IS NULL\)`).
+					WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM posts WHERE user_id = \$1 AND repost_of = \$2 AND kind = 'repost'`).
+					WithArgs("user-id-123", parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO posts`).
+					WithArgs("user-id-123", "", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "repost", parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+				mock.ExpectExec(`UPDATE users SET last_post_id = \$1, updated_at = \$2 WHERE id = \$3`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "user-id-123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			inputPost: &model.Post{
+				UserID:   "user-id-123",
+				Kind:     model.PostKindRepost,
+				RepostOf: &parentID,
+			},
+			expectedErr:  false,
+			expectedUUID: true,
+		},
+		{
+			name: "Already reposted",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM posts WHERE id = \$1 AND deleted_at IS NULL\)`).
+					WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM posts WHERE user_id = \$1 AND repost_of = \$2 AND kind = 'repost'`).
+					WithArgs("user-id-123", parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			},
+			inputPost: &model.Post{
+				UserID:   "user-id-123",
+				Kind:     model.PostKindRepost,
+				RepostOf: &parentID,
+			},
+			expectedErr:  true,
+			expectedUUID: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -76,7 +176,7 @@ func TestSave(t *testing.T) {
 
 			tt.setupMock(mock)
 
-			id, err := repo.Save(tt.inputPost)
+			id, err := repo.Save(t.Context(), tt.inputPost)
 			if tt.expectedErr {
 				assert.Error(t, err)
 				assert.Equal(t, uuid.Nil, id)
@@ -110,22 +210,57 @@ func TestUpdatePostPut(t *testing.T) {
 			setupMock: func(mock sqlmock.Sqlmock) {
 				// Mock existPost query
 				mock.ExpectQuery(regexp.QuoteMeta(`
-					SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2)
+					SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
 				`)).
 					WithArgs(validUUID, userID).
 					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
-				// Mock update query
-				mock.ExpectExec(regexp.QuoteMeta(`
+				// Mock update query, the previous content is kept as a revision first
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO post_revisions \(post_id, revision, content, created_at\) SELECT id, edit_count \+ 1, content, content_updated_at FROM posts WHERE id = \$1 AND user_id = \$2 AND deleted_at IS NULL FOR UPDATE`).
+					WithArgs(validUUID, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(`
 					UPDATE posts
-					SET content = $1, updated_at = $2
-					WHERE id = $3 AND user_id = $4;
+					SET content = $1, updated_at = $2, content_updated_at = $2, edit_count = edit_count + 1, version = version + 1
+					WHERE id = $3 AND user_id = $4
+					RETURNING created_at;
 				`)).
 					WithArgs(content, sqlmock.AnyArg(), validUUID.String(), userID).
-					WillReturnResult(sqlmock.NewResult(1, 1))
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+				// the previous hashtags are dropped, the content has none to index
+				mock.ExpectExec(`DELETE FROM post_hashtags WHERE post_id = \$1`).
+					WithArgs(validUUID).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`DELETE FROM post_mentions WHERE post_id = \$1`).
+					WithArgs(validUUID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				// editing an older post does not make it the author's last post
+				mock.ExpectCommit()
 			},
 			expectedErr: nil,
 		},
+		{
+			name: "Deleted while editing",
+			input: model.CreatePostRequest{
+				PostID:  validUUID.String(),
+				UserID:  userID,
+				Content: content,
+			},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(`
+					SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+				`)).
+					WithArgs(validUUID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WithArgs(validUUID, userID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedErr: model.ErrPostNotFound,
+		},
 		{
 			name: "Post not found",
 			input: model.CreatePostRequest{
@@ -136,7 +271,7 @@ func TestUpdatePostPut(t *testing.T) {
 			setupMock: func(mock sqlmock.Sqlmock) {
 				// Mock existPost query returns false
 				mock.ExpectQuery(regexp.QuoteMeta(`
-					SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2)
+					SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
 				`)).
 					WithArgs(validUUID, userID).
 					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
@@ -167,9 +302,300 @@ func TestUpdatePostPut(t *testing.T) {
 
 			tt.setupMock(mock)
 
-			err = repo.UpdatePostPut(tt.input)
+			err = repo.UpdatePostPut(t.Context(), tt.input)
+			assert.Equal(t, tt.expectedErr, err)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPatchPost(t *testing.T) {
+	postID := uuid.New()
+	const userID = "user-id-123"
+	content, warning := "patched", "spoilers"
+	lockQuery := `SELECT version FROM posts WHERE id = \$1 AND user_id = \$2 AND deleted_at IS NULL FOR UPDATE`
+
+	tests := []struct {
+		name            string
+		input           model.PatchPostRequest
+		setupMock       func(sqlmock.Sqlmock)
+		expectedVersion int
+		expectedErr     error
+	}{
+		{
+			name:  "content and warning",
+			input: model.PatchPostRequest{PostID: postID.String(), UserID: userID, Content: &content, ContentWarning: &warning, Versions: []int{1, 2}},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(postID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+				mock.ExpectExec(`INSERT INTO post_revisions`).
+					WithArgs(postID, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE posts SET updated_at = \$3, version = version \+ 1, content = \$4, content_updated_at = \$3, edit_count = edit_count \+ 1, content_warning = NULLIF\(\$5, ''\) WHERE id = \$1 AND user_id = \$2 RETURNING version, created_at`).
+					WithArgs(postID, userID, sqlmock.AnyArg(), content, warning).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "created_at"}).AddRow(3, time.Now()))
+				mock.ExpectExec(`DELETE FROM post_hashtags WHERE post_id = \$1`).
+					WithArgs(postID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`DELETE FROM post_mentions WHERE post_id = \$1`).
+					WithArgs(postID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expectedVersion: 3,
+		},
+		{
+			name:  "warning only",
+			input: model.PatchPostRequest{PostID: postID.String(), UserID: userID, ContentWarning: &warning},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(postID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+				mock.ExpectQuery(`UPDATE posts SET updated_at = \$3, version = version \+ 1, content_warning = NULLIF\(\$4, ''\) WHERE`).
+					WithArgs(postID, userID, sqlmock.AnyArg(), warning).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "created_at"}).AddRow(6, time.Now()))
+				mock.ExpectCommit()
+			},
+			expectedVersion: 6,
+		},
+		{
+			name:  "stale version",
+			input: model.PatchPostRequest{PostID: postID.String(), UserID: userID, Content: &content, Versions: []int{1}},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(postID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+				mock.ExpectRollback()
+			},
+			expectedErr: model.ErrVersionMismatch,
+		},
+		{
+			name:  "post not found",
+			input: model.PatchPostRequest{PostID: postID.String(), UserID: userID, Content: &content},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(postID, userID).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			expectedErr: model.ErrPostNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+			tt.setupMock(mock)
+
+			version, err := repo.PatchPost(t.Context(), tt.input)
+
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedVersion, version)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	postID := uuid.New()
+	userID := "user-id-123"
+	existsQuery := regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`)
+
+	tests := []struct {
+		name        string
+		postID      string
+		setupMock   func(sqlmock.Sqlmock)
+		expectedErr error
+	}{
+		{
+			name:   "Success",
+			postID: postID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(existsQuery).
+					WithArgs(postID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE posts\s+SET deleted_at = \$1, updated_at = \$1`).
+					WithArgs(sqlmock.AnyArg(), postID, userID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE users\s+SET last_post_id = \(`).
+					WithArgs(userID, sqlmock.AnyArg(), postID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "Post not found",
+			postID: postID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(existsQuery).
+					WithArgs(postID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:   "Recompute error rolls back",
+			postID: postID.String(),
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(existsQuery).
+					WithArgs(postID, userID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE posts\s+SET deleted_at`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE users\s+SET last_post_id`).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+		{
+			name:        "Invalid UUID",
+			postID:      "not-a-uuid",
+			setupMock:   func(mock sqlmock.Sqlmock) {},
+			expectedErr: model.ErrInvalidUUID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+			tt.setupMock(mock)
+
+			err = repo.DeletePost(t.Context(), tt.postID, userID)
 			assert.Equal(t, tt.expectedErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// readablePostQuery matches existReadablePost, a private author the viewer does not follow hides the post
+const readablePostQuery = `SELECT EXISTS\(SELECT 1 FROM posts p WHERE p\.id = \$2 AND p\.deleted_at IS NULL AND NOT EXISTS \( SELECT 1 FROM users au WHERE au\.id = p\.user_id AND au\.is_private = TRUE`
 
+func TestLikePost(t *testing.T) {
+	postID := uuid.New().String()
+	userID := uuid.New().String()
+
+	tests := []struct {
+		name            string
+		unlike          bool
+		setupMock       func(mock sqlmock.Sqlmock)
+		expectedChanged bool
+		expectedErr     error
+	}{
+		{
+			name:            "new_like_increments_counter",
+			expectedChanged: true,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(readablePostQuery).
+					WithArgs(userID, postID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO likes \(user_id, post_id, created_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT \(user_id, post_id\) DO NOTHING`).
+					WithArgs(userID, postID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE posts SET like_count = like_count \+ \$1 WHERE id = \$2`).
+					WithArgs(1, postID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO notifications \(user_id, actor_id, type, post_id, created_at\) SELECT user_id, \$1, \$2, id, \$3 FROM posts WHERE id = \$4 AND user_id <> \$1 AND NOT EXISTS \( SELECT 1 FROM blocks b WHERE \(b\.blocker_id = posts\.user_id AND b\.blocked_id = \$1\)`).
+					WithArgs(userID, model.NotificationLike, sqlmock.AnyArg(), postID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "duplicate_like_keeps_counter",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(readablePostQuery).
+					WithArgs(userID, postID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO likes`).
+					WithArgs(userID, postID, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:            "unlike_decrements_counter",
+			unlike:          true,
+			expectedChanged: true,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM posts`).
+					WithArgs(postID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM likes WHERE user_id = \$1 AND post_id = \$2`).
+					WithArgs(userID, postID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE posts SET like_count = like_count \+ \$1`).
+					WithArgs(-1, postID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM notifications WHERE type = \$1 AND actor_id = \$2 AND post_id = \$3`).
+					WithArgs(model.NotificationLike, userID, postID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "post_not_found",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(readablePostQuery).
+					WithArgs(userID, postID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:   "unlike_of_unreadable_post",
+			unlike: true,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				// the like of a post that became private is still removable
+				mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM posts WHERE id = \$1 AND deleted_at IS NULL\)`).
+					WithArgs(postID).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM likes`).
+					WithArgs(userID, postID).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+			repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+			tt.setupMock(mock)
+
+			var (
+				changed bool
+				err     error
+			)
+			if tt.unlike {
+				changed, err = repo.UnlikePost(t.Context(), userID, postID)
+			} else {
+				changed, err = repo.LikePost(t.Context(), userID, postID)
+			}
+
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedChanged, changed)
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
@@ -182,12 +608,12 @@ func TestGetTimeline(t *testing.T) {
 	logger := zap.NewNop()
 	repo := &DBConnector{DB: sqlxDB, Logger: logger}
 	now := time.Now()
-	mock.ExpectQuery(`SELECT p.id, p.user_id, p.content, p.created_at FROM posts`).
-		WithArgs("user-id-123", now, 10).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at"}).
-			AddRow(uuid.New(), "user-id-123", "Hello!", now))
+	mock.ExpectQuery(`SELECT p.id, p.user_id, p.content, p.created_at, p.updated_at, p.in_reply_to, p.like_count, p.edited, p.edit_count, p.content_warning, p.version, EXISTS\(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = \$1\) AS liked_by_viewer, p.kind, p.repost_of, COALESCE\(.*\) AS mentions FROM posts`).
+		WithArgs("user-id-123", now, uuid.Nil.String(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at", "like_count", "liked_by_viewer"}).
+			AddRow(uuid.New(), "user-id-123", "Hello!", now, now.Add(time.Minute), 3, true))
 
-	timeline, err := repo.GetTimeline(model.TimelineRequest{
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{
 		UserID: "user-id-123",
 		Before: now,
 		Limit:  10,
@@ -195,6 +621,157 @@ func TestGetTimeline(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Len(t, timeline.Posts, 1)
+	assert.Equal(t, now.Add(time.Minute), timeline.Posts[0].UpdatedAt)
+	assert.Equal(t, 3, timeline.Posts[0].LikeCount)
+	assert.True(t, timeline.Posts[0].LikedByViewer)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTimelineSince(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	after := time.Now()
+
+	mock.ExpectQuery(`AND \(p.created_at, p.id\) > \(\$2, \$3\) ORDER BY p.created_at ASC, p.id ASC`).
+		WithArgs("user-id-123", after, uuid.Max.String(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "user-id-123", "Hello!", after.Add(time.Second), after.Add(time.Second)))
+
+	timeline, err := repo.GetTimeline(t.Context(), model.TimelineRequest{UserID: "user-id-123", After: after, Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, timeline.Posts, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPost(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+	postID := uuid.New().String()
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, COALESCE\(.*\) AS mentions FROM posts WHERE id = \$1`).
+			WithArgs(postID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at", "deleted_at", "mentions"}).
+				AddRow(postID, "user-id-123", "Hello @bob!", now, now, nil, []byte(`[{"offset": 6, "length": 4, "user_id": "user-id-456"}]`)))
+
+		post, err := repo.GetPost(t.Context(), postID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, postID, post.ID)
+		assert.Nil(t, post.DeletedAt)
+		assert.Equal(t, model.Mentions{{Offset: 6, Length: 4, UserID: "user-id-456"}}, post.Mentions)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, COALESCE\(.*\) AS mentions FROM posts`).
+			WithArgs(postID).
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.GetPost(t.Context(), postID)
+
+		assert.Equal(t, model.ErrPostNotFound, err)
+	})
+
+	t.Run("cancelled_request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err := repo.GetPost(ctx, postID)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("deadline_exceeded", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, COALESCE\(.*\) AS mentions FROM posts`).
+			WithArgs(postID).
+			WillDelayFor(time.Second).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(postID))
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+
+		_, err := repo.GetPost(ctx, postID)
+
+		// the driver cancels the running query instead of waiting for its result
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetThreadQueries(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+	postID := uuid.New().String()
+	rootID := uuid.New().String()
+	sharedID := uuid.New().String()
+	columns := []string{"id", "user_id", "content", "created_at", "updated_at", "deleted_at", "in_reply_to", "like_count",
+		"edited", "edit_count", "content_warning", "version", "kind", "repost_of", "mentions"}
+	mentions := []byte(`[{"offset": 0, "length": 4, "user_id": "user-id-456"}]`)
+
+	mock.ExpectQuery(`WITH RECURSIVE ancestors AS .* SELECT p.id, p.user_id, p.content, p.created_at, p.updated_at, p.deleted_at, p.in_reply_to, p.like_count, p.edited, p.edit_count, p.content_warning, p.version, p.kind, p.repost_of, COALESCE\(.*\) AS mentions FROM ancestors a JOIN posts p ON p.id = a.id WHERE TRUE AND NOT EXISTS \( SELECT 1 FROM users au WHERE au.id = p.user_id .* ORDER BY a.depth DESC`).
+		WithArgs("viewer-id", postID).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(rootID, "user-id-123", "@bob look", now, now, nil, nil, 2, true, 1, nil, 3, model.PostKindQuote, sharedID, mentions))
+	mock.ExpectQuery(`SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, .* FROM posts WHERE id IN \(\?\)`).
+		WithArgs(sharedID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at", "kind"}).
+			AddRow(sharedID, "user-id-456", "shared", now, now, model.PostKindPost))
+	mock.ExpectQuery(`WITH RECURSIVE descendants AS .* FROM descendants d JOIN posts p ON p.id = d.id WHERE \(p.created_at, p.id\) > \(\$3, \$4\) AND NOT EXISTS \( SELECT 1 FROM users au WHERE au.id = p.user_id .* ORDER BY p.created_at, p.id LIMIT \$5`).
+		WithArgs("viewer-id", postID, time.Time{}, uuid.Max.String(), 10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(uuid.New().String(), "user-id-123", "reply", now, now, nil, postID, 1, false, 0, nil, 1, model.PostKindPost, nil, []byte(`[]`)))
+
+	ancestors, err := repo.GetAncestors(t.Context(), "viewer-id", postID)
+	assert.NoError(t, err)
+	require.Len(t, ancestors, 1)
+	root := ancestors[0]
+	assert.Nil(t, root.InReplyTo)
+	assert.Equal(t, model.PostKindQuote, root.Kind)
+	assert.Equal(t, 2, root.LikeCount)
+	assert.True(t, root.Edited)
+	assert.Equal(t, 3, root.Version)
+	assert.Equal(t, model.Mentions{{Offset: 0, Length: 4, UserID: "user-id-456"}}, root.Mentions)
+	require.NotNil(t, root.RepostOf)
+	assert.Equal(t, sharedID, *root.RepostOf)
+	require.NotNil(t, root.Original, "the quoted post is attached")
+	assert.Equal(t, "shared", root.Original.Content)
+
+	replies, err := repo.GetReplies(t.Context(), model.ThreadRequest{PostID: postID, ViewerID: "viewer-id", Limit: 10})
+	assert.NoError(t, err)
+	require.Len(t, replies, 1)
+	assert.Equal(t, postID, *replies[0].InReplyTo)
+	assert.Equal(t, model.PostKindPost, replies[0].Kind)
+	assert.Equal(t, 1, replies[0].LikeCount)
+	assert.Equal(t, 1, replies[0].Version)
+	assert.Nil(t, replies[0].RepostOf)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserPosts(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$1\)`).
+		WithArgs("user-id-123").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	cursorID := uuid.New().String()
+	mock.ExpectQuery(`SELECT id, user_id, content, created_at, updated_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, COALESCE\(.*\) AS mentions FROM posts WHERE user_id = \$1 AND deleted_at IS NULL AND NOT EXISTS \( SELECT 1 FROM posts o JOIN users ou ON ou.id = o.user_id WHERE o.id = posts.repost_of AND ou.is_private = TRUE AND ou.id <> \$5 .* AND \(created_at, id\) < \(\$2, \$3\)`).
+		WithArgs("user-id-123", now, cursorID, 10, "viewer-id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "user-id-123", "Hello!", now, now))
+
+	posts, err := repo.GetUserPosts(t.Context(), model.TimelineRequest{UserID: "user-id-123", ViewerID: "viewer-id", Before: now, BeforeID: cursorID, Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, posts.Posts, 1)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -228,6 +805,21 @@ func TestFollowUserCases(t *testing.T) {
 			args:      args{"user1", "user2"},
 			expectErr: true,
 		},
+		{
+			name:      "blocked",
+			args:      args{"user1", "user2"},
+			expectErr: true,
+		},
+		{
+			name:      "private",
+			args:      args{"user1", "user2"},
+			expectErr: false,
+		},
+		{
+			name:      "already_following",
+			args:      args{"user1", "user2"},
+			expectErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -247,9 +839,20 @@ func TestFollowUserCases(t *testing.T) {
 				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
 					WithArgs(tt.args.follower).
 					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectExec(`INSERT INTO follows`).
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM blocks`).
 					WithArgs(tt.args.follower, tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`SELECT is_private FROM users WHERE id = \$1`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"is_private"}).AddRow(false))
+				mock.ExpectExec(`INSERT INTO follows`).
+					WithArgs(tt.args.follower, tt.args.followee, false).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`INSERT INTO notifications \(user_id, actor_id, type, created_at\)`).
+					WithArgs(tt.args.followee, tt.args.follower, model.NotificationFollow, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 
 			case "followee_not_found":
 				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
@@ -271,12 +874,85 @@ func TestFollowUserCases(t *testing.T) {
 				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
 					WithArgs(tt.args.follower).
 					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectExec(`INSERT INTO follows`).
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM blocks`).
 					WithArgs(tt.args.follower, tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`SELECT is_private FROM users WHERE id = \$1`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"is_private"}).AddRow(false))
+				mock.ExpectExec(`INSERT INTO follows`).
+					WithArgs(tt.args.follower, tt.args.followee, false).
 					WillReturnError(errors.New("insert failed"))
+				mock.ExpectRollback()
+
+			case "blocked":
+				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
+					WithArgs(tt.args.follower).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM blocks`).
+					WithArgs(tt.args.follower, tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectRollback()
+
+			case "private":
+				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
+					WithArgs(tt.args.follower).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM blocks`).
+					WithArgs(tt.args.follower, tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`SELECT is_private FROM users WHERE id = \$1`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"is_private"}).AddRow(true))
+				mock.ExpectExec(`INSERT INTO follows`).
+					WithArgs(tt.args.follower, tt.args.followee, true).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+			case "already_following":
+				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
+					WithArgs(tt.args.follower).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM blocks`).
+					WithArgs(tt.args.follower, tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`SELECT is_private FROM users WHERE id = \$1`).
+					WithArgs(tt.args.followee).
+					WillReturnRows(sqlmock.NewRows([]string{"is_private"}).AddRow(false))
+				mock.ExpectExec(`INSERT INTO follows`).
+					WithArgs(tt.args.follower, tt.args.followee, false).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
 			}
 
-			err = repo.FollowUser(tt.args.follower, tt.args.followee)
+			state, changed, err := repo.FollowUser(t.Context(), tt.args.follower, tt.args.followee)
+			if tt.name == "blocked" {
+				assert.ErrorIs(t, err, model.ErrUserBlocked)
+			}
+			switch tt.name {
+			case "success":
+				assert.Equal(t, model.FollowActive, state)
+				assert.True(t, changed)
+			case "private":
+				assert.Equal(t, model.FollowPending, state, "following a private account requests it")
+				assert.True(t, changed)
+			case "already_following":
+				assert.Equal(t, model.FollowActive, state)
+				assert.False(t, changed, "following again changes nothing")
+			}
 			if tt.expectErr {
 				assert.Error(t, err)
 			} else {
@@ -321,9 +997,14 @@ func TestUnfollowUserCases(t *testing.T) {
 				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
 					WithArgs(tt.args.follower).
 					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectExec(`UPDATE follows\s+SET is_active = FALSE\s+WHERE follower_id = \$1 AND followee_id = \$2;?`).
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE follows\s+SET is_active = FALSE, is_pending = FALSE\s+WHERE follower_id = \$1 AND followee_id = \$2;?`).
 					WithArgs(tt.args.follower, tt.args.followee).
 					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM notifications WHERE type = 'follow' AND user_id = \$1 AND actor_id = \$2`).
+					WithArgs(tt.args.followee, tt.args.follower).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 
 			case "followee_not_found":
 				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
@@ -345,12 +1026,14 @@ func TestUnfollowUserCases(t *testing.T) {
 				mock.ExpectQuery(`SELECT EXISTS\s*\(\s*SELECT 1 FROM users WHERE id = \$1\s*\)`).
 					WithArgs(tt.args.follower).
 					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
-				mock.ExpectExec(`UPDATE follows\s+SET is_active = FALSE\s+WHERE follower_id = \$1 AND followee_id = \$2;?`).
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE follows\s+SET is_active = FALSE, is_pending = FALSE\s+WHERE follower_id = \$1 AND followee_id = \$2;?`).
 					WithArgs(tt.args.follower, tt.args.followee).
 					WillReturnError(fmt.Errorf("update failed"))
+				mock.ExpectRollback()
 			}
 
-			err = repo.UnfollowUser(tt.args.follower, tt.args.followee)
+			err = repo.UnfollowUser(t.Context(), tt.args.follower, tt.args.followee)
 			if tt.expectErr {
 				assert.Error(t, err)
 			} else {
@@ -368,14 +1051,65 @@ func TestGetFollowees(t *testing.T) {
 	logger := zap.NewNop()
 	repo := &DBConnector{DB: sqlxDB, Logger: logger}
 
-	mock.ExpectQuery(`SELECT followee_id FROM follows`).
-		WithArgs("user1", 5).
-		WillReturnRows(sqlmock.NewRows([]string{"followee_id"}).AddRow("user2").AddRow("user3"))
+	mock.ExpectQuery(`SELECT u.id, u.user_name FROM follows f JOIN users u ON u.id = f.followee_id WHERE f.follower_id = \$1 AND f.is_active = TRUE`).
+		WithArgs("user1", uuid.Nil.String(), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).
+			AddRow("user2", "bob").AddRow("user3", "carol").AddRow("user4", "dave"))
 
-	followees, err := repo.GetFollowees("user1", 5)
+	followees, err := repo.GetFollowees(t.Context(), model.FollowListRequest{UserID: "user1", Limit: 2})
 
 	assert.NoError(t, err)
-	assert.ElementsMatch(t, []string{"user2", "user3"}, followees)
+	assert.Equal(t, []model.UserSummary{{ID: "user2", Name: "bob"}, {ID: "user3", Name: "carol"}}, followees.Users)
+	assert.Equal(t, "user3", followees.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFollowers(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT u.id, u.user_name FROM follows f JOIN users u ON u.id = f.follower_id WHERE f.followee_id = \$1 AND f.is_active = TRUE`).
+		WithArgs("user1", "user2", 6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow("user3", "carol"))
+
+	followers, err := repo.GetFollowers(t.Context(), model.FollowListRequest{UserID: "user1", Limit: 5, After: "user2"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: "user3", Name: "carol"}}, followers.Users)
+	assert.Empty(t, followers.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFollowersAmong(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT f.follower_id FROM follows f WHERE f.followee_id = \$1 AND f.is_active = TRUE AND f.follower_id = ANY\(\$2::uuid\[\]\) AND NOT EXISTS \(SELECT 1 FROM blocks b WHERE b.blocker_id = f.follower_id AND b.blocked_id = \$1\) AND NOT EXISTS \(SELECT 1 FROM mutes mu WHERE mu.muter_id = f.follower_id AND mu.muted_id = \$1\)`).
+		WithArgs("user1", pq.Array([]string{"user2", "user3"})).
+		WillReturnRows(sqlmock.NewRows([]string{"follower_id"}).AddRow("user3"))
+
+	followers, err := repo.FollowersAmong(t.Context(), "user1", []string{"user2", "user3"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user3"}, followers)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadersAmong(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT u.id FROM users u JOIN posts p ON p.id = \$1 WHERE u.id = ANY\(\$2::uuid\[\]\) AND NOT EXISTS \( SELECT 1 FROM users au WHERE au.id = p.user_id AND au.is_private = TRUE AND au.id <> u.id .* SELECT muted_id FROM mutes WHERE muter_id = u.id`).
+		WithArgs("post1", pq.Array([]string{"user2", "user3"})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("user2"))
+
+	readers, err := repo.ReadersAmong(t.Context(), "post1", []string{"user2", "user3"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user2"}, readers)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -404,10 +1138,10 @@ func TestCreateUser(t *testing.T) {
 	// Happy Path Test (user created successfully)
 	t.Run("happy_path_-_user_created_successfully", func(t *testing.T) {
 		mock.ExpectQuery(`INSERT INTO users \(.+\)`).
-			WithArgs(userData.Name, userData.Password, userData.Email, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WithArgs(userData.Name, userData.Password, userData.Email, false, sqlmock.AnyArg(), sqlmock.AnyArg()).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
 
-		userID, err := r.CreateUser(userData)
+		userID, err := r.CreateUser(t.Context(), userData)
 
 		assert.NoError(t, err)
 		assert.NotEqual(t, uuid.Nil, userID)
@@ -416,10 +1150,10 @@ func TestCreateUser(t *testing.T) {
 	// Test case for database error when inserting the user
 	t.Run("db_returns_error_on_insert", func(t *testing.T) {
 		mock.ExpectQuery(`INSERT INTO users \(.+\)`).
-			WithArgs(userData.Name, userData.Password, userData.Email, fixedTime, fixedTime).
+			WithArgs(userData.Name, userData.Password, userData.Email, false, fixedTime, fixedTime).
 			WillReturnError(fmt.Errorf("db error"))
 
-		userID, err := r.CreateUser(userData)
+		userID, err := r.CreateUser(t.Context(), userData)
 
 		// Verify the results
 		assert.Error(t, err)
@@ -429,10 +1163,10 @@ func TestCreateUser(t *testing.T) {
 	// Test case where no ID is returned from the database
 	t.Run("no_rows_returned", func(t *testing.T) {
 		mock.ExpectQuery(`INSERT INTO users \(.+\)`).
-			WithArgs(userData.Name, userData.Password, userData.Email, fixedTime, fixedTime).
+			WithArgs(userData.Name, userData.Password, userData.Email, false, fixedTime, fixedTime).
 			WillReturnRows(sqlmock.NewRows([]string{"id"})) // No ID returned
 
-		userID, err := r.CreateUser(userData)
+		userID, err := r.CreateUser(t.Context(), userData)
 
 		assert.Error(t, err)
 		assert.Equal(t, uuid.Nil, userID)
@@ -447,18 +1181,99 @@ func TestGetUser(t *testing.T) {
 	repo := &DBConnector{DB: sqlxDB, Logger: logger}
 	now := time.Now()
 
-	mock.ExpectQuery(`SELECT \* FROM users WHERE id = \$1`).
+	mock.ExpectQuery(`SELECT id, user_name, is_private, last_post_id, created_at, updated_at FROM users WHERE id = \$1`).
 		WithArgs("user-id-123").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "created_at", "updated_at"}).
 			AddRow("user-id-123", "alice", now, now))
 
-	user, err := repo.GetUser("user-id-123")
+	user, err := repo.GetUser(t.Context(), "user-id-123")
 
 	assert.NoError(t, err)
 	assert.Equal(t, "alice", user.Name)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestGetUserCredentials(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "sqlmock")
+	repo := &DBConnector{DB: sqlxDB, Logger: zap.NewNop()}
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, password FROM users WHERE email = \$1`).
+			WithArgs("alice@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow("user-id-123", "hash"))
+
+		creds, err := repo.GetUserCredentials(t.Context(), "alice@example.com")
+
+		assert.NoError(t, err)
+		assert.Equal(t, model.UserCredentials{ID: "user-id-123", PasswordHash: "hash"}, creds)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id, password FROM users WHERE email = \$1`).
+			WithArgs("nobody@example.com").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.GetUserCredentials(t.Context(), "nobody@example.com")
+
+		assert.Equal(t, model.ErrUserNotFound, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserProfile(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+	lastPostID := uuid.New()
+	profileColumns := []string{"id", "user_name", "created_at", "last_post_id", "follower_count", "followee_count"}
+
+	t.Run("with_last_post", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT u.id, u.user_name, u.is_private, u.created_at, u.last_post_id`).
+			WithArgs("user-id-123").
+			WillReturnRows(sqlmock.NewRows(profileColumns).AddRow("user-id-123", "alice", now, lastPostID.String(), 3, 2))
+		mock.ExpectQuery(`SELECT id, user_id, content, created_at, updated_at, deleted_at, in_reply_to, like_count, edited, edit_count, content_warning, version, kind, repost_of, COALESCE\(.*\) AS mentions FROM posts`).
+			WithArgs(lastPostID.String()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at", "deleted_at"}).
+				AddRow(lastPostID.String(), "user-id-123", "Hello!", now, now, nil))
+
+		profile, err := repo.GetUserProfile(t.Context(), "user-id-123")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", profile.Name)
+		assert.Equal(t, 3, profile.FollowerCount)
+		assert.Equal(t, 2, profile.FolloweeCount)
+		require.NotNil(t, profile.LastPost)
+		assert.Equal(t, "Hello!", profile.LastPost.Content)
+	})
+
+	t.Run("without_posts", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT u.id, u.user_name, u.is_private, u.created_at, u.last_post_id`).
+			WithArgs("user-id-123").
+			WillReturnRows(sqlmock.NewRows(profileColumns).AddRow("user-id-123", "alice", now, nil, 0, 0))
+
+		profile, err := repo.GetUserProfile(t.Context(), "user-id-123")
+
+		assert.NoError(t, err)
+		assert.Nil(t, profile.LastPost)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT u.id, u.user_name, u.is_private, u.created_at, u.last_post_id`).
+			WithArgs("user-id-404").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.GetUserProfile(t.Context(), "user-id-404")
+
+		assert.Equal(t, model.ErrUserNotFound, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestDeleteUser(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
@@ -470,12 +1285,59 @@ func TestDeleteUser(t *testing.T) {
 		WithArgs("user-id-123").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE posts SET like_count = like_count - 1 WHERE id IN \(SELECT post_id FROM likes WHERE user_id = \$1\)`).
+		WithArgs("user-id-123").
+		WillReturnResult(sqlmock.NewResult(0, 2))
 	mock.ExpectExec(`DELETE FROM users WHERE id = \$1`).
 		WithArgs("user-id-123").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.DeleteUser(t.Context(), "user-id-123")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetHashtagPosts(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM post_hashtags h JOIN posts p ON p.id = h.post_id WHERE h.tag = \$2 AND p.deleted_at IS NULL AND NOT EXISTS \( SELECT 1 FROM users au WHERE au.id = p.user_id AND au.is_private = TRUE AND au.id <> \$1 .* SELECT muted_id FROM mutes WHERE muter_id = \$1 \) AND \(h.created_at, h.post_id\) < \(\$3, \$4\) ORDER BY h.created_at DESC, h.post_id DESC LIMIT \$5`).
+		WithArgs("user-id-123", "golang", now, uuid.Nil.String(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at"}).
+			AddRow(uuid.New(), "user-id-456", "#golang rocks", now, now))
+
+	posts, err := repo.GetHashtagPosts(t.Context(), "golang", model.TimelineRequest{UserID: "user-id-123", Before: now, Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Len(t, posts.Posts, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMentions(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	now := time.Now()
+	userID := uuid.New().String()
+	viewerID := uuid.New().String()
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$1\)`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM posts p WHERE p.id IN \(SELECT post_id FROM post_mentions WHERE user_id = \$2\) AND p.deleted_at IS NULL AND NOT EXISTS \( SELECT 1 FROM users au WHERE au.id = p.user_id AND au.is_private = TRUE AND au.id <> \$1 .* AND \(p.created_at, p.id\) < \(\$3, \$4\)`).
+		WithArgs(viewerID, userID, now, uuid.Nil.String(), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "updated_at", "mentions"}).
+			AddRow(uuid.New(), "user-id-456", "hi @alice", now, now, []byte(`[{"offset": 3, "length": 6, "user_id": "`+userID+`"}]`)))
 
-	err := repo.DeleteUser("user-id-123")
+	posts, err := repo.GetMentions(t.Context(), model.TimelineRequest{UserID: userID, ViewerID: viewerID, Before: now, Limit: 10})
 
 	assert.NoError(t, err)
+	require.Len(t, posts.Posts, 1)
+	assert.Equal(t, userID, posts.Posts[0].Mentions[0].UserID)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"microblogging/model"
+
+	"go.uber.org/zap"
+)
+
+// The posts of a private account are only shown to the account itself and to its active followers.
+// Following a private account creates a pending request (follows.is_pending) that the followee
+// approves, which activates the follow, or rejects.
+
+// privateShared drops the reposts and quotes, aliased post, of posts written by a private account
+// that viewer does not follow. viewer is the placeholder of the reader.
+func privateShared(post, viewer string) string {
+	return fmt.Sprintf(`
+	AND NOT EXISTS (
+		SELECT 1 FROM posts o
+		JOIN users ou ON ou.id = o.user_id
+		WHERE o.id = %[1]s.repost_of
+		AND ou.is_private = TRUE
+		AND ou.id <> %[2]s
+		AND NOT EXISTS (
+			SELECT 1 FROM follows vf
+			WHERE vf.follower_id = %[2]s AND vf.followee_id = ou.id AND vf.is_active = TRUE
+		)
+	)`, post, viewer)
+}
+
+// timelinePrivate is privateShared for the timeline queries, $1 is the reader
+var timelinePrivate = privateShared("p", "$1")
+
+// privateAuthor drops the posts, aliased post, written by a private account that viewer does not
+// follow. Timelines only read followees and do not need it, feeds open to any reader do.
+func privateAuthor(post, viewer string) string {
+	return fmt.Sprintf(`
+	AND NOT EXISTS (
+		SELECT 1 FROM users au
+		WHERE au.id = %[1]s.user_id
+		AND au.is_private = TRUE
+		AND au.id <> %[2]s
+		AND NOT EXISTS (
+			SELECT 1 FROM follows vf
+			WHERE vf.follower_id = %[2]s AND vf.followee_id = au.id AND vf.is_active = TRUE
+		)
+	)`, post, viewer)
+}
+
+// feedHidden keeps the posts of the hashtag and mention feeds, and of threads, that $1 may read,
+// from users $1 did not block or mute and who did not block $1
+var feedHidden = privateAuthor("p", "$1") + timelinePrivate + timelineHidden
+
+// CanViewPosts reports whether viewerID may read the posts of authorID
+func (r *DBConnector) CanViewPosts(ctx context.Context, viewerID, authorID string) (bool, error) {
+	var visible bool
+	query := `
+		SELECT u.id = $1 OR u.is_private = FALSE OR EXISTS (
+			SELECT 1 FROM follows f
+			WHERE f.follower_id = $1 AND f.followee_id = u.id AND f.is_active = TRUE
+		)
+		FROM users u
+		WHERE u.id = $2;
+	`
+	if err := r.db().QueryRowContext(ctx, query, viewerID, authorID).Scan(&visible); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, model.ErrUserNotFound
+		}
+		r.Logger.Sugar().Errorw("Error checking post visibility", "error", err, "user_id", viewerID, "author_id", authorID)
+		return false, err
+	}
+	return visible, nil
+}
+
+// SetPrivate makes userID private or public. Going public approves every pending follow request.
+func (r *DBConnector) SetPrivate(ctx context.Context, userID string, private bool) error {
+	const updateQuery = `UPDATE users SET is_private = $2, updated_at = $3 WHERE id = $1;`
+	const approveQuery = `
+		UPDATE follows
+		SET is_active = TRUE, is_pending = FALSE
+		WHERE followee_id = $1 AND is_pending = TRUE
+		RETURNING follower_id;
+	`
+	var approved []string
+	err := r.withTx(ctx, func(tx *DBConnector) error {
+		res, err := tx.db().ExecContext(ctx, updateQuery, userID, private, time.Now().UTC())
+		if err != nil {
+			r.Logger.Sugar().Errorw("Error updating account privacy", "error", err, "user_id", userID)
+			return err
+		}
+		if updated, err := res.RowsAffected(); err != nil {
+			return err
+		} else if updated == 0 {
+			return model.ErrUserNotFound
+		}
+
+		if private {
+			return nil
+		}
+		if err := tx.db().SelectContext(ctx, &approved, approveQuery, userID); err != nil {
+			r.Logger.Sugar().Errorw("Error approving follow requests", "error", err, "user_id", userID)
+			return err
+		}
+		if r.Fanout != nil {
+			tx.afterCommit(func() {
+				for _, followerID := range approved {
+					r.Fanout.enqueueFollow(followerID, userID)
+				}
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.Logger.Sugar().Infow("Account privacy updated", "user_id", userID, "is_private", private, "approved", len(approved))
+	return nil
+}
+
+// GetFollowRequests returns the users waiting for req.UserID to approve their follow, using keyset
+// pagination on user id
+func (r *DBConnector) GetFollowRequests(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	var requesters []model.UserSummary
+	query := `SELECT u.id, u.user_name
+			  FROM follows f
+			  JOIN users u ON u.id = f.follower_id
+			  WHERE f.followee_id = $1
+			  AND f.is_pending = TRUE
+			  AND u.id > $2
+			  ORDER BY u.id
+			  LIMIT $3`
+	if err := r.db().SelectContext(ctx, &requesters, query, req.UserID, keysetAfter(req.After), req.Limit+1); err != nil {
+		r.Logger.Error("Error getting follow requests", zap.Error(err))
+		return model.FollowListResponse{}, err
+	}
+	return newFollowListResponse(requesters, req.Limit), nil
+}
+
+// ApproveFollowRequest turns the pending follow of followeeID by followerID into an active follow.
+// The followee is not notified of a follow it approved.
+func (r *DBConnector) ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	const approveQuery = `
+		UPDATE follows
+		SET is_active = TRUE, is_pending = FALSE
+		WHERE follower_id = $1 AND followee_id = $2 AND is_pending = TRUE;
+	`
+	res, err := r.db().ExecContext(ctx, approveQuery, followerID, followeeID)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error approving follow request", "error", err, "user_id", followeeID, "follower_id", followerID)
+		return err
+	}
+	if approved, err := res.RowsAffected(); err != nil {
+		return err
+	} else if approved == 0 {
+		return model.ErrNoFollowRequest
+	}
+	if r.Fanout != nil {
+		r.Fanout.enqueueFollow(followerID, followeeID)
+	}
+	return nil
+}
+
+// RejectFollowRequest drops the pending follow of followeeID by followerID
+func (r *DBConnector) RejectFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	const rejectQuery = `
+		UPDATE follows
+		SET is_pending = FALSE
+		WHERE follower_id = $1 AND followee_id = $2 AND is_pending = TRUE;
+	`
+	res, err := r.db().ExecContext(ctx, rejectQuery, followerID, followeeID)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error rejecting follow request", "error", err, "user_id", followeeID, "follower_id", followerID)
+		return err
+	}
+	if rejected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rejected == 0 {
+		return model.ErrNoFollowRequest
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"testing"
+
+	"microblogging/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCanViewPosts(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT u.id = \$1 OR u.is_private = FALSE OR EXISTS \( SELECT 1 FROM follows f WHERE f.follower_id = \$1 AND f.followee_id = u.id AND f.is_active = TRUE \) FROM users u WHERE u.id = \$2`).
+		WithArgs("user1", "user2").
+		WillReturnRows(sqlmock.NewRows([]string{"visible"}).AddRow(false))
+	mock.ExpectQuery(`FROM users u WHERE u.id = \$2`).
+		WithArgs("user1", "user3").
+		WillReturnRows(sqlmock.NewRows([]string{"visible"}))
+
+	visible, err := repo.CanViewPosts(t.Context(), "user1", "user2")
+	assert.NoError(t, err)
+	assert.False(t, visible)
+	_, err = repo.CanViewPosts(t.Context(), "user1", "user3")
+	assert.Equal(t, model.ErrUserNotFound, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetPrivate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET is_private = \$2, updated_at = \$3 WHERE id = \$1`).
+		WithArgs("user1", false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`UPDATE follows SET is_active = TRUE, is_pending = FALSE WHERE followee_id = \$1 AND is_pending = TRUE RETURNING follower_id`).
+		WithArgs("user1").
+		WillReturnRows(sqlmock.NewRows([]string{"follower_id"}).AddRow("user2"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET is_private`).
+		WithArgs("user3", true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	assert.NoError(t, repo.SetPrivate(t.Context(), "user1", false), "going public approves the pending requests")
+	assert.Equal(t, model.ErrUserNotFound, repo.SetPrivate(t.Context(), "user3", true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAnswerFollowRequest(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectExec(`UPDATE follows SET is_active = TRUE, is_pending = FALSE WHERE follower_id = \$1 AND followee_id = \$2 AND is_pending = TRUE`).
+		WithArgs("user2", "user1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE follows SET is_pending = FALSE WHERE follower_id = \$1 AND followee_id = \$2 AND is_pending = TRUE`).
+		WithArgs("user3", "user1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.ApproveFollowRequest(t.Context(), "user1", "user2"))
+	assert.Equal(t, model.ErrNoFollowRequest, repo.RejectFollowRequest(t.Context(), "user1", "user3"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetFollowRequests(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+	mock.ExpectQuery(`SELECT u.id, u.user_name FROM follows f JOIN users u ON u.id = f.follower_id WHERE f.followee_id = \$1 AND f.is_pending = TRUE`).
+		WithArgs("user1", "00000000-0000-0000-0000-000000000000", 11).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_name"}).AddRow("user2", "bob"))
+
+	requests, err := repo.GetFollowRequests(t.Context(), model.FollowListRequest{UserID: "user1", Limit: 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserSummary{{ID: "user2", Name: "bob"}}, requests.Users)
+	assert.Empty(t, requests.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,75 +1,95 @@
 package repository
 
 import (
+	"context"
+
 	"microblogging/model"
 
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
-	"go.uber.org/zap"
 )
 
 type PostRepository interface {
-	Save(post *model.Post) (uuid.UUID, error)
-	GetTimeline(info model.TimelineRequest) (model.TimelineResponse, error)
-	FollowUser(followerID, followeeID string) error
-	UnfollowUser(followerID, followeeID string) error
-	GetFollowees(userID string, limit int) ([]string, error)
-	CreateUser(userData model.CreateUserRequest) (uuid.UUID, error)
-	UpdatePostPut(post model.CreatePostRequest) error
-	DeleteUser(userID string) error
-	GetUser(userID string) (model.User, error)
-}
-
-type postRepo struct {
-	db     *sqlx.DB
-	logger *zap.Logger
-}
-
-// UpdatePostPut implements PostRepository.
-func (p *postRepo) UpdatePostPut(post model.CreatePostRequest) error {
-	panic("unimplemented")
-}
-
-// FollowUser implements PostRepository.
-func (p *postRepo) FollowUser(followerID string, followeeID string) error {
-	panic("unimplemented")
-}
-
-// // UnfollowUser implements PostRepository.
-func (p *postRepo) UnfollowUser(followerID string, followeeID string) error {
-	panic("unimplemented")
-}
-
-// GetFollowees implements PostRepository.
-func (p *postRepo) GetFollowees(userID string, limit int) ([]string, error) {
-	panic("unimplemented")
-}
-
-// GetTimeline implements PostRepository.
-func (p *postRepo) GetTimeline(info model.TimelineRequest) (model.TimelineResponse, error) {
-	panic("unimplemented")
-}
-
-// Save implements PostRepository.
-func (p *postRepo) Save(post *model.Post) (uuid.UUID, error) {
-	panic("unimplemented")
+	Save(ctx context.Context, post *model.Post) (uuid.UUID, error)
+	GetTimeline(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error)
+	GetPost(ctx context.Context, postID string) (model.Post, error)
+	GetPostRevisions(ctx context.Context, postID string) ([]model.PostRevision, error)
+	GetUserPosts(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error)
+	GetHashtagPosts(ctx context.Context, tag string, info model.TimelineRequest) (model.TimelineResponse, error)
+	GetMentions(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error)
+	GetAncestors(ctx context.Context, viewerID, postID string) ([]model.Post, error)
+	GetReplies(ctx context.Context, req model.ThreadRequest) ([]model.Post, error)
+	FollowUser(ctx context.Context, followerID, followeeID string) (string, bool, error)
+	UnfollowUser(ctx context.Context, followerID, followeeID string) error
+	GetFollowees(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error)
+	GetFollowers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error)
+	FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error)
+	ReadersAmong(ctx context.Context, postID string, userIDs []string) ([]string, error)
+	GetFollowRequests(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error)
+	ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error
+	RejectFollowRequest(ctx context.Context, followeeID, followerID string) error
+	SetPrivate(ctx context.Context, userID string, private bool) error
+	CanViewPosts(ctx context.Context, viewerID, authorID string) (bool, error)
+	BlockUser(ctx context.Context, blockerID, blockedID string) error
+	UnblockUser(ctx context.Context, blockerID, blockedID string) error
+	GetBlockedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error)
+	Blocked(ctx context.Context, userID, otherID string) (bool, error)
+	MuteUser(ctx context.Context, muterID, mutedID string) error
+	UnmuteUser(ctx context.Context, muterID, mutedID string) error
+	GetMutedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error)
+	Muted(ctx context.Context, muterID, mutedID string) (bool, error)
+	CreateUser(ctx context.Context, userData model.CreateUserRequest) (uuid.UUID, error)
+	UpdatePostPut(ctx context.Context, post model.CreatePostRequest) error
+	PatchPost(ctx context.Context, post model.PatchPostRequest) (int, error)
+	DeletePost(ctx context.Context, postID, userID string) error
+	LikePost(ctx context.Context, userID, postID string) (bool, error)
+	UnlikePost(ctx context.Context, userID, postID string) (bool, error)
+	DeleteUser(ctx context.Context, userID string) error
+	GetUser(ctx context.Context, userID string) (model.User, error)
+	GetUserProfile(ctx context.Context, userID string) (model.UserProfile, error)
+	GetUserCredentials(ctx context.Context, email string) (model.UserCredentials, error)
+	GetNotifications(ctx context.Context, info model.TimelineRequest) ([]model.NotificationGroup, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int, error)
+	MarkNotificationsRead(ctx context.Context, userID string, ids []string) (int, error)
+	// WithTx runs fn with a repository whose operations commit together when fn returns nil and are
+	// rolled back when it returns an error
+	WithTx(ctx context.Context, fn func(repo PostRepository) error) error
 }
 
-// CreateUser implements PostRepository.
-func (p *postRepo) CreateUser(userData model.CreateUserRequest) (uuid.UUID, error) {
-	panic("unimplemented")
+// keysetAfter returns the lower bound of a page ordered by user id, the nil UUID sorts before any id
+func keysetAfter(after string) string {
+	if after == "" {
+		return uuid.Nil.String()
+	}
+	return after
 }
 
-// DeleteUser implements PostRepository.
-func (p *postRepo) DeleteUser(userID string) error {
-	panic("unimplemented")
+// cursorPostID returns the id half of a (created_at, id) cursor. Without a cursor id the nil UUID
+// is used, so that (created_at, id) < (before, nil) only keeps posts created before "before".
+func cursorPostID(postID string) string {
+	if postID == "" {
+		return uuid.Nil.String()
+	}
+	return postID
 }
 
-// GetUser implements PostRepository.
-func (p *postRepo) GetUser(userID string) (model.User, error) {
-	panic("unimplemented")
+// sinceCursorPostID is the counterpart of cursorPostID for (created_at, id) > (after, id). Without a
+// cursor id the max UUID is used, so only posts created after "after" are kept.
+func sinceCursorPostID(postID string) string {
+	if postID == "" {
+		return uuid.Max.String()
+	}
+	return postID
 }
 
-func NewPostRepository(db *sqlx.DB, logger *zap.Logger) PostRepository {
-	return &postRepo{db: db, logger: logger}
+// newFollowListResponse trims a page fetched with limit+1 rows and sets the cursor of the next page
+func newFollowListResponse(users []model.UserSummary, limit int) model.FollowListResponse {
+	resp := model.FollowListResponse{Users: users}
+	if len(users) > limit {
+		resp.Users = users[:limit]
+		resp.NextCursor = resp.Users[limit-1].ID
+	}
+	if resp.Users == nil {
+		resp.Users = []model.UserSummary{}
+	}
+	return resp
 }
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"microblogging/model"
+
+	"github.com/google/uuid"
+)
+
+// Editing a post copies its current content to post_revisions before replacing it, so every
+// previous version can be read back in order.
+
+// saveRevision keeps the current content of postID as its next revision, dated when that content
+// was written. The row is locked until the unit of work of r ends so concurrent edits number their
+// revisions one after the other.
+func (r *DBConnector) saveRevision(ctx context.Context, postID uuid.UUID, userID string) error {
+	const revisionQuery = `
+		INSERT INTO post_revisions (post_id, revision, content, created_at)
+		SELECT id, edit_count + 1, content, content_updated_at
+		FROM posts
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE;
+	`
+	res, err := r.db().ExecContext(ctx, revisionQuery, postID, userID)
+	if err != nil {
+		r.Logger.Sugar().Errorw("Error saving post revision", "error", err, "post_id", postID.String())
+		return err
+	}
+	if saved, err := res.RowsAffected(); err != nil {
+		return err
+	} else if saved == 0 {
+		// the post was deleted since it was checked
+		return model.ErrPostNotFound
+	}
+	return nil
+}
+
+// GetPostRevisions returns the previous contents of postID, oldest first
+func (r *DBConnector) GetPostRevisions(ctx context.Context, postID string) ([]model.PostRevision, error) {
+	revisions := []model.PostRevision{}
+	const query = `
+		SELECT post_id, revision, content, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY revision
+	`
+	if err := r.db().SelectContext(ctx, &revisions, query, postID); err != nil {
+		r.Logger.Sugar().Errorw("Error getting post revisions", "error", err, "post_id", postID)
+		return nil, err
+	}
+	return revisions, nil
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestGetPostRevisions(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+	createdAt := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT post_id, revision, content, created_at FROM post_revisions WHERE post_id = \$1 ORDER BY revision`).
+		WithArgs("post1").
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "revision", "content", "created_at"}).
+			AddRow("post1", 1, "first", createdAt).
+			AddRow("post1", 2, "second", createdAt.Add(time.Minute)))
+	mock.ExpectQuery(`FROM post_revisions`).
+		WithArgs("post2").
+		WillReturnRows(sqlmock.NewRows([]string{"post_id", "revision", "content", "created_at"}))
+
+	revisions, err := repo.GetPostRevisions(t.Context(), "post1")
+	assert.NoError(t, err)
+	assert.Equal(t, []model.PostRevision{
+		{PostID: "post1", Revision: 1, Content: "first", CreatedAt: createdAt},
+		{PostID: "post1", Revision: 2, Content: "second", CreatedAt: createdAt.Add(time.Minute)},
+	}, revisions)
+	revisions, err = repo.GetPostRevisions(t.Context(), "post2")
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+	assert.NotNil(t, revisions, "posts never edited have an empty list of revisions")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// queryer runs the statements of a DBConnector, *sqlx.DB outside of a unit of work and the
+// *sqlx.Tx of the unit of work inside it
+type queryer interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// unitOfWork is the transaction of a WithTx call. The side effects registered with afterCommit
+// only run once its writes committed.
+type unitOfWork struct {
+	tx    *sqlx.Tx
+	hooks []func()
+}
+
+// db returns where the statements of r run
+func (r *DBConnector) db() queryer {
+	if r.unit != nil {
+		return r.unit.tx
+	}
+	return r.DB
+}
+
+// afterCommit registers fn to run once the unit of work of r is committed, it is dropped on
+// rollback. It is meant for the work that lives outside the database, such as waking up the
+// fan-out worker. Outside of a unit of work fn runs right away.
+func (r *DBConnector) afterCommit(fn func()) {
+	if r.unit == nil {
+		fn()
+		return
+	}
+	r.unit.hooks = append(r.unit.hooks, fn)
+}
+
+// WithTx runs fn with a repository whose operations all run in one transaction, which is committed
+// when fn returns nil and rolled back when it returns an error or when ctx is done first. Called
+// on the repository of a unit of work, WithTx joins it.
+func (r *DBConnector) WithTx(ctx context.Context, fn func(repo PostRepository) error) error {
+	return r.withTx(ctx, func(tx *DBConnector) error { return fn(tx) })
+}
+
+// withTx is WithTx for the operations of DBConnector, fn gets the connector bound to the transaction
+func (r *DBConnector) withTx(ctx context.Context, fn func(tx *DBConnector) error) error {
+	if r.unit != nil {
+		return fn(r)
+	}
+	sqlTx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		r.Logger.Error("Error starting transaction", zap.Error(err))
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	tx := &DBConnector{DB: r.DB, Logger: r.Logger, Fanout: r.Fanout, unit: &unitOfWork{tx: sqlTx}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := sqlTx.Commit(); err != nil {
+		r.Logger.Error("Error committing transaction", zap.Error(err))
+		return err
+	}
+	for _, hook := range tx.unit.hooks {
+		hook()
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWithTx(t *testing.T) {
+	errWork := errors.New("work failed")
+	tests := []struct {
+		name      string
+		setupMock func(mock sqlmock.Sqlmock)
+		work      error
+		wantErr   error
+		committed bool
+	}{
+		{
+			name: "commits and runs the after commit hooks",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE users`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			committed: true,
+		},
+		{
+			name: "rolls back when the work fails",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE users`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectRollback()
+			},
+			work:    errWork,
+			wantErr: errWork,
+		},
+		{
+			name: "commit error skips the hooks",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE users`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit().WillReturnError(sql.ErrConnDone)
+			},
+			wantErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+			tt.setupMock(mock)
+
+			committed := false
+			err = repo.withTx(t.Context(), func(tx *DBConnector) error {
+				if _, err := tx.db().ExecContext(t.Context(), `UPDATE users SET updated_at = NOW()`); err != nil {
+					return err
+				}
+				tx.afterCommit(func() { committed = true })
+				return tt.work
+			})
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.committed, committed)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestWithTxJoinsRepositoryOperations(t *testing.T) {
+	const aliceID, bobID = "alice-id", "bob-id"
+	expectDeleteUser := func(mock sqlmock.Sqlmock, userID string) *sqlmock.ExpectedExec {
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM users WHERE id = \$1\)`).
+			WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`UPDATE posts SET like_count = like_count - 1`).
+			WithArgs(userID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		return mock.ExpectExec(`DELETE FROM users WHERE id = \$1`).WithArgs(userID)
+	}
+	deleteBoth := func(repo PostRepository) error {
+		if err := repo.DeleteUser(t.Context(), aliceID); err != nil {
+			return err
+		}
+		return repo.DeleteUser(t.Context(), bobID)
+	}
+
+	t.Run("commits once", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+		repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+		mock.ExpectBegin()
+		expectDeleteUser(mock, aliceID).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectDeleteUser(mock, bobID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, repo.WithTx(t.Context(), deleteBoth))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back every operation", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+		repo := &DBConnector{DB: sqlx.NewDb(db, "sqlmock"), Logger: zap.NewNop()}
+
+		mock.ExpectBegin()
+		expectDeleteUser(mock, aliceID).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectDeleteUser(mock, bobID).WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
+
+		assert.ErrorIs(t, repo.WithTx(t.Context(), deleteBoth), sql.ErrConnDone)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	m "microblogging/model"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const userIDKey contextKey = iota
+
+// ContextWithUserID returns a copy of ctx carrying the authenticated user ID
+func ContextWithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user ID stored by Authenticate
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	return userID, ok && userID != ""
+}
+
+// Authenticate verifies the bearer token of the request and stores the user ID in its context
+func (s *server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			RespondWithError(w, http.StatusUnauthorized, m.ErrMissingToken.Error())
+			return
+		}
+
+		userID, err := s.tokens.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			RespondWithError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithUserID(r.Context(), userID)))
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authorize returns the authenticated caller ID. A non empty claimedID coming from the request
+// body, path or query must match the caller, otherwise the request is rejected as forbidden.
+func authorize(r *http.Request, claimedID string) (string, error) {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		return "", m.ErrUnauthorized
+	}
+	if claimedID != "" && claimedID != userID {
+		return "", m.ErrForbidden
+	}
+	return userID, nil
+}
+
+func respondAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, m.ErrForbidden) {
+		RespondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	RespondWithError(w, http.StatusUnauthorized, err.Error())
+}
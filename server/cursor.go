@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/base64"
+	m "microblogging/model"
+	"strings"
+	"time"
+)
+
+// encodeCursor returns the opaque cursor pointing at a post in a (created_at, id) ordered page
+func encodeCursor(post m.Post) string {
+	return encodeKeyset(post.CreatedAt, post.ID)
+}
+
+// encodeKeyset returns the opaque cursor of any (created_at, id) ordered page
+func encodeKeyset(createdAt time.Time, id string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the created_at and post id encoded by encodeCursor
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", m.ErrInvalidCursor
+	}
+	createdAtStr, postID, ok := strings.Cut(string(raw), "|")
+	if !ok || !IsValidUUID(postID) {
+		return time.Time{}, "", m.ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return time.Time{}, "", m.ErrInvalidCursor
+	}
+	return createdAt, postID, nil
+}
+
+// sinceCursor returns the cursor of the newest post, used as the since parameter when polling for
+// newer posts. Polling results are oldest first; when a poll is empty the current cursor is kept.
+func sinceCursor(posts []m.Post, ascending bool, current string) string {
+	if len(posts) == 0 {
+		if ascending {
+			return current
+		}
+		return ""
+	}
+	if ascending {
+		return encodeCursor(posts[len(posts)-1])
+	}
+	return encodeCursor(posts[0])
+}
+
+// nextCursor returns the cursor of the page after posts, or an empty string when posts is the last page
+func nextCursor(posts []m.Post, limit int) string {
+	if len(posts) == 0 || len(posts) < limit {
+		return ""
+	}
+	return encodeCursor(posts[len(posts)-1])
+}
+
+// nextNotificationsCursor returns the cursor of the page after groups, ordered by their newest notification
+func nextNotificationsCursor(groups []m.NotificationGroup, limit int) string {
+	if len(groups) == 0 || len(groups) < limit {
+		return ""
+	}
+	last := groups[len(groups)-1]
+	return encodeKeyset(last.CreatedAt, last.ID)
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// liveQueryTimeout bounds each query of the long lived requests, the timeline stream and the
+// websocket gateway, which are not served under a deadline
+const liveQueryTimeout = 5 * time.Second
+
+// WithDeadline serves next under a deadline of timeout. The context of the request, and with it
+// every query it makes, is cancelled once the deadline passes, the client goes away or the server
+// shuts down.
+func (s *server) WithDeadline(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		stop := context.AfterFunc(s.ctx, cancel)
+		defer stop()
+
+		next(w, r.WithContext(ctx))
+	}
+}
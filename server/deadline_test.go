@@ -0,0 +1,66 @@
+package server_test
+
+import (
+	"context"
+	"microblogging/model"
+	"microblogging/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWithDeadline(t *testing.T) {
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const postID = "550e8400-e29b-41d4-a716-446655440001"
+
+	t.Run("Request Context Has The Deadline", func(t *testing.T) {
+		mockSvc := new(MockService)
+		s := server.NewServer(context.Background(), mockSvc, testTokens)
+		withDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+			deadline, ok := ctx.Deadline()
+			return ok && time.Until(deadline) <= time.Second
+		})
+		mockSvc.On("GetPost", withDeadline, userID, postID).Return(model.Post{ID: postID}, nil)
+
+		req := withUser(httptest.NewRequest(http.MethodGet, "/posts/"+postID, nil), userID)
+		req = mux.SetURLVars(req, map[string]string{"id": postID})
+		w := httptest.NewRecorder()
+		s.WithDeadline(time.Second, s.GetPostHandler)(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("Server Shutdown Cancels The Request", func(t *testing.T) {
+		ctx, shutdown := context.WithCancel(context.Background())
+		s := server.NewServer(ctx, new(MockService), testTokens)
+
+		var err error
+		req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+		s.WithDeadline(time.Minute, func(w http.ResponseWriter, r *http.Request) {
+			shutdown()
+			<-r.Context().Done()
+			err = r.Context().Err()
+		})(httptest.NewRecorder(), req)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Deadline Expires", func(t *testing.T) {
+		s := server.NewServer(context.Background(), new(MockService), testTokens)
+
+		var err error
+		req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+		s.WithDeadline(time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			err = r.Context().Err()
+		})(httptest.NewRecorder(), req)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	m "microblogging/model"
+	"strconv"
+	"strings"
+)
+
+// etag returns the strong ETag of a post version
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseIfMatch returns the versions the If-Match header lines accept, nil when the header is missing
+// or is "*" and matches any version. The header is a comma separated list of entity tags; weak tags
+// and tags that are not a version never match a post, a list with no version left or that cannot
+// be parsed is reported as a version mismatch.
+func parseIfMatch(lines []string) ([]int, error) {
+	header := strings.TrimSpace(strings.Join(lines, ","))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	versions := []int{}
+	for rest := header; ; {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+		weak := strings.HasPrefix(rest, "W/")
+		rest = strings.TrimPrefix(rest, "W/")
+		// an entity tag is an opaque quoted string without escapes, it may contain commas
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, m.ErrVersionMismatch
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return nil, m.ErrVersionMismatch
+		}
+		tag := rest[1 : end+1]
+		rest = strings.TrimLeft(rest[end+2:], " \t")
+		if rest != "" && rest[0] != ',' {
+			return nil, m.ErrVersionMismatch
+		}
+		// If-Match compares tags strongly, a weak tag never matches
+		if version, err := strconv.Atoi(tag); err == nil && version > 0 && !weak {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, m.ErrVersionMismatch
+	}
+	return versions, nil
+}
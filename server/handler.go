@@ -2,9 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	m "microblogging/model"
 	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
@@ -32,17 +35,34 @@ func (s *server) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(w, http.StatusBadRequest, m.ErrContentTooLong.Error())
 		return
 	}
+	userID, err := authorize(r, req.UserID)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
 
-	id, err := s.Svc.CreatePost(req.UserID, req.Content)
+	id, err := s.Svc.CreatePost(r.Context(), userID, req)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("could not create post: %v", err))
+		switch {
+		case errors.Is(err, m.ErrParentNotFound), errors.Is(err, m.ErrSharedPostNotFound):
+			RespondWithError(w, http.StatusNotFound, err.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("could not create post: %v", err))
+		}
 		return
 	}
 
-	RespondWithSuccess(w, http.StatusCreated, "post created", map[string]interface{}{
-		"user_id": req.UserID,
+	data := map[string]interface{}{
+		"user_id": userID,
 		"post_id": id,
-	})
+	}
+	if req.InReplyTo != "" {
+		data["in_reply_to"] = req.InReplyTo
+	}
+	if req.QuoteOf != "" {
+		data["quote_of"] = req.QuoteOf
+	}
+	RespondWithSuccess(w, http.StatusCreated, "post created", data)
 }
 
 func (s *server) UpdatePostPutHandler(w http.ResponseWriter, r *http.Request) {
@@ -64,76 +84,640 @@ func (s *server) UpdatePostPutHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(w, http.StatusBadRequest, m.ErrContentTooLong.Error())
 		return
 	}
-	err := s.Svc.UpdatePostPut(req)
+	userID, err := authorize(r, req.UserID)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %s", m.ErrCouldNotUpdate.Error(), err.Error()))
+		respondAuthError(w, err)
+		return
+	}
+
+	err = s.Svc.UpdatePostPut(r.Context(), userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, m.ErrPostNotFound):
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+		case errors.Is(err, m.ErrEditWindowExpired):
+			RespondWithError(w, http.StatusForbidden, m.ErrEditWindowExpired.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %s", m.ErrCouldNotUpdate.Error(), err.Error()))
+		}
 		return
 	}
 
 	RespondWithSuccess(w, http.StatusOK, "post updated", map[string]interface{}{
-		"user_id": req.UserID,
+		"user_id": userID,
 		"post_id": req.PostID,
 	})
 }
 
-func (s *server) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// PatchPostHandler applies a partial update to a post of the authenticated user. With an If-Match
+// header the update only applies to the versions of the post it names.
+func (s *server) PatchPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	postID := mux.Vars(r)["id"]
+	if !IsValidUUID(postID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	var req m.PatchPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidJSON.Error())
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.PostID = postID
+	req.Versions, err = parseIfMatch(r.Header.Values("If-Match"))
+	if err != nil {
+		RespondWithError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+
+	version, err := s.Svc.PatchPost(r.Context(), userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, m.ErrEmptyPatch):
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, m.ErrPostNotFound):
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+		case errors.Is(err, m.ErrEditWindowExpired):
+			RespondWithError(w, http.StatusForbidden, m.ErrEditWindowExpired.Error())
+		case errors.Is(err, m.ErrVersionMismatch):
+			RespondWithError(w, http.StatusPreconditionFailed, m.ErrVersionMismatch.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %s", m.ErrCouldNotUpdate.Error(), err.Error()))
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(version))
+	RespondWithSuccess(w, http.StatusOK, "post updated", map[string]interface{}{
+		"user_id": userID,
+		"post_id": postID,
+		"version": version,
+	})
+}
+
+func (s *server) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	postID := mux.Vars(r)["id"]
+	if postID == "" {
+		RespondWithError(w, http.StatusBadRequest, m.ErrMissingPostID.Error())
+		return
+	}
+	if !IsValidUUID(postID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	err = s.Svc.DeletePost(r.Context(), userID, postID)
+	if err != nil {
+		if errors.Is(err, m.ErrPostNotFound) {
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to delete post: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "post deleted", map[string]interface{}{
+		"user_id": userID,
+		"post_id": postID,
+	})
+}
+
+func (s *server) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	var req m.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidRequest.Error())
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidJSON.Error())
+		return
+	}
+
+	user, err := s.Svc.CreateUser(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, m.ErrInvalidUsername) {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, m.ErrCouldNotCreateUser.Error())
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusCreated, "user created", map[string]interface{}{
+		"user_id": user,
+	})
+}
+
+func (s *server) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	var req m.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidRequest.Error())
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidJSON.Error())
+		return
+	}
+
+	userID, err := s.Svc.Login(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, m.ErrInvalidCredentials) {
+			RespondWithError(w, http.StatusUnauthorized, m.ErrInvalidCredentials.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("could not log in: %v", err))
+		return
+	}
+
+	token, expiresAt, err := s.tokens.Issue(userID)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("could not issue token: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "user logged in", map[string]interface{}{
+		"user_id":    userID,
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expiresAt,
+	})
+}
+
+func (s *server) GetTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	userID, err := authorize(r, query.Get("user_id"))
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	limitStr := query.Get("limit")
+	beforeStr := query.Get("before")
+	cursorStr := query.Get("cursor")
+	sinceStr := query.Get("since")
+
+	req, err := loadTimelineParams(userID, limitStr, beforeStr, cursorStr, sinceStr)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := s.Svc.GetTimeline(r.Context(), req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, m.ErrCouldNotGetTimeline.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"user_id":      req.UserID,
+		"posts":        posts.Posts,
+		"since_cursor": sinceCursor(posts.Posts, req.Since(), sinceStr),
+	}
+	if !req.Since() {
+		data["next_cursor"] = nextCursor(posts.Posts, req.Limit)
+	}
+	RespondWithSuccess(w, http.StatusOK, "Timeline info", data)
+}
+
+func (s *server) GetPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	postID := mux.Vars(r)["id"]
+	if !IsValidUUID(postID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	post, err := s.Svc.GetPost(r.Context(), userID, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, m.ErrPostNotFound):
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+		case errors.Is(err, m.ErrPostDeleted):
+			RespondWithError(w, http.StatusGone, m.ErrPostDeleted.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get post: %v", err))
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(post.Version))
+	RespondWithSuccess(w, http.StatusOK, "Post info", map[string]interface{}{
+		"post": post,
+	})
+}
+
+// GetPostRevisionsHandler returns the previous contents of an edited post, oldest first
+func (s *server) GetPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	postID := mux.Vars(r)["id"]
+	if !IsValidUUID(postID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	revisions, err := s.Svc.GetPostRevisions(r.Context(), userID, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, m.ErrPostNotFound):
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+		case errors.Is(err, m.ErrPostDeleted):
+			RespondWithError(w, http.StatusGone, m.ErrPostDeleted.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get post revisions: %v", err))
+		}
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Post revisions", map[string]interface{}{
+		"post_id":   postID,
+		"revisions": revisions,
+	})
+}
+
+// RepostHandler shares a post as is on behalf of the authenticated user
+func (s *server) RepostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	postID := mux.Vars(r)["id"]
+	if !IsValidUUID(postID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	id, err := s.Svc.Repost(r.Context(), userID, postID)
+	if err != nil {
+		switch {
+		case errors.Is(err, m.ErrSharedPostNotFound):
+			RespondWithError(w, http.StatusNotFound, m.ErrSharedPostNotFound.Error())
+		case errors.Is(err, m.ErrAlreadyReposted):
+			RespondWithError(w, http.StatusConflict, m.ErrAlreadyReposted.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("could not repost: %v", err))
+		}
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusCreated, "post reposted", map[string]interface{}{
+		"user_id":   userID,
+		"post_id":   id,
+		"repost_of": postID,
+	})
+}
+
+// GetNotificationsHandler pages through the notification groups of the authenticated user, newest first
+func (s *server) GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	req, err := loadTimelineParams(userID, query.Get("limit"), query.Get("before"), query.Get("cursor"), "")
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notifications, err := s.Svc.GetNotifications(r.Context(), req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get notifications: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Notifications", map[string]interface{}{
+		"notifications": notifications.Notifications,
+		"unread_count":  notifications.UnreadCount,
+		"next_cursor":   nextNotificationsCursor(notifications.Notifications, req.Limit),
+	})
+}
+
+// ReadNotificationsHandler marks notification groups of the authenticated user as read.
+// An empty body or an empty ids list marks every notification read.
+func (s *server) ReadNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	var req m.ReadNotificationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidRequest.Error())
+		return
+	}
+	for _, id := range req.IDs {
+		if !IsValidUUID(id) {
+			RespondWithError(w, http.StatusBadRequest, m.ErrInvalidIDs.Error())
+			return
+		}
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	result, err := s.Svc.MarkNotificationsRead(r.Context(), userID, req.IDs)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to mark notifications read: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Notifications marked read", result)
+}
+
+// LikePostHandler likes a post for the authenticated user, POST likes and DELETE unlikes.
+// Both are idempotent.
+func (s *server) LikePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	postID := mux.Vars(r)["id"]
+	if !IsValidUUID(postID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	liked := r.Method == http.MethodPost
+	if liked {
+		err = s.Svc.LikePost(r.Context(), userID, postID)
+	} else {
+		err = s.Svc.UnlikePost(r.Context(), userID, postID)
+	}
+	if err != nil {
+		if errors.Is(err, m.ErrPostNotFound) {
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to update like: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "like updated", map[string]interface{}{
+		"user_id": userID,
+		"post_id": postID,
+		"liked":   liked,
+	})
+}
+
+// GetThreadHandler returns the conversation a post belongs to, with one page of its replies
+func (s *server) GetThreadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	req, err := loadThreadParams(mux.Vars(r)["id"], r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.ViewerID, err = authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	thread, err := s.Svc.GetThread(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, m.ErrPostNotFound):
+			RespondWithError(w, http.StatusNotFound, m.ErrPostNotFound.Error())
+		case errors.Is(err, m.ErrPostDeleted):
+			RespondWithError(w, http.StatusGone, m.ErrPostDeleted.Error())
+		default:
+			RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get thread: %v", err))
+		}
+		return
+	}
+
+	var next string
+	if thread.LastReply != nil {
+		next = encodeCursor(*thread.LastReply)
+	}
+	RespondWithSuccess(w, http.StatusOK, "Thread info", map[string]interface{}{
+		"root":        thread.Root,
+		"ancestors":   thread.Ancestors,
+		"post":        thread.Post,
+		"replies":     thread.Replies,
+		"next_cursor": next,
+	})
+}
+
+// loadThreadParams reads the limit (defaults to 50, max 100) and the cursor of the replies page
+func loadThreadParams(postID string, query url.Values) (m.ThreadRequest, error) {
+	if !IsValidUUID(postID) {
+		return m.ThreadRequest{}, m.ErrInvalidUUID
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		return m.ThreadRequest{}, err
+	}
+
+	req := m.ThreadRequest{PostID: postID, Limit: limit}
+	if cursor := query.Get("cursor"); cursor != "" {
+		req.After, req.AfterID, err = decodeCursor(cursor)
+		if err != nil {
+			return m.ThreadRequest{}, err
+		}
+	}
+	return req, nil
+}
+
+func (s *server) GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	req, err := loadTimelineParams(mux.Vars(r)["id"], query.Get("limit"), query.Get("before"), query.Get("cursor"), "")
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.ViewerID, err = authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	posts, err := s.Svc.GetUserPosts(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, m.ErrUserNotFound) {
+			RespondWithError(w, http.StatusNotFound, m.ErrUserNotFound.Error())
+			return
+		}
+		if errors.Is(err, m.ErrPrivateAccount) {
+			RespondWithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get user posts: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "User posts", map[string]interface{}{
+		"user_id":     req.UserID,
+		"posts":       posts.Posts,
+		"next_cursor": nextCursor(posts.Posts, req.Limit),
+	})
+}
+
+// GetMentionsHandler pages through the posts mentioning a user, newest first. Other users only
+// get the posts they may read themselves.
+func (s *server) GetMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
 		return
 	}
 
-	var req m.CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidRequest.Error())
+	query := r.URL.Query()
+	req, err := loadTimelineParams(mux.Vars(r)["id"], query.Get("limit"), query.Get("before"), query.Get("cursor"), "")
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	if err := validate.Struct(req); err != nil {
-		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidJSON.Error())
+	req.ViewerID, err = authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
 		return
 	}
 
-	user, err := s.Svc.CreateUser(req)
+	posts, err := s.Svc.GetMentions(r.Context(), req)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, m.ErrCouldNotCreateUser.Error())
+		if errors.Is(err, m.ErrUserNotFound) {
+			RespondWithError(w, http.StatusNotFound, m.ErrUserNotFound.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get mentions: %v", err))
 		return
 	}
 
-	RespondWithSuccess(w, http.StatusCreated, "user created", map[string]interface{}{
-		"user_id": user,
+	RespondWithSuccess(w, http.StatusOK, "User mentions", map[string]interface{}{
+		"user_id":     req.UserID,
+		"posts":       posts.Posts,
+		"next_cursor": nextCursor(posts.Posts, req.Limit),
 	})
 }
 
-func (s *server) GetTimelineHandler(w http.ResponseWriter, r *http.Request) {
+// GetHashtagPostsHandler pages through the posts tagged with the hashtag in the path, newest first
+func (s *server) GetHashtagPostsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
 		return
 	}
 
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
 	query := r.URL.Query()
-	userID := query.Get("user_id")
-	limitStr := query.Get("limit")
-	beforeStr := query.Get("before")
-
-	req, err := loadTimelineParams(userID, limitStr, beforeStr)
+	req, err := loadTimelineParams(userID, query.Get("limit"), query.Get("before"), query.Get("cursor"), "")
 	if err != nil {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	posts, err := s.Svc.GetTimeline(req)
+	tag := mux.Vars(r)["tag"]
+	posts, err := s.Svc.GetHashtagPosts(r.Context(), tag, req)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, m.ErrCouldNotGetTimeline.Error())
+		if errors.Is(err, m.ErrInvalidHashtag) {
+			RespondWithError(w, http.StatusBadRequest, m.ErrInvalidHashtag.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get hashtag posts: %v", err))
 		return
 	}
 
-	RespondWithSuccess(w, http.StatusOK, "Timeline info", map[string]interface{}{
-		"user_id": req.UserID,
-		"posts":   posts,
+	RespondWithSuccess(w, http.StatusOK, "Hashtag posts", map[string]interface{}{
+		"hashtag":     tag,
+		"posts":       posts.Posts,
+		"next_cursor": nextCursor(posts.Posts, req.Limit),
 	})
 }
 
-func loadTimelineParams(userID, limitStr, beforeStr string) (m.TimelineRequest, error) {
+// loadTimelineParams builds a timeline page request. The opaque cursor returned as next_cursor
+// takes precedence over the before timestamp, which defaults to now. A since cursor switches the
+// request to polling for newer posts and cannot be combined with either of them.
+func loadTimelineParams(userID, limitStr, beforeStr, cursorStr, sinceStr string) (m.TimelineRequest, error) {
 	var (
 		r        m.TimelineRequest
 		errGroup errgroup.Group
@@ -162,18 +746,43 @@ func loadTimelineParams(userID, limitStr, beforeStr string) (m.TimelineRequest,
 	})
 
 	errGroup.Go(func() error {
-		var before time.Time
-		if beforeStr != "" {
+		if sinceStr != "" {
+			if beforeStr != "" || cursorStr != "" {
+				return m.ErrSinceWithBefore
+			}
+			after, afterID, err := decodeCursor(sinceStr)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			r.After = after
+			r.AfterID = afterID
+			mu.Unlock()
+			return nil
+		}
+
+		var (
+			before   time.Time
+			beforeID string
+		)
+		if cursorStr != "" {
+			var err error
+			before, beforeID, err = decodeCursor(cursorStr)
+			if err != nil {
+				return err
+			}
+		} else if beforeStr != "" {
 			var err error
 			before, err = time.Parse(time.RFC3339, beforeStr)
 			if err != nil {
 				return fmt.Errorf("invalid before parameter: %v", err)
 			}
 		} else {
-			before = time.Now().AddDate(0, 0, -3)
+			before = time.Now()
 		}
 		mu.Lock()
 		r.Before = before
+		r.BeforeID = beforeID
 		mu.Unlock()
 		return nil
 	})
@@ -202,20 +811,36 @@ func (s *server) FollowUserHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	followerID, err := authorize(r, req.FollowerID)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	req.FollowerID = followerID
 
 	if req.FollowerID == req.FolloweeID {
 		RespondWithError(w, http.StatusBadRequest, m.ErrCanNotFollowSelf.Error())
 		return
 	}
-	err := s.Svc.FollowUser(req.FollowerID, req.FolloweeID)
+	state, err := s.Svc.FollowUser(r.Context(), req.FollowerID, req.FolloweeID)
+	if errors.Is(err, m.ErrUserBlocked) {
+		RespondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to follow user %v: %v", req.FolloweeID, err))
 		return
 	}
 
-	RespondWithSuccess(w, http.StatusOK, "user followed", map[string]interface{}{
+	// private accounts approve their followers, the follow is a pending request until then
+	status, message := http.StatusOK, "user followed"
+	if state == m.FollowPending {
+		status, message = http.StatusAccepted, "follow requested"
+	}
+	RespondWithSuccess(w, status, message, map[string]interface{}{
 		"user_id":  req.FollowerID,
 		"followee": req.FolloweeID,
+		"state":    state,
 	})
 }
 
@@ -235,13 +860,19 @@ func (s *server) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	followerID, err := authorize(r, req.FollowerID)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	req.FollowerID = followerID
 
 	if req.FollowerID == req.FolloweeID {
 		RespondWithError(w, http.StatusBadRequest, m.ErrCanNotUnfollowSelf.Error())
 		return
 	}
 
-	err := s.Svc.UnfollowUser(req.FollowerID, req.FolloweeID)
+	err = s.Svc.UnfollowUser(r.Context(), req.FollowerID, req.FolloweeID)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to unfollow user %v: %v", req.FolloweeID, err))
 		return
@@ -253,36 +884,383 @@ func (s *server) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *server) GetFolloweesHandler(w http.ResponseWriter, r *http.Request) {
+// BlockUserHandler blocks the user of the path for the authenticated user, POST blocks and DELETE
+// unblocks. Blocking removes the follows between both users. Both are idempotent.
+func (s *server) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	otherID := mux.Vars(r)["id"]
+	if !IsValidUUID(otherID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	blocked := r.Method == http.MethodPost
+	if blocked {
+		err = s.Svc.BlockUser(r.Context(), userID, otherID)
+	} else {
+		err = s.Svc.UnblockUser(r.Context(), userID, otherID)
+	}
+	if err != nil {
+		respondRelationError(w, err, "failed to update block")
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "block updated", map[string]interface{}{
+		"user_id": userID,
+		"target":  otherID,
+		"blocked": blocked,
+	})
+}
+
+// MuteUserHandler mutes the user of the path for the authenticated user, POST mutes and DELETE
+// unmutes. Both are idempotent.
+func (s *server) MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	otherID := mux.Vars(r)["id"]
+	if !IsValidUUID(otherID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	muted := r.Method == http.MethodPost
+	if muted {
+		err = s.Svc.MuteUser(r.Context(), userID, otherID)
+	} else {
+		err = s.Svc.UnmuteUser(r.Context(), userID, otherID)
+	}
+	if err != nil {
+		respondRelationError(w, err, "failed to update mute")
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "mute updated", map[string]interface{}{
+		"user_id": userID,
+		"target":  otherID,
+		"muted":   muted,
+	})
+}
+
+// respondRelationError answers a failed block or mute
+func respondRelationError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, m.ErrCanNotBlockSelf), errors.Is(err, m.ErrCanNotMuteSelf):
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, m.ErrUserNotFound):
+		RespondWithError(w, http.StatusNotFound, m.ErrUserNotFound.Error())
+	default:
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %v", message, err))
+	}
+}
+
+// GetBlockedUsersHandler pages through the users blocked by the authenticated user
+func (s *server) GetBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
 		return
 	}
 
-	vars := mux.Vars(r)
-	userID := vars["id"]
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	userID, err := authorize(r, "")
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, "invalid limit parameter")
+		respondAuthError(w, err)
 		return
 	}
-	if userID == "" {
-		RespondWithError(w, http.StatusBadRequest, m.ErrMissingUserID.Error())
+	req, err := loadFollowListParams(userID, r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	blocked, err := s.Svc.GetBlockedUsers(r.Context(), req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to fetch blocked users: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Got blocked users", map[string]interface{}{
+		"user_id":     req.UserID,
+		"blocked":     blocked.Users,
+		"next_cursor": blocked.NextCursor,
+	})
+}
+
+// GetMutedUsersHandler pages through the users muted by the authenticated user
+func (s *server) GetMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	req, err := loadFollowListParams(userID, r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	muted, err := s.Svc.GetMutedUsers(r.Context(), req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to fetch muted users: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Got muted users", map[string]interface{}{
+		"user_id":     req.UserID,
+		"muted":       muted.Users,
+		"next_cursor": muted.NextCursor,
+	})
+}
+
+// GetFollowRequestsHandler pages through the users waiting for the authenticated user to approve
+// their follow
+func (s *server) GetFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
 		return
 	}
-	if limit <= 0 {
-		RespondWithError(w, http.StatusBadRequest, "limit must be greater than 0")
+	req, err := loadFollowListParams(userID, r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	requests, err := s.Svc.GetFollowRequests(r.Context(), req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to fetch follow requests: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Got follow requests", map[string]interface{}{
+		"user_id":     req.UserID,
+		"requests":    requests.Users,
+		"next_cursor": requests.NextCursor,
+	})
+}
+
+// FollowRequestHandler answers the follow request sent to the authenticated user by the user of
+// the path, POST approves it and DELETE rejects it
+func (s *server) FollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	followerID := mux.Vars(r)["id"]
+	if !IsValidUUID(followerID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	approved := r.Method == http.MethodPost
+	if approved {
+		err = s.Svc.ApproveFollowRequest(r.Context(), userID, followerID)
+	} else {
+		err = s.Svc.RejectFollowRequest(r.Context(), userID, followerID)
+	}
+	if err != nil {
+		if errors.Is(err, m.ErrNoFollowRequest) {
+			RespondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to answer follow request: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "follow request answered", map[string]interface{}{
+		"user_id":  userID,
+		"follower": followerID,
+		"approved": approved,
+	})
+}
+
+// SetPrivacyHandler makes the account of the path, which must be the authenticated user, private
+// or public
+func (s *server) SetPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	if !IsValidUUID(userID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+	if _, err := authorize(r, userID); err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	var req m.PrivacyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidRequest.Error())
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.Svc.SetPrivate(r.Context(), userID, *req.IsPrivate); err != nil {
+		if errors.Is(err, m.ErrUserNotFound) {
+			RespondWithError(w, http.StatusNotFound, m.ErrUserNotFound.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to update privacy: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "privacy updated", map[string]interface{}{
+		"user_id":    userID,
+		"is_private": *req.IsPrivate,
+	})
+}
+
+func (s *server) GetFolloweesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	req, err := loadFollowListParams(mux.Vars(r)["id"], r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	followees, err := s.Svc.GetFollowees(userID, limit)
+	followees, err := s.Svc.GetFollowees(r.Context(), req)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to fetch followees: %v", err))
 		return
 	}
 
 	RespondWithSuccess(w, http.StatusOK, "Got user followees", map[string]interface{}{
-		"user_id":   userID,
-		"followees": followees,
+		"user_id":     req.UserID,
+		"followees":   followees.Users,
+		"next_cursor": followees.NextCursor,
+	})
+}
+
+func (s *server) GetFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	req, err := loadFollowListParams(mux.Vars(r)["id"], r.URL.Query())
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	followers, err := s.Svc.GetFollowers(r.Context(), req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to fetch followers: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "Got user followers", map[string]interface{}{
+		"user_id":     req.UserID,
+		"followers":   followers.Users,
+		"next_cursor": followers.NextCursor,
+	})
+}
+
+// loadFollowListParams reads the limit (defaults to 50, max 100) and the after keyset cursor
+func loadFollowListParams(userID string, query url.Values) (m.FollowListRequest, error) {
+	if userID == "" {
+		return m.FollowListRequest{}, m.ErrMissingUserID
+	}
+	if !IsValidUUID(userID) {
+		return m.FollowListRequest{}, m.ErrInvalidUUID
+	}
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		return m.FollowListRequest{}, err
+	}
+
+	after := query.Get("after")
+	if after != "" && !IsValidUUID(after) {
+		return m.FollowListRequest{}, errors.New("invalid after parameter")
+	}
+
+	return m.FollowListRequest{UserID: userID, Limit: limit, After: after}, nil
+}
+
+// parseLimit reads the limit query parameter, it defaults to 50 and must be between 1 and 100
+func parseLimit(query url.Values) (int, error) {
+	limitStr := query.Get("limit")
+	if limitStr == "" {
+		return 50, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		return 0, errors.New("invalid limit parameter")
+	}
+	if limit <= 0 || limit > 100 {
+		return 0, errors.New("limit must be between 1 and 100")
+	}
+	return limit, nil
+}
+
+func (s *server) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	if !IsValidUUID(userID) {
+		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
+		return
+	}
+
+	viewerID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+
+	profile, err := s.Svc.GetUserProfile(r.Context(), viewerID, userID)
+	if err != nil {
+		if errors.Is(err, m.ErrUserNotFound) {
+			RespondWithError(w, http.StatusNotFound, m.ErrUserNotFound.Error())
+			return
+		}
+		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to get user: %v", err))
+		return
+	}
+
+	RespondWithSuccess(w, http.StatusOK, "User profile", map[string]interface{}{
+		"user": profile,
 	})
 }
 
@@ -302,7 +1280,12 @@ func (s *server) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		RespondWithError(w, http.StatusBadRequest, m.ErrInvalidUUID.Error())
 		return
 	}
-	err := s.Svc.DeleteUser(userID)
+	callerID, err := authorize(r, userID)
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	err = s.Svc.DeleteUser(r.Context(), callerID, userID)
 	if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf("failed to delete user: %v", err))
 		return
@@ -5,89 +5,256 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"microblogging/auth"
 	"microblogging/model"
 	"microblogging/server"
+	"microblogging/service"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+var testTokens = auth.NewTokenManager("test-secret", time.Hour)
+
+// withUser returns the request as it looks after Authenticate accepted a token for userID
+func withUser(r *http.Request, userID string) *http.Request {
+	return r.WithContext(server.ContextWithUserID(r.Context(), userID))
+}
+
 // MockService implements BlogService using testify/mock
 type MockService struct {
 	mock.Mock
 }
 
 // CreatePost mocks CreatePost method
-func (m *MockService) CreatePost(userID string, content string) (uuid.UUID, error) {
-	args := m.Called(userID, content)
+func (m *MockService) CreatePost(ctx context.Context, userID string, post model.CreatePostRequest) (uuid.UUID, error) {
+	args := m.Called(ctx, userID, post)
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
 // CreateUser mocks CreateUser method
-func (m *MockService) CreateUser(userData model.CreateUserRequest) (uuid.UUID, error) {
-	args := m.Called(userData)
+func (m *MockService) CreateUser(ctx context.Context, userData model.CreateUserRequest) (uuid.UUID, error) {
+	args := m.Called(ctx, userData)
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
+// DeletePost mocks DeletePost method
+func (m *MockService) DeletePost(ctx context.Context, userID string, postID string) error {
+	args := m.Called(ctx, userID, postID)
+	return args.Error(0)
+}
+
 // DeleteUser mocks DeleteUser method
-func (m *MockService) DeleteUser(userID string) error {
-	args := m.Called(userID)
+func (m *MockService) DeleteUser(ctx context.Context, actorID string, userID string) error {
+	args := m.Called(ctx, actorID, userID)
 	return args.Error(0)
 }
 
 // FollowUser mocks FollowUser method
-func (m *MockService) FollowUser(followerID string, followeeID string) error {
-	args := m.Called(followeeID, followerID)
-	return args.Error(0)
+func (m *MockService) FollowUser(ctx context.Context, followerID string, followeeID string) (string, error) {
+	args := m.Called(ctx, followeeID, followerID)
+	return args.String(0), args.Error(1)
 }
 
 // UnfollowUser mocks FollowUser method
-func (m *MockService) UnfollowUser(followerID string, followeeID string) error {
-	args := m.Called(followeeID, followerID)
+func (m *MockService) UnfollowUser(ctx context.Context, followerID string, followeeID string) error {
+	args := m.Called(ctx, followeeID, followerID)
 	return args.Error(0)
 }
 
+// PatchPost mocks PatchPost method
+func (m *MockService) PatchPost(ctx context.Context, userID string, post model.PatchPostRequest) (int, error) {
+	args := m.Called(ctx, userID, post)
+	return args.Int(0), args.Error(1)
+}
+
 // GetFollowees mocks GetFollowees method
-func (m *MockService) GetFollowees(userID string, limit int) ([]string, error) {
-	args := m.Called(userID, limit)
-	return args.Get(0).([]string), args.Error(1)
+func (m *MockService) GetFollowees(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+// GetFollowers mocks GetFollowers method
+func (m *MockService) GetFollowers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
 }
 
 // GetTimeline mocks GetTimeline method
-func (m *MockService) GetTimeline(req model.TimelineRequest) (model.TimelineResponse, error) {
-	args := m.Called(req)
+func (m *MockService) GetTimeline(ctx context.Context, req model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.TimelineResponse), args.Error(1)
+}
+
+// BlockUser mocks BlockUser method
+func (m *MockService) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+// UnblockUser mocks UnblockUser method
+func (m *MockService) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+// GetBlockedUsers mocks GetBlockedUsers method
+func (m *MockService) GetBlockedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+// MuteUser mocks MuteUser method
+func (m *MockService) MuteUser(ctx context.Context, muterID, mutedID string) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+// UnmuteUser mocks UnmuteUser method
+func (m *MockService) UnmuteUser(ctx context.Context, muterID, mutedID string) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+// GetMutedUsers mocks GetMutedUsers method
+func (m *MockService) GetMutedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+// GetFollowRequests mocks GetFollowRequests method
+func (m *MockService) GetFollowRequests(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+// ApproveFollowRequest mocks ApproveFollowRequest method
+func (m *MockService) ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	args := m.Called(ctx, followeeID, followerID)
+	return args.Error(0)
+}
+
+// RejectFollowRequest mocks RejectFollowRequest method
+func (m *MockService) RejectFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	args := m.Called(ctx, followeeID, followerID)
+	return args.Error(0)
+}
+
+// SetPrivate mocks SetPrivate method
+func (m *MockService) SetPrivate(ctx context.Context, userID string, private bool) error {
+	args := m.Called(ctx, userID, private)
+	return args.Error(0)
+}
+
+// Subscribe mocks Subscribe method
+func (m *MockService) Subscribe(userID string, topics ...model.Topic) service.Subscription {
+	args := m.Called(userID, topics)
+	return args.Get(0).(service.Subscription)
+}
+
+// GetPost mocks GetPost method
+func (m *MockService) GetPost(ctx context.Context, viewerID, postID string) (model.Post, error) {
+	args := m.Called(ctx, viewerID, postID)
+	return args.Get(0).(model.Post), args.Error(1)
+}
+
+// GetPostRevisions mocks GetPostRevisions method
+func (m *MockService) GetPostRevisions(ctx context.Context, viewerID, postID string) ([]model.PostRevision, error) {
+	args := m.Called(ctx, viewerID, postID)
+	return args.Get(0).([]model.PostRevision), args.Error(1)
+}
+
+// GetUserPosts mocks GetUserPosts method
+func (m *MockService) GetUserPosts(ctx context.Context, req model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, req)
 	return args.Get(0).(model.TimelineResponse), args.Error(1)
 }
 
 // GetUser mocks GetUser method
-func (m *MockService) GetUser(userID string) (model.User, error) {
-	args := m.Called(userID)
+func (m *MockService) GetNotifications(ctx context.Context, info model.TimelineRequest) (model.NotificationsResponse, error) {
+	args := m.Called(ctx, info)
+	return args.Get(0).(model.NotificationsResponse), args.Error(1)
+}
+
+func (m *MockService) MarkNotificationsRead(ctx context.Context, userID string, ids []string) (model.ReadNotificationsResponse, error) {
+	args := m.Called(ctx, userID, ids)
+	return args.Get(0).(model.ReadNotificationsResponse), args.Error(1)
+}
+
+func (m *MockService) GetMentions(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, info)
+	return args.Get(0).(model.TimelineResponse), args.Error(1)
+}
+
+func (m *MockService) GetHashtagPosts(ctx context.Context, tag string, info model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, tag, info)
+	return args.Get(0).(model.TimelineResponse), args.Error(1)
+}
+
+func (m *MockService) Repost(ctx context.Context, userID string, postID string) (uuid.UUID, error) {
+	args := m.Called(ctx, userID, postID)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
+func (m *MockService) LikePost(ctx context.Context, userID string, postID string) error {
+	args := m.Called(ctx, userID, postID)
+	return args.Error(0)
+}
+
+func (m *MockService) UnlikePost(ctx context.Context, userID string, postID string) error {
+	args := m.Called(ctx, userID, postID)
+	return args.Error(0)
+}
+
+func (m *MockService) GetThread(ctx context.Context, req model.ThreadRequest) (model.Thread, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.Thread), args.Error(1)
+}
+
+func (m *MockService) GetUser(ctx context.Context, userID string) (model.User, error) {
+	args := m.Called(ctx, userID)
 	return args.Get(0).(model.User), args.Error(1)
 }
 
+// GetUserProfile mocks GetUserProfile method
+func (m *MockService) GetUserProfile(ctx context.Context, viewerID, userID string) (model.UserProfile, error) {
+	args := m.Called(ctx, viewerID, userID)
+	return args.Get(0).(model.UserProfile), args.Error(1)
+}
+
 // UpdatePostPut mocks UpdatePostPut method
-func (m *MockService) UpdatePostPut(post model.CreatePostRequest) error {
-	args := m.Called(post)
+func (m *MockService) UpdatePostPut(ctx context.Context, userID string, post model.CreatePostRequest) error {
+	args := m.Called(ctx, userID, post)
 	return args.Error(0)
 }
 
+// Login mocks Login method
+func (m *MockService) Login(ctx context.Context, req model.LoginRequest) (string, error) {
+	args := m.Called(ctx, req)
+	return args.String(0), args.Error(1)
+}
+
 func TestCreatePostHandler(t *testing.T) {
 	mockSvc := new(MockService)
-	s := server.NewServer(context.Background(), mockSvc)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
 	validUserID := uuid.New().String()
 	validContent := "Hello world"
+	parentID := uuid.New().String()
 
 	tests := []struct {
-		name           string
-		method         string
-		body           interface{}
-		mockReturnID   uuid.UUID
-		mockReturnErr  error
-		expectedStatus int
+		name            string
+		method          string
+		body            interface{}
+		mockReturnID    uuid.UUID
+		mockReturnErr   error
+		unauthenticated bool
+		expectedStatus  int
 	}{
 		{
 			name:           "Method Not Allowed",
@@ -123,6 +290,54 @@ func TestCreatePostHandler(t *testing.T) {
 			mockReturnErr:  nil,
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:           "Reply",
+			method:         http.MethodPost,
+			body:           model.CreatePostRequest{Content: validContent, InReplyTo: parentID},
+			mockReturnID:   uuid.New(),
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Reply To Missing Post",
+			method:         http.MethodPost,
+			body:           model.CreatePostRequest{Content: validContent, InReplyTo: parentID},
+			mockReturnErr:  model.ErrParentNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Quote Of Missing Post",
+			method:         http.MethodPost,
+			body:           model.CreatePostRequest{Content: validContent, QuoteOf: parentID},
+			mockReturnErr:  model.ErrSharedPostNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Invalid In Reply To",
+			method:         http.MethodPost,
+			body:           model.CreatePostRequest{Content: validContent, InReplyTo: "not-a-uuid"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "User ID Taken From Token",
+			method:         http.MethodPost,
+			body:           model.CreatePostRequest{Content: validContent},
+			mockReturnID:   uuid.New(),
+			mockReturnErr:  nil,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Posting As Another User",
+			method:         http.MethodPost,
+			body:           model.CreatePostRequest{UserID: uuid.New().String(), Content: validContent},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:            "Unauthenticated",
+			method:          http.MethodPost,
+			body:            model.CreatePostRequest{Content: validContent},
+			unauthenticated: true,
+			expectedStatus:  http.StatusUnauthorized,
+		},
 	}
 
 	for _, tt := range tests {
@@ -139,15 +354,15 @@ func TestCreatePostHandler(t *testing.T) {
 				}
 			}
 
-			// Setup mock expectation only if input is valid and method is POST
-			if req, ok := tt.body.(model.CreatePostRequest); ok &&
-				tt.method == http.MethodPost &&
-				len(req.Content) <= 1000 &&
-				tt.expectedStatus != http.StatusBadRequest { // case "Content Too Long"
-				mockSvc.On("CreatePost", req.UserID, req.Content).Return(tt.mockReturnID, tt.mockReturnErr)
+			// Setup mock expectation only if the request reaches the service
+			if req, ok := tt.body.(model.CreatePostRequest); ok && (tt.mockReturnID != uuid.Nil || tt.mockReturnErr != nil) {
+				mockSvc.On("CreatePost", mock.Anything, validUserID, req).Return(tt.mockReturnID, tt.mockReturnErr)
 			}
 
 			req := httptest.NewRequest(tt.method, "/posts", bytes.NewBuffer(body))
+			if !tt.unauthenticated {
+				req = withUser(req, validUserID)
+			}
 			w := httptest.NewRecorder()
 
 			s.CreatePostHandler(w, req)
@@ -160,7 +375,7 @@ func TestCreatePostHandler(t *testing.T) {
 
 func TestUpdatePostPutHandler(t *testing.T) {
 	mockSvc := new(MockService)
-	s := server.NewServer(context.Background(), mockSvc)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
 
 	validUserID := uuid.New().String()
 	validPostID := uuid.New().String()
@@ -198,6 +413,20 @@ func TestUpdatePostPutHandler(t *testing.T) {
 			mockReturnErr:  errors.New("mock update error"),
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:           "Post Not Found",
+			method:         http.MethodPut,
+			body:           model.CreatePostRequest{PostID: validPostID, UserID: validUserID, Content: validContent},
+			mockReturnErr:  model.ErrPostNotFound,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Edit Window Expired",
+			method:         http.MethodPut,
+			body:           model.CreatePostRequest{PostID: validPostID, UserID: validUserID, Content: validContent},
+			mockReturnErr:  model.ErrEditWindowExpired,
+			expectedStatus: http.StatusForbidden,
+		},
 		{
 			name:           "Success",
 			method:         http.MethodPut,
@@ -205,6 +434,12 @@ func TestUpdatePostPutHandler(t *testing.T) {
 			mockReturnErr:  nil,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "Updating As Another User",
+			method:         http.MethodPut,
+			body:           model.CreatePostRequest{PostID: validPostID, UserID: uuid.New().String(), Content: validContent},
+			expectedStatus: http.StatusForbidden,
+		},
 	}
 
 	for _, tt := range tests {
@@ -214,11 +449,11 @@ func TestUpdatePostPutHandler(t *testing.T) {
 			body, _ := json.Marshal(tt.body)
 
 			// Setup mock expectation only for valid payloads
-			if req, ok := tt.body.(model.CreatePostRequest); ok && req.PostID != "" && tt.method == http.MethodPut {
-				mockSvc.On("UpdatePostPut", req).Return(tt.mockReturnErr)
+			if req, ok := tt.body.(model.CreatePostRequest); ok && req.PostID != "" && req.UserID == validUserID {
+				mockSvc.On("UpdatePostPut", mock.Anything, validUserID, req).Return(tt.mockReturnErr)
 			}
 
-			req := httptest.NewRequest(tt.method, "/posts", bytes.NewBuffer(body))
+			req := withUser(httptest.NewRequest(tt.method, "/posts", bytes.NewBuffer(body)), validUserID)
 			req.Header.Set("Content-Type", "application/json")
 
 			w := httptest.NewRecorder()
@@ -231,7 +466,7 @@ func TestUpdatePostPutHandler(t *testing.T) {
 }
 func TestUnfollowHandler(t *testing.T) {
 	mockSvc := new(MockService)
-	s := server.NewServer(context.Background(), mockSvc)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
 
 	// fixed ids
 	const validFollowerID string = "550e8400-e29b-41d4-a716-446655440000"
@@ -282,6 +517,15 @@ func TestUnfollowHandler(t *testing.T) {
 			mockReturnErr:  nil,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:   "Unfollow_As_Another_User",
+			method: http.MethodPost,
+			body: map[string]string{
+				"follower_id": validFolloweeID,
+				"followee_id": validFollowerID,
+			},
+			expectedStatus: http.StatusForbidden,
+		},
 		{
 			name:   "Unfollow_Self",
 			method: http.MethodPost,
@@ -307,10 +551,10 @@ func TestUnfollowHandler(t *testing.T) {
 				m["follower_id"] == validFollowerID &&
 				m["followee_id"] == validFolloweeID &&
 				tt.method == http.MethodPost {
-				mockSvc.On("UnfollowUser", validFolloweeID, validFollowerID).Return(tt.mockReturnErr)
+				mockSvc.On("UnfollowUser", mock.Anything, validFolloweeID, validFollowerID).Return(tt.mockReturnErr)
 			}
 
-			req := httptest.NewRequest(tt.method, "/unfollow", bytes.NewBuffer(bodyBytes))
+			req := withUser(httptest.NewRequest(tt.method, "/unfollow", bytes.NewBuffer(bodyBytes)), validFollowerID)
 			req.Header.Set("Content-Type", "application/json")
 
 			w := httptest.NewRecorder()
@@ -323,7 +567,7 @@ func TestUnfollowHandler(t *testing.T) {
 }
 func TestFollowHandler(t *testing.T) {
 	mockSvc := new(MockService)
-	s := server.NewServer(context.Background(), mockSvc)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
 
 	const validFollowerID = "550e8400-e29b-41d4-a716-446655440000"
 	const validFolloweeID = "550e8400-e29b-41d4-a716-446655440001"
@@ -332,6 +576,7 @@ func TestFollowHandler(t *testing.T) {
 		name           string
 		method         string
 		body           interface{}
+		mockState      string
 		mockReturnErr  error
 		expectedStatus int
 	}{
@@ -363,6 +608,33 @@ func TestFollowHandler(t *testing.T) {
 			mockReturnErr:  model.ErrCanNotFollowSelf,
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:   "Follow As Another User",
+			method: http.MethodPost,
+			body: map[string]string{
+				"follower_id": validFolloweeID,
+				"followee_id": validFollowerID,
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Follower Taken From Token",
+			method: http.MethodPost,
+			body: map[string]string{
+				"followee_id": validFolloweeID,
+			},
+			mockReturnErr:  nil,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Blocked",
+			method: http.MethodPost,
+			body: map[string]string{
+				"followee_id": validFolloweeID,
+			},
+			mockReturnErr:  model.ErrUserBlocked,
+			expectedStatus: http.StatusForbidden,
+		},
 		{
 			name:   "Service Error",
 			method: http.MethodPost,
@@ -383,6 +655,15 @@ func TestFollowHandler(t *testing.T) {
 			mockReturnErr:  nil,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:   "Private Account",
+			method: http.MethodPost,
+			body: map[string]string{
+				"followee_id": validFolloweeID,
+			},
+			mockState:      model.FollowPending,
+			expectedStatus: http.StatusAccepted,
+		},
 	}
 
 	for _, tt := range tests {
@@ -395,13 +676,17 @@ func TestFollowHandler(t *testing.T) {
 			}
 
 			if m, ok := tt.body.(map[string]string); ok &&
-				m["follower_id"] == validFollowerID &&
+				(m["follower_id"] == validFollowerID || m["follower_id"] == "") &&
 				m["followee_id"] == validFolloweeID &&
 				tt.method == http.MethodPost {
-				mockSvc.On("FollowUser", validFolloweeID, validFollowerID).Return(tt.mockReturnErr)
+				state := tt.mockState
+				if state == "" {
+					state = model.FollowActive
+				}
+				mockSvc.On("FollowUser", mock.Anything, validFolloweeID, validFollowerID).Return(state, tt.mockReturnErr)
 			}
 
-			req := httptest.NewRequest(tt.method, "/follow", bytes.NewBuffer(bodyBytes))
+			req := withUser(httptest.NewRequest(tt.method, "/follow", bytes.NewBuffer(bodyBytes)), validFollowerID)
 			req.Header.Set("Content-Type", "application/json")
 
 			w := httptest.NewRecorder()
@@ -412,3 +697,1092 @@ func TestFollowHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	validLogin := model.LoginRequest{Email: "alice@example.com", Password: "password123"}
+
+	tests := []struct {
+		name           string
+		method         string
+		body           interface{}
+		mockReturnID   string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{
+			name:           "Method Not Allowed",
+			method:         http.MethodGet,
+			body:           nil,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "Invalid JSON Body",
+			method:         http.MethodPost,
+			body:           "invalid-json",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing Password",
+			method:         http.MethodPost,
+			body:           model.LoginRequest{Email: "alice@example.com"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid Credentials",
+			method:         http.MethodPost,
+			body:           validLogin,
+			mockReturnErr:  model.ErrInvalidCredentials,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Service Error",
+			method:         http.MethodPost,
+			body:           validLogin,
+			mockReturnErr:  errors.New("mock error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Success",
+			method:         http.MethodPost,
+			body:           validLogin,
+			mockReturnID:   validUserID,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			var body []byte
+			switch b := tt.body.(type) {
+			case nil:
+			case string:
+				body = []byte(b)
+			default:
+				body, _ = json.Marshal(tt.body)
+			}
+
+			if req, ok := tt.body.(model.LoginRequest); ok && req.Password != "" {
+				mockSvc.On("Login", mock.Anything, req).Return(tt.mockReturnID, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(tt.method, "/login", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+			s.LoginHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+
+			if tt.expectedStatus == http.StatusOK {
+				var resp struct {
+					Data map[string]interface{} `json:"data"`
+				}
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				subject, err := testTokens.Verify(resp.Data["token"].(string))
+				assert.NoError(t, err)
+				assert.Equal(t, validUserID, subject)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := server.NewServer(context.Background(), new(MockService), testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	validToken, _, _ := testTokens.Issue(validUserID)
+	otherToken, _, _ := auth.NewTokenManager("other-secret", time.Hour).Issue(validUserID)
+
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+	}{
+		{name: "Missing Header", header: "", expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong Scheme", header: "Basic " + validToken, expectedStatus: http.StatusUnauthorized},
+		{name: "Invalid Token", header: "Bearer " + otherToken, expectedStatus: http.StatusUnauthorized},
+		{name: "Valid Token", header: "Bearer " + validToken, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = server.UserIDFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.Authenticate(next).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, validUserID, gotUserID)
+			}
+		})
+	}
+}
+
+func TestDeleteUserHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	const otherUserID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		userID         string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", userID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Deleting Another User", userID: otherUserID, expectedStatus: http.StatusForbidden},
+		{name: "Service Error", userID: validUserID, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+		{name: "Success", userID: validUserID, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.userID == validUserID {
+				mockSvc.On("DeleteUser", mock.Anything, validUserID, validUserID).Return(tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/user/"+tt.userID, nil)
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.userID}), validUserID)
+			w := httptest.NewRecorder()
+			s.DeleteUserHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeletePostHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	const validPostID = "650e8400-e29b-41d4-a716-446655440000"
+
+	tests := []struct {
+		name           string
+		method         string
+		postID         string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Method Not Allowed", method: http.MethodGet, postID: validPostID, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Invalid UUID", method: http.MethodDelete, postID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Post Not Found", method: http.MethodDelete, postID: validPostID, mockReturnErr: model.ErrPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Service Error", method: http.MethodDelete, postID: validPostID, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+		{name: "Success", method: http.MethodDelete, postID: validPostID, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.method == http.MethodDelete && tt.postID == validPostID {
+				mockSvc.On("DeletePost", mock.Anything, validUserID, validPostID).Return(tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(tt.method, "/posts/"+tt.postID, nil)
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.postID}), validUserID)
+			w := httptest.NewRecorder()
+			s.DeletePostHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchPostHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const postID = "650e8400-e29b-41d4-a716-446655440000"
+	content := "patched"
+
+	tests := []struct {
+		name           string
+		postID         string
+		ifMatch        string
+		body           string
+		versions       []int
+		mockVersion    int
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", postID: "not-a-uuid", body: `{"content": "patched"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", postID: postID, body: "invalid-json", expectedStatus: http.StatusBadRequest},
+		{name: "Empty Content", postID: postID, body: `{"content": ""}`, expectedStatus: http.StatusBadRequest},
+		{name: "Weak If-Match", postID: postID, ifMatch: `W/"2"`, body: `{"content": "patched"}`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "Malformed If-Match", postID: postID, ifMatch: `"2`, body: `{"content": "patched"}`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "If-Match Without Version", postID: postID, ifMatch: `"2,3"`, body: `{"content": "patched"}`, expectedStatus: http.StatusPreconditionFailed},
+		{name: "Stale Version", postID: postID, ifMatch: `"2"`, body: `{"content": "patched"}`, versions: []int{2}, mockReturnErr: model.ErrVersionMismatch, expectedStatus: http.StatusPreconditionFailed},
+		{name: "Post Not Found", postID: postID, ifMatch: `"2"`, body: `{"content": "patched"}`, versions: []int{2}, mockReturnErr: model.ErrPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Edit Window Expired", postID: postID, ifMatch: `"2"`, body: `{"content": "patched"}`, versions: []int{2}, mockReturnErr: model.ErrEditWindowExpired, expectedStatus: http.StatusForbidden},
+		{name: "Success", postID: postID, ifMatch: `"2"`, body: `{"content": "patched"}`, versions: []int{2}, mockVersion: 3, expectedStatus: http.StatusOK},
+		{name: "If-Match List", postID: postID, ifMatch: `W/"1", "2" ,"x", "4"`, body: `{"content": "patched"}`, versions: []int{2, 4}, mockVersion: 3, expectedStatus: http.StatusOK},
+		{name: "If-Match Any", postID: postID, ifMatch: `*`, body: `{"content": "patched"}`, mockVersion: 3, expectedStatus: http.StatusOK},
+		{name: "Without If-Match", postID: postID, body: `{"content": "patched"}`, mockVersion: 3, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.mockVersion != 0 || tt.mockReturnErr != nil {
+				mockSvc.On("PatchPost", mock.Anything, userID, model.PatchPostRequest{PostID: postID, Content: &content, Versions: tt.versions}).Return(tt.mockVersion, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/posts/"+tt.postID, bytes.NewBufferString(tt.body))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.postID}), userID)
+			w := httptest.NewRecorder()
+			s.PatchPostHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPostHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validPostID = "650e8400-e29b-41d4-a716-446655440000"
+	const viewerID = "550e8400-e29b-41d4-a716-446655440000"
+
+	tests := []struct {
+		name           string
+		postID         string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", postID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Post Not Found", postID: validPostID, mockReturnErr: model.ErrPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Post Deleted", postID: validPostID, mockReturnErr: model.ErrPostDeleted, expectedStatus: http.StatusGone},
+		{name: "Service Error", postID: validPostID, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+		{name: "Success", postID: validPostID, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.postID == validPostID {
+				mockSvc.On("GetPost", mock.Anything, viewerID, validPostID).Return(model.Post{ID: validPostID, Version: 4}, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/posts/"+tt.postID, nil)
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.postID}), viewerID)
+			w := httptest.NewRecorder()
+			s.GetPostHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPostRevisionsHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validPostID = "650e8400-e29b-41d4-a716-446655440000"
+	const viewerID = "550e8400-e29b-41d4-a716-446655440000"
+	revisions := []model.PostRevision{{PostID: validPostID, Revision: 1, Content: "first"}}
+
+	tests := []struct {
+		name           string
+		postID         string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", postID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Post Not Found", postID: validPostID, mockReturnErr: model.ErrPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Post Deleted", postID: validPostID, mockReturnErr: model.ErrPostDeleted, expectedStatus: http.StatusGone},
+		{name: "Service Error", postID: validPostID, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+		{name: "Success", postID: validPostID, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.postID == validPostID {
+				mockSvc.On("GetPostRevisions", mock.Anything, viewerID, validPostID).Return(revisions, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/posts/"+tt.postID+"/revisions", nil)
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.postID}), viewerID)
+			w := httptest.NewRecorder()
+			s.GetPostRevisionsHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"content":"first"`)
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLikePostHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const postID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		method         string
+		postID         string
+		mockMethod     string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Method Not Allowed", method: http.MethodGet, postID: postID, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Invalid UUID", method: http.MethodPost, postID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Like", method: http.MethodPost, postID: postID, mockMethod: "LikePost", expectedStatus: http.StatusOK},
+		{name: "Unlike", method: http.MethodDelete, postID: postID, mockMethod: "UnlikePost", expectedStatus: http.StatusOK},
+		{name: "Post Not Found", method: http.MethodPost, postID: postID, mockMethod: "LikePost", mockReturnErr: model.ErrPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Service Error", method: http.MethodDelete, postID: postID, mockMethod: "UnlikePost", mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.mockMethod != "" {
+				mockSvc.On(tt.mockMethod, mock.Anything, userID, postID).Return(tt.mockReturnErr)
+			}
+
+			req := withUser(httptest.NewRequest(tt.method, "/posts/"+tt.postID+"/like", nil), userID)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.postID})
+			w := httptest.NewRecorder()
+			s.LikePostHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRepostHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const postID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		method         string
+		postID         string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Method Not Allowed", method: http.MethodGet, postID: postID, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Invalid UUID", method: http.MethodPost, postID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Success", method: http.MethodPost, postID: postID, expectedStatus: http.StatusCreated},
+		{name: "Not Found", method: http.MethodPost, postID: postID, mockReturnErr: model.ErrSharedPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Already Reposted", method: http.MethodPost, postID: postID, mockReturnErr: model.ErrAlreadyReposted, expectedStatus: http.StatusConflict},
+		{name: "Service Error", method: http.MethodPost, postID: postID, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.method == http.MethodPost && tt.postID == postID {
+				mockSvc.On("Repost", mock.Anything, userID, postID).Return(uuid.New(), tt.mockReturnErr)
+			}
+
+			req := withUser(httptest.NewRequest(tt.method, "/posts/"+tt.postID+"/repost", nil), userID)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.postID})
+			w := httptest.NewRecorder()
+			s.RepostHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetThreadHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const postID = "550e8400-e29b-41d4-a716-446655440000"
+	const replyID = "550e8400-e29b-41d4-a716-446655440001"
+	const viewerID = "550e8400-e29b-41d4-a716-446655440002"
+	reply := model.Post{ID: replyID, Content: "reply", CreatedAt: time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name           string
+		postID         string
+		query          string
+		thread         model.Thread
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", postID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Limit", postID: postID, query: "?limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Cursor", postID: postID, query: "?cursor=nope", expectedStatus: http.StatusBadRequest},
+		{name: "Not Found", postID: postID, mockReturnErr: model.ErrPostNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Deleted", postID: postID, mockReturnErr: model.ErrPostDeleted, expectedStatus: http.StatusGone},
+		{
+			name:   "Success",
+			postID: postID,
+			thread: model.Thread{
+				Post:      model.Post{ID: postID},
+				Replies:   []model.ThreadNode{{Post: reply}},
+				LastReply: &reply,
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.expectedStatus != http.StatusBadRequest {
+				mockSvc.On("GetThread", mock.Anything, model.ThreadRequest{PostID: postID, ViewerID: viewerID, Limit: 50}).Return(tt.thread, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/posts/"+tt.postID+"/thread"+tt.query, nil)
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.postID}), viewerID)
+			w := httptest.NewRecorder()
+			s.GetThreadHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var body struct {
+					Data struct {
+						Replies    []model.ThreadNode `json:"replies"`
+						NextCursor string             `json:"next_cursor"`
+					} `json:"data"`
+				}
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+				assert.Len(t, body.Data.Replies, 1)
+				assert.NotEmpty(t, body.Data.NextCursor)
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetUserPostsHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	const viewerID = "550e8400-e29b-41d4-a716-446655440001"
+	before := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		userID         string
+		query          string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", userID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Before", userID: validUserID, query: "?before=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "User Not Found", userID: validUserID, query: "?limit=10&before=" + before.Format(time.RFC3339), mockReturnErr: model.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Private Account", userID: validUserID, query: "?limit=10&before=" + before.Format(time.RFC3339), mockReturnErr: model.ErrPrivateAccount, expectedStatus: http.StatusForbidden},
+		{name: "Success", userID: validUserID, query: "?limit=10&before=" + before.Format(time.RFC3339), expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.expectedStatus != http.StatusBadRequest {
+				mockSvc.On("GetUserPosts", mock.Anything, model.TimelineRequest{UserID: validUserID, ViewerID: viewerID, Limit: 10, Before: before}).
+					Return(model.TimelineResponse{}, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.userID+"/posts"+tt.query, nil)
+			req = withUser(mux.SetURLVars(req, map[string]string{"id": tt.userID}), viewerID)
+			w := httptest.NewRecorder()
+			s.GetUserPostsHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetTimelineHandlerCursor(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	createdAt := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+	before := createdAt.Add(time.Hour)
+	firstPage := []model.Post{
+		{ID: "550e8400-e29b-41d4-a716-446655440002", UserID: userID, CreatedAt: createdAt},
+		{ID: "550e8400-e29b-41d4-a716-446655440001", UserID: userID, CreatedAt: createdAt},
+	}
+
+	getTimeline := func(query string) (int, map[string]interface{}) {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/timeline"+query, nil), userID)
+		w := httptest.NewRecorder()
+		s.GetTimelineHandler(w, req)
+
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body.Data
+	}
+
+	mockSvc.On("GetTimeline", mock.Anything, model.TimelineRequest{UserID: userID, Limit: 2, Before: before}).
+		Return(model.TimelineResponse{Posts: firstPage}, nil).Once()
+	code, data := getTimeline("?limit=2&before=" + before.Format(time.RFC3339))
+	assert.Equal(t, http.StatusOK, code)
+	cursor, _ := data["next_cursor"].(string)
+	assert.NotEmpty(t, cursor)
+
+	// posts sharing a created_at are paged by id, so the cursor carries both
+	mockSvc.On("GetTimeline", mock.Anything, model.TimelineRequest{UserID: userID, Limit: 2, Before: createdAt, BeforeID: firstPage[1].ID}).
+		Return(model.TimelineResponse{Posts: firstPage[:1]}, nil).Once()
+	code, data = getTimeline("?limit=2&cursor=" + cursor)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, data["next_cursor"])
+
+	code, _ = getTimeline("?limit=2&cursor=not-a-cursor")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGetHashtagPostsHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	before := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+	query := "?limit=1&before=" + before.Format(time.RFC3339)
+	post := model.Post{ID: "550e8400-e29b-41d4-a716-446655440001", UserID: userID, CreatedAt: before.Add(-time.Hour)}
+
+	tests := []struct {
+		name           string
+		tag            string
+		query          string
+		posts          []model.Post
+		mockReturnErr  error
+		expectedStatus int
+		expectCursor   bool
+	}{
+		{name: "Success", tag: "GoLang", query: query, posts: []model.Post{post}, expectedStatus: http.StatusOK, expectCursor: true},
+		{name: "Invalid Cursor", tag: "golang", query: "?cursor=nope", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Hashtag", tag: "123", query: query, mockReturnErr: model.ErrInvalidHashtag, expectedStatus: http.StatusBadRequest},
+		{name: "Service Error", tag: "golang", query: query, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.query == query {
+				mockSvc.On("GetHashtagPosts", mock.Anything, tt.tag, model.TimelineRequest{UserID: userID, Limit: 1, Before: before}).
+					Return(model.TimelineResponse{Posts: tt.posts}, tt.mockReturnErr)
+			}
+
+			req := withUser(httptest.NewRequest(http.MethodGet, "/hashtags/"+tt.tag+"/posts"+tt.query, nil), userID)
+			req = mux.SetURLVars(req, map[string]string{"tag": tt.tag})
+			w := httptest.NewRecorder()
+			s.GetHashtagPostsHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var body struct {
+					Data map[string]interface{} `json:"data"`
+				}
+				json.NewDecoder(w.Body).Decode(&body)
+				assert.Equal(t, tt.expectCursor, body.Data["next_cursor"] != "")
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetMentionsHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const otherID = "550e8400-e29b-41d4-a716-446655440001"
+	before := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+	query := "?limit=10&before=" + before.Format(time.RFC3339)
+
+	tests := []struct {
+		name           string
+		userID         string
+		viewerID       string
+		query          string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Success", userID: userID, viewerID: userID, query: query, expectedStatus: http.StatusOK},
+		{name: "Other Viewer", userID: userID, viewerID: otherID, query: query, expectedStatus: http.StatusOK},
+		{name: "Unauthenticated", userID: userID, query: query, expectedStatus: http.StatusUnauthorized},
+		{name: "Invalid UUID", userID: "not-a-uuid", viewerID: userID, query: query, expectedStatus: http.StatusBadRequest},
+		{name: "User Not Found", userID: userID, viewerID: userID, query: query, mockReturnErr: model.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Service Error", userID: userID, viewerID: userID, query: query, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.expectedStatus != http.StatusBadRequest && tt.expectedStatus != http.StatusUnauthorized {
+				mockSvc.On("GetMentions", mock.Anything, model.TimelineRequest{UserID: userID, ViewerID: tt.viewerID, Limit: 10, Before: before}).
+					Return(model.TimelineResponse{}, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.userID+"/mentions"+tt.query, nil)
+			if tt.viewerID != "" {
+				req = withUser(req, tt.viewerID)
+			}
+			req = mux.SetURLVars(req, map[string]string{"id": tt.userID})
+			w := httptest.NewRecorder()
+			s.GetMentionsHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetNotificationsHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	before := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+	group := model.NotificationGroup{ID: "550e8400-e29b-41d4-a716-446655440001", Type: model.NotificationLike, ActorCount: 1, CreatedAt: before}
+
+	mockSvc.On("GetNotifications", mock.Anything, model.TimelineRequest{UserID: userID, Limit: 1, Before: before}).
+		Return(model.NotificationsResponse{Notifications: []model.NotificationGroup{group}, UnreadCount: 4}, nil)
+
+	req := withUser(httptest.NewRequest(http.MethodGet, "/notifications?limit=1&before="+before.Format(time.RFC3339), nil), userID)
+	w := httptest.NewRecorder()
+	s.GetNotificationsHandler(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Data struct {
+			Notifications []model.NotificationGroup `json:"notifications"`
+			UnreadCount   int                       `json:"unread_count"`
+			NextCursor    string                    `json:"next_cursor"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Len(t, body.Data.Notifications, 1)
+	assert.Equal(t, 4, body.Data.UnreadCount)
+	assert.NotEmpty(t, body.Data.NextCursor, "a full page has a next cursor")
+	mockSvc.AssertExpectations(t)
+
+	req = httptest.NewRequest(http.MethodGet, "/notifications", nil)
+	w = httptest.NewRecorder()
+	s.GetNotificationsHandler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestReadNotificationsHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const groupID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedIDs    []string
+		expectedStatus int
+	}{
+		{name: "All", body: "", expectedStatus: http.StatusOK},
+		{name: "Empty List", body: `{"ids":[]}`, expectedIDs: []string{}, expectedStatus: http.StatusOK},
+		{name: "Groups", body: `{"ids":["` + groupID + `"]}`, expectedIDs: []string{groupID}, expectedStatus: http.StatusOK},
+		{name: "Invalid ID", body: `{"ids":["nope"]}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", body: `{"ids":`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.expectedStatus == http.StatusOK {
+				mockSvc.On("MarkNotificationsRead", mock.Anything, userID, tt.expectedIDs).
+					Return(model.ReadNotificationsResponse{Marked: 1}, nil)
+			}
+
+			req := withUser(httptest.NewRequest(http.MethodPost, "/notifications/read", bytes.NewBufferString(tt.body)), userID)
+			w := httptest.NewRecorder()
+			s.ReadNotificationsHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetTimelineHandlerSince(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	newest := model.Post{ID: "550e8400-e29b-41d4-a716-446655440002", UserID: userID, CreatedAt: time.Now().Add(-time.Hour)}
+	newer := model.Post{ID: "550e8400-e29b-41d4-a716-446655440003", UserID: userID, CreatedAt: time.Now()}
+
+	getTimeline := func(query string) (int, map[string]interface{}) {
+		req := withUser(httptest.NewRequest(http.MethodGet, "/timeline"+query, nil), userID)
+		w := httptest.NewRecorder()
+		s.GetTimelineHandler(w, req)
+
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body.Data
+	}
+
+	// before defaults to now, so the latest posts are part of the first page
+	mockSvc.On("GetTimeline", mock.Anything, mock.MatchedBy(func(req model.TimelineRequest) bool {
+		return !req.Since() && time.Since(req.Before) < time.Minute
+	})).Return(model.TimelineResponse{Posts: []model.Post{newest}}, nil).Once()
+	code, data := getTimeline("")
+	assert.Equal(t, http.StatusOK, code)
+	since, _ := data["since_cursor"].(string)
+	assert.NotEmpty(t, since)
+
+	mockSvc.On("GetTimeline", mock.Anything, mock.MatchedBy(func(req model.TimelineRequest) bool {
+		return req.After.Equal(newest.CreatedAt) && req.AfterID == newest.ID
+	})).Return(model.TimelineResponse{Posts: []model.Post{newer}}, nil).Once()
+	code, data = getTimeline("?since=" + since)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, since, data["since_cursor"])
+	assert.NotContains(t, data, "next_cursor")
+
+	mockSvc.On("GetTimeline", mock.Anything, mock.Anything).Return(model.TimelineResponse{}, nil).Once()
+	code, data = getTimeline("?since=" + since)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, since, data["since_cursor"])
+
+	code, _ = getTimeline("?since=" + since + "&before=" + time.Now().Format(time.RFC3339))
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGetUserHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	const viewerID = "550e8400-e29b-41d4-a716-446655440001"
+	profile := model.UserProfile{ID: validUserID, Name: "alice", FollowerCount: 3, FolloweeCount: 1}
+
+	tests := []struct {
+		name           string
+		userID         string
+		viewerID       string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", userID: "not-a-uuid", viewerID: viewerID, expectedStatus: http.StatusBadRequest},
+		{name: "Unauthenticated", userID: validUserID, expectedStatus: http.StatusUnauthorized},
+		{name: "User Not Found", userID: validUserID, viewerID: viewerID, mockReturnErr: model.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Service Error", userID: validUserID, viewerID: viewerID, mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+		{name: "Success", userID: validUserID, viewerID: viewerID, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.userID == validUserID && tt.viewerID != "" {
+				mockSvc.On("GetUserProfile", mock.Anything, viewerID, validUserID).Return(profile, tt.mockReturnErr)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/user/"+tt.userID, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.userID})
+			if tt.viewerID != "" {
+				req = withUser(req, tt.viewerID)
+			}
+			w := httptest.NewRecorder()
+			s.GetUserHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"follower_count":3`)
+				assert.NotContains(t, w.Body.String(), "email")
+				assert.NotContains(t, w.Body.String(), "password")
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFollowListHandlers(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const validUserID = "550e8400-e29b-41d4-a716-446655440000"
+	const afterID = "550e8400-e29b-41d4-a716-446655440001"
+	page := model.FollowListResponse{Users: []model.UserSummary{{ID: afterID, Name: "bob"}}, NextCursor: afterID}
+
+	handlers := map[string]http.HandlerFunc{
+		"GetFollowees": s.GetFolloweesHandler,
+		"GetFollowers": s.GetFollowersHandler,
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		query          string
+		expectedReq    *model.FollowListRequest
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", userID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Limit", userID: validUserID, query: "?limit=abc", expectedStatus: http.StatusBadRequest},
+		{name: "Limit Out Of Range", userID: validUserID, query: "?limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid Cursor", userID: validUserID, query: "?after=abc", expectedStatus: http.StatusBadRequest},
+		{
+			name:           "Service Error",
+			userID:         validUserID,
+			expectedReq:    &model.FollowListRequest{UserID: validUserID, Limit: 50},
+			mockReturnErr:  errors.New("mock error"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Success With Cursor",
+			userID:         validUserID,
+			query:          "?limit=10&after=" + afterID,
+			expectedReq:    &model.FollowListRequest{UserID: validUserID, Limit: 10, After: afterID},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for method, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(method+"/"+tt.name, func(t *testing.T) {
+				mockSvc.ExpectedCalls = nil // reset mock
+
+				if tt.expectedReq != nil {
+					mockSvc.On(method, mock.Anything, *tt.expectedReq).Return(page, tt.mockReturnErr)
+				}
+
+				req := httptest.NewRequest(http.MethodGet, "/"+tt.userID+tt.query, nil)
+				req = mux.SetURLVars(req, map[string]string{"id": tt.userID})
+				w := httptest.NewRecorder()
+				handler(w, req)
+
+				assert.Equal(t, tt.expectedStatus, w.Code)
+				if tt.expectedStatus == http.StatusOK {
+					assert.Contains(t, w.Body.String(), `"next_cursor":"`+afterID+`"`)
+				}
+				mockSvc.AssertExpectations(t)
+			})
+		}
+	}
+}
+
+func TestBlockAndMuteHandlers(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const otherID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		method         string
+		otherID        string
+		mockMethod     string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Method Not Allowed", handler: s.BlockUserHandler, method: http.MethodGet, otherID: otherID, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Invalid UUID", handler: s.MuteUserHandler, method: http.MethodPost, otherID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Block", handler: s.BlockUserHandler, method: http.MethodPost, otherID: otherID, mockMethod: "BlockUser", expectedStatus: http.StatusOK},
+		{name: "Unblock", handler: s.BlockUserHandler, method: http.MethodDelete, otherID: otherID, mockMethod: "UnblockUser", expectedStatus: http.StatusOK},
+		{name: "Mute", handler: s.MuteUserHandler, method: http.MethodPost, otherID: otherID, mockMethod: "MuteUser", expectedStatus: http.StatusOK},
+		{name: "Unmute", handler: s.MuteUserHandler, method: http.MethodDelete, otherID: otherID, mockMethod: "UnmuteUser", expectedStatus: http.StatusOK},
+		{name: "Block Self", handler: s.BlockUserHandler, method: http.MethodPost, otherID: otherID, mockMethod: "BlockUser", mockReturnErr: model.ErrCanNotBlockSelf, expectedStatus: http.StatusBadRequest},
+		{name: "User Not Found", handler: s.MuteUserHandler, method: http.MethodPost, otherID: otherID, mockMethod: "MuteUser", mockReturnErr: model.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Service Error", handler: s.BlockUserHandler, method: http.MethodDelete, otherID: otherID, mockMethod: "UnblockUser", mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.mockMethod != "" {
+				mockSvc.On(tt.mockMethod, mock.Anything, userID, otherID).Return(tt.mockReturnErr)
+			}
+
+			req := withUser(httptest.NewRequest(tt.method, "/users/"+tt.otherID+"/block", nil), userID)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.otherID})
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRelationListHandlers(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const afterID = "550e8400-e29b-41d4-a716-446655440001"
+	page := model.FollowListResponse{Users: []model.UserSummary{{ID: afterID, Name: "bob"}}, NextCursor: afterID}
+
+	handlers := map[string]http.HandlerFunc{
+		"GetBlockedUsers":   s.GetBlockedUsersHandler,
+		"GetMutedUsers":     s.GetMutedUsersHandler,
+		"GetFollowRequests": s.GetFollowRequestsHandler,
+	}
+
+	for method, handler := range handlers {
+		t.Run(method+"/Invalid Cursor", func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			w := httptest.NewRecorder()
+			handler(w, withUser(httptest.NewRequest(http.MethodGet, "/?after=abc", nil), userID))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+		t.Run(method+"/Success", func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+			mockSvc.On(method, mock.Anything, model.FollowListRequest{UserID: userID, Limit: 10}).Return(page, nil)
+
+			w := httptest.NewRecorder()
+			handler(w, withUser(httptest.NewRequest(http.MethodGet, "/?limit=10", nil), userID))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"next_cursor":"`+afterID+`"`)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFollowRequestHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const followerID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		method         string
+		followerID     string
+		mockMethod     string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Method Not Allowed", method: http.MethodGet, followerID: followerID, expectedStatus: http.StatusMethodNotAllowed},
+		{name: "Invalid UUID", method: http.MethodPost, followerID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{name: "Approve", method: http.MethodPost, followerID: followerID, mockMethod: "ApproveFollowRequest", expectedStatus: http.StatusOK},
+		{name: "Reject", method: http.MethodDelete, followerID: followerID, mockMethod: "RejectFollowRequest", expectedStatus: http.StatusOK},
+		{name: "No Request", method: http.MethodPost, followerID: followerID, mockMethod: "ApproveFollowRequest", mockReturnErr: model.ErrNoFollowRequest, expectedStatus: http.StatusNotFound},
+		{name: "Service Error", method: http.MethodDelete, followerID: followerID, mockMethod: "RejectFollowRequest", mockReturnErr: errors.New("mock error"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.mockMethod != "" {
+				mockSvc.On(tt.mockMethod, mock.Anything, userID, followerID).Return(tt.mockReturnErr)
+			}
+
+			req := withUser(httptest.NewRequest(tt.method, "/follow-requests/"+tt.followerID, nil), userID)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.followerID})
+			w := httptest.NewRecorder()
+			s.FollowRequestHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSetPrivacyHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const otherID = "550e8400-e29b-41d4-a716-446655440001"
+
+	tests := []struct {
+		name           string
+		userID         string
+		body           string
+		mockReturnErr  error
+		expectedStatus int
+	}{
+		{name: "Invalid UUID", userID: "not-a-uuid", body: `{"is_private": true}`, expectedStatus: http.StatusBadRequest},
+		{name: "Another User", userID: otherID, body: `{"is_private": true}`, expectedStatus: http.StatusForbidden},
+		{name: "Invalid JSON", userID: userID, body: "invalid-json", expectedStatus: http.StatusBadRequest},
+		{name: "Missing Flag", userID: userID, body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "User Not Found", userID: userID, body: `{"is_private": true}`, mockReturnErr: model.ErrUserNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Success", userID: userID, body: `{"is_private": true}`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc.ExpectedCalls = nil // reset mock
+
+			if tt.expectedStatus == http.StatusOK || tt.mockReturnErr != nil {
+				mockSvc.On("SetPrivate", mock.Anything, userID, true).Return(tt.mockReturnErr)
+			}
+
+			req := withUser(httptest.NewRequest(http.MethodPut, "/user/"+tt.userID+"/privacy", bytes.NewBufferString(tt.body)), userID)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.userID})
+			w := httptest.NewRecorder()
+			s.SetPrivacyHandler(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"microblogging/auth"
 	"microblogging/model"
 	s "microblogging/service"
 	"net/http"
@@ -11,16 +12,18 @@ import (
 )
 
 type server struct {
-	Svc s.BlogService
-	ctx context.Context
+	Svc    s.BlogService
+	ctx    context.Context
+	tokens *auth.TokenManager
 }
 
 var validate = validator.New()
 
-func NewServer(ctx context.Context, svc s.BlogService) *server {
+func NewServer(ctx context.Context, svc s.BlogService, tokens *auth.TokenManager) *server {
 	return &server{
-		Svc: svc,
-		ctx: ctx,
+		Svc:    svc,
+		ctx:    ctx,
+		tokens: tokens,
 	}
 }
 
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	m "microblogging/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamHeartbeat is how often an idle stream sends a comment, so proxies keep it open
+	streamHeartbeat = 15 * time.Second
+	// streamReplayPage is the page size used to replay the posts missed by a resuming stream
+	streamReplayPage = 100
+)
+
+// StreamTimelineHandler streams the new posts of the followees of the authenticated user as
+// Server-Sent Events. Event ids are since cursors: a client resuming with Last-Event-ID first
+// receives the posts it missed, then the live ones.
+func (s *server) StreamTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	userID, err := authorize(r, "")
+	if err != nil {
+		respondAuthError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		RespondWithError(w, http.StatusInternalServerError, m.ErrStreamUnsupported.Error())
+		return
+	}
+
+	var (
+		replay   m.TimelineRequest
+		resuming bool
+	)
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		replay, err = loadTimelineParams(userID, strconv.Itoa(streamReplayPage), "", "", lastEventID)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resuming = true
+	}
+
+	// subscribe before replaying so that no post falls between the two, the duplicates are skipped
+	sub := s.Svc.Subscribe(userID, m.TimelineTopic(userID))
+	defer sub.Close()
+
+	var missed []m.Post
+	if resuming {
+		ctx, cancel := context.WithTimeout(r.Context(), liveQueryTimeout)
+		page, err := s.Svc.GetTimeline(ctx, replay)
+		cancel()
+		if err != nil {
+			RespondWithError(w, http.StatusInternalServerError, m.ErrCouldNotGetTimeline.Error())
+			return
+		}
+		missed = page.Posts
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// the replay pages are oldest first, later pages are fetched after the first one was sent
+	last := replay
+	for resuming {
+		for _, post := range missed {
+			if err := writePostEvent(w, post); err != nil {
+				return
+			}
+			last.After, last.AfterID = post.CreatedAt, post.ID
+		}
+		flusher.Flush()
+		if len(missed) < streamReplayPage {
+			break
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), liveQueryTimeout)
+		page, err := s.Svc.GetTimeline(ctx, last)
+		cancel()
+		if err != nil {
+			// the client reconnects and resumes from the last post it received
+			return
+		}
+		missed = page.Posts
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// the stream fell behind and was dropped, the client resumes with Last-Event-ID
+				return
+			}
+			post, ok := event.Data.(m.Post)
+			if !ok || !postAfter(post, last.After, last.AfterID) {
+				continue
+			}
+			if err := writePostEvent(w, post); err != nil {
+				return
+			}
+			flusher.Flush()
+			last.After, last.AfterID = post.CreatedAt, post.ID
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writePostEvent writes post as a "post" event whose id is the since cursor of the post
+func writePostEvent(w io.Writer, post m.Post) error {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: post\ndata: %s\n\n", encodeCursor(post), data)
+	return err
+}
+
+// postAfter reports whether post comes after (createdAt, id) in (created_at, id) order
+func postAfter(post m.Post, createdAt time.Time, id string) bool {
+	if !post.CreatedAt.Equal(createdAt) {
+		return post.CreatedAt.After(createdAt)
+	}
+	return post.ID > id
+}
@@ -0,0 +1,152 @@
+package server_test
+
+import (
+	"context"
+	"microblogging/model"
+	"microblogging/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamTimelineHandler(t *testing.T) {
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	at := time.Date(2025, 4, 18, 12, 0, 0, 0, time.UTC)
+	seen := model.Post{ID: "550e8400-e29b-41d4-a716-446655440001", UserID: userID, Content: "seen", CreatedAt: at}
+	missed := model.Post{ID: "550e8400-e29b-41d4-a716-446655440002", UserID: userID, Content: "missed", CreatedAt: at.Add(time.Second)}
+	live := model.Post{ID: "550e8400-e29b-41d4-a716-446655440003", UserID: userID, Content: "live", CreatedAt: at.Add(2 * time.Second)}
+
+	// stream serves a stream whose subscription already holds posts and is then dropped by the hub
+	stream := func(mockSvc *MockService, lastEventID string, posts ...model.Post) (*httptest.ResponseRecorder, *fakeSubscription) {
+		s := server.NewServer(context.Background(), mockSvc, testTokens)
+		sub := newFakeSubscription(len(posts))
+		for _, post := range posts {
+			sub.events <- model.Event{Channel: model.ChannelTimeline, Type: model.EventPost, Data: post}
+		}
+		close(sub.events)
+		mockSvc.On("Subscribe", userID, []model.Topic{model.TimelineTopic(userID)}).Return(sub)
+
+		req := withUser(httptest.NewRequest(http.MethodGet, "/timeline/stream", nil), userID)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		w := httptest.NewRecorder()
+		s.StreamTimelineHandler(w, req)
+		return w, sub
+	}
+
+	t.Run("Live", func(t *testing.T) {
+		mockSvc := new(MockService)
+		w, sub := stream(mockSvc, "", live)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "event: post\ndata: {")
+		assert.Contains(t, w.Body.String(), `"content":"live"`)
+		assert.True(t, sub.isClosed())
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		// the client received seen before disconnecting
+		w, _ := stream(new(MockService), "", seen)
+		lastEventID, _, _ := strings.Cut(strings.SplitN(w.Body.String(), "id: ", 2)[1], "\n")
+
+		mockSvc := new(MockService)
+		mockSvc.On("GetTimeline", mock.Anything, model.TimelineRequest{UserID: userID, Limit: 100, After: at, AfterID: seen.ID}).
+			Return(model.TimelineResponse{Posts: []model.Post{missed}}, nil)
+
+		// missed was published while the replay ran, it is sent once
+		w, _ = stream(mockSvc, lastEventID, missed, live)
+
+		body := w.Body.String()
+		assert.Equal(t, 1, strings.Count(body, `"content":"missed"`))
+		assert.Less(t, strings.Index(body, `"content":"missed"`), strings.Index(body, `"content":"live"`))
+		mockSvc.AssertExpectations(t)
+	})
+
+	t.Run("Invalid Last-Event-ID", func(t *testing.T) {
+		mockSvc := new(MockService)
+		s := server.NewServer(context.Background(), mockSvc, testTokens)
+		req := withUser(httptest.NewRequest(http.MethodGet, "/timeline/stream", nil), userID)
+		req.Header.Set("Last-Event-ID", "nope")
+		w := httptest.NewRecorder()
+		s.StreamTimelineHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockSvc.AssertNotCalled(t, "Subscribe", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Client Disconnects", func(t *testing.T) {
+		mockSvc := new(MockService)
+		s := server.NewServer(context.Background(), mockSvc, testTokens)
+		sub := newFakeSubscription(0)
+		mockSvc.On("Subscribe", userID, []model.Topic{model.TimelineTopic(userID)}).Return(sub)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req := withUser(httptest.NewRequest(http.MethodGet, "/timeline/stream", nil).WithContext(ctx), userID)
+		done := make(chan struct{})
+		go func() {
+			s.StreamTimelineHandler(httptest.NewRecorder(), req)
+			close(done)
+		}()
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("stream did not end when the client disconnected")
+		}
+		assert.True(t, sub.isClosed(), "subscription was not released")
+	})
+}
+
+// fakeSubscription is a service.Subscription whose events are written by the test
+type fakeSubscription struct {
+	mu     sync.Mutex
+	events chan model.Event
+	topics map[model.Topic]bool
+	closed bool
+}
+
+func newFakeSubscription(buffer int) *fakeSubscription {
+	return &fakeSubscription{events: make(chan model.Event, buffer), topics: make(map[model.Topic]bool)}
+}
+
+func (f *fakeSubscription) Events() <-chan model.Event { return f.events }
+
+func (f *fakeSubscription) Join(topic model.Topic) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.topics[topic] = true
+}
+
+func (f *fakeSubscription) Leave(topic model.Topic) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.topics, topic)
+}
+
+func (f *fakeSubscription) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+func (f *fakeSubscription) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *fakeSubscription) joined(topic model.Topic) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.topics[topic]
+}
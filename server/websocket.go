@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	m "microblogging/model"
+	"microblogging/service"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait bounds every write, a client that does not read is dropped
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long the connection lives without hearing from the client
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod must be shorter than wsPongWait so that pongs arrive in time
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize bounds client messages, they only carry subscription requests
+	wsMaxMessageSize = 1024
+	// wsReplyBuffer is the number of answers to subscription requests a connection can have pending
+	wsReplyBuffer = 16
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// WebSocketHandler is the websocket gateway. Clients authenticate on connect with a bearer token,
+// in the Authorization header or the access_token query parameter since browsers cannot set
+// headers on websockets, then subscribe to their timeline, their notifications and post threads
+// with SubscriptionRequest messages. Every message sent by the gateway is a model.Event.
+//
+// Each connection has bounded queues: a client that cannot keep up with its events, or floods the
+// gateway with requests, is disconnected.
+func (s *server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, m.ErrMethodNotAllowed.Error())
+		return
+	}
+
+	token, ok := bearerToken(r)
+	if !ok {
+		token = r.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		RespondWithError(w, http.StatusUnauthorized, m.ErrMissingToken.Error())
+		return
+	}
+	userID, err := s.tokens.Verify(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		RespondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// the upgrader answers failed handshakes itself
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub := s.Svc.Subscribe(userID)
+	defer sub.Close()
+
+	replies := make(chan m.Event, wsReplyBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.readSubscriptions(r.Context(), conn, userID, sub, replies)
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.ctx.Done():
+			writeClose(conn, websocket.CloseGoingAway, "server shutting down")
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				writeClose(conn, websocket.ClosePolicyViolation, "slow consumer")
+				return
+			}
+			if err := writeEvent(conn, event); err != nil {
+				return
+			}
+		case reply, ok := <-replies:
+			if !ok {
+				writeClose(conn, websocket.ClosePolicyViolation, "too many requests")
+				return
+			}
+			if err := writeEvent(conn, reply); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readSubscriptions applies the subscription requests of the client until the connection fails.
+// Answers are queued in replies, which is closed when the client sends requests faster than the
+// writer can answer them.
+func (s *server) readSubscriptions(ctx context.Context, conn *websocket.Conn, userID string, sub service.Subscription, replies chan<- m.Event) {
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var req m.SubscriptionRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				return
+			}
+			req = m.SubscriptionRequest{}
+		}
+
+		reply := s.applySubscription(ctx, userID, sub, req)
+		select {
+		case replies <- reply:
+		default:
+			close(replies)
+			return
+		}
+	}
+}
+
+// applySubscription joins or leaves the topic of req and returns the answer to send to the client
+func (s *server) applySubscription(ctx context.Context, userID string, sub service.Subscription, req m.SubscriptionRequest) m.Event {
+	reply := m.Event{Channel: req.Channel, PostID: req.PostID}
+
+	var topic m.Topic
+	switch req.Channel {
+	case m.ChannelTimeline:
+		topic = m.TimelineTopic(userID)
+	case m.ChannelNotifications:
+		topic = m.NotificationsTopic(userID)
+	case m.ChannelThread:
+		if !IsValidUUID(req.PostID) {
+			reply.Type, reply.Data = m.EventError, m.ErrInvalidUUID.Error()
+			return reply
+		}
+		topic = m.ThreadTopic(req.PostID)
+	default:
+		reply.Type, reply.Data = m.EventError, m.ErrInvalidChannel.Error()
+		return reply
+	}
+
+	switch req.Action {
+	case m.ActionSubscribe:
+		if topic.Channel == m.ChannelThread {
+			ctx, cancel := context.WithTimeout(ctx, liveQueryTimeout)
+			defer cancel()
+			if _, err := s.Svc.GetPost(ctx, userID, req.PostID); err != nil {
+				reply.Type, reply.Data = m.EventError, err.Error()
+				return reply
+			}
+		}
+		sub.Join(topic)
+		reply.Type = m.EventSubscribed
+	case m.ActionUnsubscribe:
+		sub.Leave(topic)
+		reply.Type = m.EventUnsubscribed
+	default:
+		reply.Type, reply.Data = m.EventError, m.ErrInvalidAction.Error()
+	}
+	return reply
+}
+
+func writeEvent(conn *websocket.Conn, event m.Event) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(event)
+}
+
+func writeClose(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}
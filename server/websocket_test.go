@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"context"
+	"microblogging/model"
+	"microblogging/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent reads the next event sent by the gateway
+func readEvent(t *testing.T, conn *websocket.Conn) model.Event {
+	t.Helper()
+	var event model.Event
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, conn.ReadJSON(&event))
+	return event
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	const postID = "550e8400-e29b-41d4-a716-446655440001"
+	const missingID = "550e8400-e29b-41d4-a716-446655440002"
+	token, _, err := testTokens.Issue(userID)
+	require.NoError(t, err)
+
+	mockSvc := new(MockService)
+	s := server.NewServer(context.Background(), mockSvc, testTokens)
+	ts := httptest.NewServer(http.HandlerFunc(s.WebSocketHandler))
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		_, resp, err = websocket.DefaultDialer.Dial(url+"?access_token=nope", nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		sub := newFakeSubscription(1)
+		mockSvc.On("Subscribe", userID, []model.Topic(nil)).Return(sub).Once()
+		mockSvc.On("GetPost", mock.Anything, userID, postID).Return(model.Post{ID: postID}, nil)
+		mockSvc.On("GetPost", mock.Anything, userID, missingID).Return(model.Post{}, model.ErrPostNotFound)
+
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?access_token="+token, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, conn.WriteJSON(model.SubscriptionRequest{Action: model.ActionSubscribe, Channel: model.ChannelTimeline}))
+		assert.Equal(t, model.Event{Channel: model.ChannelTimeline, Type: model.EventSubscribed}, readEvent(t, conn))
+		assert.True(t, sub.joined(model.TimelineTopic(userID)))
+
+		require.NoError(t, conn.WriteJSON(model.SubscriptionRequest{Action: model.ActionSubscribe, Channel: model.ChannelThread, PostID: postID}))
+		assert.Equal(t, model.EventSubscribed, readEvent(t, conn).Type)
+		assert.True(t, sub.joined(model.ThreadTopic(postID)))
+
+		require.NoError(t, conn.WriteJSON(model.SubscriptionRequest{Action: model.ActionSubscribe, Channel: model.ChannelThread, PostID: missingID}))
+		assert.Equal(t, model.Event{Channel: model.ChannelThread, PostID: missingID, Type: model.EventError, Data: model.ErrPostNotFound.Error()}, readEvent(t, conn))
+
+		require.NoError(t, conn.WriteJSON(model.SubscriptionRequest{Action: model.ActionSubscribe, Channel: "everything"}))
+		assert.Equal(t, model.EventError, readEvent(t, conn).Type)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+		assert.Equal(t, model.EventError, readEvent(t, conn).Type, "malformed requests are answered, not fatal")
+
+		require.NoError(t, conn.WriteJSON(model.SubscriptionRequest{Action: model.ActionUnsubscribe, Channel: model.ChannelThread, PostID: postID}))
+		assert.Equal(t, model.EventUnsubscribed, readEvent(t, conn).Type)
+		assert.False(t, sub.joined(model.ThreadTopic(postID)))
+
+		sub.events <- model.Event{Channel: model.ChannelTimeline, Type: model.EventPost, Data: map[string]interface{}{"id": postID}}
+		event := readEvent(t, conn)
+		assert.Equal(t, model.EventPost, event.Type)
+		assert.Equal(t, postID, event.Data.(map[string]interface{})["id"])
+	})
+
+	t.Run("Slow Consumer", func(t *testing.T) {
+		sub := newFakeSubscription(0)
+		mockSvc.On("Subscribe", userID, []model.Topic(nil)).Return(sub).Once()
+
+		header := http.Header{"Authorization": []string{"Bearer " + token}}
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		// the hub closes the events of a subscription that fell behind
+		close(sub.events)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+		assert.Eventually(t, sub.isClosed, time.Second, 10*time.Millisecond)
+	})
+
+	mockSvc.AssertExpectations(t)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxHashtagLength = 100
+
+// hashtagPattern matches a # that does not follow a word character (so "a#b" and "&#39;" are not
+// tags) and the letters, marks, digits and underscores after it.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_&])#([\p{L}\p{M}\p{N}_]+)`)
+
+// extractHashtags returns the distinct normalized hashtags of content, in order of appearance
+func extractHashtags(content string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		tag, ok := normalizeHashtag(match[1])
+		if !ok || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// normalizeHashtag case-folds tag, without its leading #, into its NFC form.
+// It reports false for tags without any letter (like #1) or longer than 100 characters.
+func normalizeHashtag(tag string) (string, bool) {
+	// a Caser is stateful, it cannot be shared between requests
+	tag = norm.NFC.String(cases.Fold().String(strings.TrimPrefix(tag, "#")))
+	if tag == "" || utf8.RuneCountInString(tag) > maxHashtagLength {
+		return "", false
+	}
+	if strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+		return "", false
+	}
+	for _, r := range tag {
+		if !unicode.In(r, unicode.L, unicode.M, unicode.N) && r != '_' {
+			return "", false
+		}
+	}
+	return tag, true
+}
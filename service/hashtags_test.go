@@ -0,0 +1,81 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := map[string]struct {
+		content  string
+		expected []string
+	}{
+		"none":               {content: "no tags here", expected: nil},
+		"case_folded":        {content: "#Go and #GOLANG and #go", expected: []string{"go", "golang"}},
+		"unicode":            {content: "Día de #Fútbol en #Straße #ΣΊΣΥΦΟΣ", expected: []string{"fútbol", "strasse", "σίσυφοσ"}},
+		"decomposed_accents": {content: "#caf\u00e9 #cafe\u0301", expected: []string{"caf\u00e9"}},
+		"punctuation":        {content: "(#one), #two! #three.", expected: []string{"one", "two", "three"}},
+		"underscores":        {content: "#snake_case", expected: []string{"snake_case"}},
+		"not_tags":           {content: "mail#tag &#39; # #1 #2024", expected: nil},
+		"adjacent":           {content: "#a#b", expected: []string{"a"}},
+		"too_long":           {content: "#" + strings.Repeat("a", maxHashtagLength+1), expected: nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, extractHashtags(tc.content))
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	tag, ok := normalizeHashtag("#GoLang")
+	assert.True(t, ok)
+	assert.Equal(t, "golang", tag)
+
+	for _, invalid := range []string{"", "#", "123", "go-lang", "two words"} {
+		_, ok := normalizeHashtag(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestHashtagsAreIndexedOnWrite(t *testing.T) {
+	userID := uuid.New().String()
+	postID := uuid.New().String()
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	mockRepo.On("Save", mock.Anything, mock.MatchedBy(func(p *model.Post) bool {
+		return assert.ObjectsAreEqual([]string{"go", "tips"}, p.Hashtags)
+	})).Return(uuid.MustParse(postID), nil)
+	_, err := svc.CreatePost(t.Context(), userID, model.CreatePostRequest{Content: "#Go #tips"})
+	assert.NoError(t, err)
+
+	mockRepo.On("UpdatePostPut", mock.Anything, model.CreatePostRequest{UserID: userID, PostID: postID, Content: "only #go", Hashtags: []string{"go"}}).Return(nil)
+	assert.NoError(t, svc.UpdatePostPut(t.Context(), userID, model.CreatePostRequest{PostID: postID, Content: "only #go"}))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetHashtagPosts(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	info := model.TimelineRequest{UserID: uuid.New().String(), Limit: 10, Before: time.Now()}
+
+	mockRepo.On("GetHashtagPosts", mock.Anything, "golang", info).Return(model.TimelineResponse{Posts: []model.Post{{ID: "1"}}}, nil)
+	posts, err := svc.GetHashtagPosts(t.Context(), "#GoLang", info)
+	assert.NoError(t, err)
+	assert.Len(t, posts.Posts, 1)
+
+	_, err = svc.GetHashtagPosts(t.Context(), "2024", info)
+	assert.ErrorIs(t, err, model.ErrInvalidHashtag)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	m "microblogging/model"
+
+	"github.com/google/uuid"
+)
+
+// subscriptionBuffer is the number of events a subscription can lag behind before it is dropped
+const subscriptionBuffer = 64
+
+// Subscription is a bounded queue of the live events of the topics it joined. It is closed, and
+// Events with it, when Close is called or when it falls behind.
+type Subscription interface {
+	Events() <-chan m.Event
+	Join(topic m.Topic)
+	Leave(topic m.Topic)
+	Close()
+}
+
+// eventHub is the in-process pub/sub behind the timeline streams and the websocket gateway
+type eventHub struct {
+	mu     sync.Mutex
+	topics map[m.Topic]map[*subscription]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{topics: make(map[m.Topic]map[*subscription]struct{})}
+}
+
+// subscription implements Subscription, its topics are guarded by the hub lock
+type subscription struct {
+	hub *eventHub
+	// userID is the subscriber, the events of posts it may not read are not delivered to it
+	userID string
+	events chan m.Event
+	topics map[m.Topic]struct{}
+	closed bool
+}
+
+// subscribe opens a subscription of userID to topics
+func (h *eventHub) subscribe(userID string, topics ...m.Topic) *subscription {
+	sub := &subscription{
+		hub:    h,
+		userID: userID,
+		events: make(chan m.Event, subscriptionBuffer),
+		topics: make(map[m.Topic]struct{}),
+	}
+	for _, topic := range topics {
+		sub.Join(topic)
+	}
+	return sub
+}
+
+func (sub *subscription) Events() <-chan m.Event {
+	return sub.events
+}
+
+// Join adds topic to the subscription, joining a topic twice is a no-op
+func (sub *subscription) Join(topic m.Topic) {
+	h := sub.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*subscription]struct{})
+	}
+	h.topics[topic][sub] = struct{}{}
+	sub.topics[topic] = struct{}{}
+}
+
+// Leave removes topic from the subscription
+func (sub *subscription) Leave(topic m.Topic) {
+	h := sub.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.leaveLocked(sub, topic)
+}
+
+// Close ends the subscription, it must be called once the subscriber is gone and is safe to
+// call more than once
+func (sub *subscription) Close() {
+	h := sub.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closeLocked(sub)
+}
+
+// subscribed returns the ids of the topics of channel with at least one subscriber
+func (h *eventHub) subscribed(channel string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var ids []string
+	for topic := range h.topics {
+		if topic.Channel == channel {
+			ids = append(ids, topic.ID)
+		}
+	}
+	return ids
+}
+
+// subscribers returns the users subscribed to topic
+func (h *eventHub) subscribers(topic m.Topic) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var userIDs []string
+	for sub := range h.topics[topic] {
+		userIDs = append(userIDs, sub.userID)
+	}
+	return userIDs
+}
+
+// publish delivers event to every subscriber of topic. Publishing never blocks: a subscription
+// whose queue is full is closed instead, its client resumes from the last event it received.
+func (h *eventHub) publish(topic m.Topic, event m.Event) {
+	h.publishTo(topic, event, nil)
+}
+
+// publishTo delivers event to the subscribers of topic in readers, every subscriber when readers is nil
+func (h *eventHub) publishTo(topic m.Topic, event m.Event, readers map[string]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.topics[topic] {
+		if readers != nil && !readers[sub.userID] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.closeLocked(sub)
+		}
+	}
+}
+
+// leaveLocked removes topic from sub, h.mu must be held
+func (h *eventHub) leaveLocked(sub *subscription, topic m.Topic) {
+	delete(sub.topics, topic)
+	subscribers, ok := h.topics[topic]
+	if !ok {
+		return
+	}
+	delete(subscribers, sub)
+	if len(subscribers) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// closeLocked leaves every topic of sub and closes its events, h.mu must be held
+func (h *eventHub) closeLocked(sub *subscription) {
+	if sub.closed {
+		return
+	}
+	for topic := range sub.topics {
+		h.leaveLocked(sub, topic)
+	}
+	sub.closed = true
+	close(sub.events)
+}
+
+// Subscribe opens a subscription of userID to topics, more can be joined later
+func (s *blogService) Subscribe(userID string, topics ...m.Topic) Subscription {
+	return s.hub.subscribe(userID, topics...)
+}
+
+// The publish functions below run after the change they announce was committed, so failures are
+// not reported: live clients miss the event and catch up when they read or reconnect.
+
+// publishPost pushes a saved post to the timelines of the followers of its author, to the threads
+// it belongs to, and notifies the author of the replied post and the mentioned users. The post is
+// only pushed to the users who may read it, and the post it shares.
+func (s *blogService) publishPost(ctx context.Context, postID uuid.UUID, authorID string) {
+	timelines := s.hub.subscribed(m.ChannelTimeline)
+	threads := s.hub.subscribed(m.ChannelThread)
+	notified := s.hub.subscribed(m.ChannelNotifications)
+	if len(timelines) == 0 && len(threads) == 0 && len(notified) == 0 {
+		return
+	}
+	post, err := s.repo.GetPost(ctx, postID.String())
+	if err != nil {
+		return
+	}
+
+	if len(timelines) > 0 {
+		if followerIDs, err := s.repo.FollowersAmong(ctx, authorID, timelines); err == nil {
+			for followerID := range s.readers(ctx, post, followerIDs) {
+				s.hub.publish(m.TimelineTopic(followerID), m.Event{Channel: m.ChannelTimeline, Type: m.EventPost, Data: post})
+			}
+		}
+	}
+	if post.InReplyTo != nil && len(threads) > 0 {
+		// the ancestors are read by the author of the reply, who replied to them
+		if ancestors, err := s.repo.GetAncestors(ctx, authorID, post.ID); err == nil {
+			var subscriberIDs []string
+			for _, ancestor := range ancestors {
+				subscriberIDs = append(subscriberIDs, s.hub.subscribers(m.ThreadTopic(ancestor.ID))...)
+			}
+			readers := s.readers(ctx, post, subscriberIDs)
+			for _, ancestor := range ancestors {
+				s.hub.publishTo(m.ThreadTopic(ancestor.ID), m.Event{Channel: m.ChannelThread, PostID: ancestor.ID, Type: m.EventReply, Data: post}, readers)
+			}
+		}
+	}
+	if len(notified) > 0 {
+		if post.InReplyTo != nil {
+			s.publishPostNotification(ctx, m.NotificationReply, authorID, *post.InReplyTo)
+		}
+		seen := make(map[string]bool)
+		for _, mention := range post.Mentions {
+			if seen[mention.UserID] || mention.UserID == authorID {
+				continue
+			}
+			seen[mention.UserID] = true
+			if blocked, err := s.repo.Blocked(ctx, mention.UserID, authorID); err == nil && !blocked {
+				s.publishNotification(mention.UserID, m.NotificationEvent{Type: m.NotificationMention, ActorID: authorID, PostID: &post.ID})
+			}
+		}
+	}
+}
+
+// readers returns the users of userIDs who may read post, and the post it shares, and whose feeds
+// and threads show it, they are checked in one query. Nobody reads post when the check fails.
+func (s *blogService) readers(ctx context.Context, post m.Post, userIDs []string) map[string]bool {
+	readers := make(map[string]bool, len(userIDs))
+	if len(userIDs) == 0 {
+		return readers
+	}
+	readerIDs, err := s.repo.ReadersAmong(ctx, post.ID, userIDs)
+	if err != nil {
+		return readers
+	}
+	for _, readerID := range readerIDs {
+		readers[readerID] = true
+	}
+	return readers
+}
+
+// publishPostNotification notifies the author of postID of an event of type kind done by actorID,
+// unless the author and actorID are blocking one another
+func (s *blogService) publishPostNotification(ctx context.Context, kind, actorID, postID string) {
+	if len(s.hub.subscribed(m.ChannelNotifications)) == 0 {
+		return
+	}
+	post, err := s.repo.GetPost(ctx, postID)
+	if err != nil {
+		return
+	}
+	if blocked, err := s.repo.Blocked(ctx, post.UserID, actorID); err != nil || blocked {
+		return
+	}
+	s.publishNotification(post.UserID, m.NotificationEvent{Type: kind, ActorID: actorID, PostID: &post.ID})
+}
+
+// publishNotification pushes a notification to recipientID, users are never notified of their own actions
+func (s *blogService) publishNotification(recipientID string, notification m.NotificationEvent) {
+	if recipientID == notification.ActorID {
+		return
+	}
+	s.hub.publish(m.NotificationsTopic(recipientID), m.Event{Channel: m.ChannelNotifications, Type: m.EventNotification, Data: notification})
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"testing"
+
+	"microblogging/model"
+	"microblogging/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub()
+	alice := hub.subscribe("alice", model.TimelineTopic("alice"))
+	bob := hub.subscribe("bob", model.TimelineTopic("bob"), model.ThreadTopic("post"))
+	assert.ElementsMatch(t, []string{"alice", "bob"}, hub.subscribed(model.ChannelTimeline))
+	assert.Equal(t, []string{"post"}, hub.subscribed(model.ChannelThread))
+	assert.Equal(t, []string{"bob"}, hub.subscribers(model.ThreadTopic("post")))
+
+	hub.publish(model.TimelineTopic("alice"), model.Event{Type: model.EventPost})
+	assert.Equal(t, model.EventPost, (<-alice.Events()).Type)
+	assert.Empty(t, bob.Events())
+	hub.publishTo(model.ThreadTopic("post"), model.Event{Type: model.EventReply}, map[string]bool{"alice": true})
+	assert.Empty(t, bob.Events(), "only the readers receive the event")
+
+	bob.Leave(model.ThreadTopic("post"))
+	assert.Empty(t, hub.subscribed(model.ChannelThread))
+	bob.Close()
+	bob.Close()
+	_, open := <-bob.Events()
+	assert.False(t, open, "closing ends the events")
+	bob.Join(model.TimelineTopic("bob"))
+	assert.Equal(t, []string{"alice"}, hub.subscribed(model.ChannelTimeline), "closed subscriptions cannot join")
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		hub.publish(model.TimelineTopic("alice"), model.Event{Type: model.EventPost})
+	}
+	assert.Empty(t, hub.subscribed(model.ChannelTimeline), "a subscription that falls behind is dropped")
+	for range alice.Events() {
+	}
+}
+
+func TestCreatePostPublishesToFollowers(t *testing.T) {
+	const authorID = "author"
+	postID := uuid.New()
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	follower := svc.Subscribe("follower", model.TimelineTopic("follower"))
+	defer follower.Close()
+	stranger := svc.Subscribe("stranger", model.TimelineTopic("stranger"))
+	defer stranger.Close()
+
+	mockRepo.On("Save", mock.Anything, mock.Anything).Return(postID, nil)
+	mockRepo.On("FollowersAmong", mock.Anything, authorID, mock.MatchedBy(func(ids []string) bool { return len(ids) == 2 })).
+		Return([]string{"follower"}, nil)
+	mockRepo.On("GetPost", mock.Anything, postID.String()).Return(model.Post{ID: postID.String(), UserID: authorID, Content: "hello"}, nil)
+	mockRepo.On("ReadersAmong", mock.Anything, postID.String(), []string{"follower"}).Return([]string{"follower"}, nil)
+
+	_, err := svc.CreatePost(t.Context(), authorID, model.CreatePostRequest{Content: "hello"})
+
+	require.NoError(t, err)
+	require.Len(t, follower.Events(), 1)
+	event := <-follower.Events()
+	assert.Equal(t, model.ChannelTimeline, event.Channel)
+	assert.Equal(t, "hello", event.Data.(model.Post).Content)
+	assert.Empty(t, stranger.Events())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRepostPublishesToReadersOfTheOriginal(t *testing.T) {
+	const reposterID, privateID = "reposter", "private"
+	postID := uuid.New()
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	reader := svc.Subscribe("reader", model.TimelineTopic("reader"))
+	defer reader.Close()
+	stranger := svc.Subscribe("stranger", model.TimelineTopic("stranger"))
+	defer stranger.Close()
+
+	original := model.Post{ID: uuid.New().String(), UserID: privateID, Content: "private"}
+	repost := model.Post{ID: postID.String(), UserID: reposterID, Kind: model.PostKindRepost, RepostOf: &original.ID, Original: &original}
+	mockRepo.On("FollowersAmong", mock.Anything, reposterID, mock.Anything).Return([]string{"reader", "stranger"}, nil)
+	mockRepo.On("GetPost", mock.Anything, postID.String()).Return(repost, nil)
+	mockRepo.On("ReadersAmong", mock.Anything, postID.String(), []string{"reader", "stranger"}).Return([]string{"reader"}, nil)
+
+	svc.(*blogService).publishPost(t.Context(), postID, reposterID)
+
+	require.Len(t, reader.Events(), 1)
+	assert.Equal(t, repost, (<-reader.Events()).Data)
+	assert.Empty(t, stranger.Events(), "reposts of private posts only reach the followers of their author")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLiveTimelineSkipsMutersAndBlockers(t *testing.T) {
+	svc := NewBlogService(repository.NewMemoryRepository(zap.NewNop()))
+	createUser := func(name string) string {
+		t.Helper()
+		id, err := svc.CreateUser(t.Context(), model.CreateUserRequest{Name: name, Email: name + "@example.com", Password: "password123"})
+		require.NoError(t, err)
+		return id.String()
+	}
+	authorID, muterID, readerID, reposterID := createUser("author"), createUser("muter"), createUser("reader"), createUser("reposter")
+	for _, followerID := range []string{muterID, readerID} {
+		_, err := svc.FollowUser(t.Context(), followerID, authorID)
+		require.NoError(t, err)
+	}
+	_, err := svc.FollowUser(t.Context(), muterID, reposterID)
+	require.NoError(t, err)
+	require.NoError(t, svc.MuteUser(t.Context(), muterID, authorID))
+
+	muter := svc.Subscribe(muterID, model.TimelineTopic(muterID))
+	defer muter.Close()
+	reader := svc.Subscribe(readerID, model.TimelineTopic(readerID))
+	defer reader.Close()
+
+	postID, err := svc.CreatePost(t.Context(), authorID, model.CreatePostRequest{Content: "hello"})
+	require.NoError(t, err)
+	_, err = svc.Repost(t.Context(), reposterID, postID.String())
+	require.NoError(t, err)
+
+	require.Len(t, reader.Events(), 1)
+	assert.Equal(t, postID.String(), (<-reader.Events()).Data.(model.Post).ID)
+	assert.Empty(t, muter.Events(), "neither the post nor its repost reach a user who muted the author")
+}
+
+func TestReplyPublishesToThreadsAndNotifications(t *testing.T) {
+	rootID, parentID := "root", "parent"
+	replyID := uuid.New()
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	thread := svc.Subscribe("dave", model.ThreadTopic(rootID))
+	defer thread.Close()
+	outsider := svc.Subscribe("eve", model.ThreadTopic(rootID))
+	defer outsider.Close()
+	parentAuthor := svc.Subscribe("bob", model.NotificationsTopic("bob"))
+	defer parentAuthor.Close()
+	mentioned := svc.Subscribe("carol", model.NotificationsTopic("carol"))
+	defer mentioned.Close()
+
+	reply := model.Post{ID: replyID.String(), UserID: "alice", Content: "@carol look", InReplyTo: &parentID, Mentions: model.Mentions{{UserID: "carol"}}}
+	mockRepo.On("Save", mock.Anything, mock.Anything).Return(replyID, nil)
+	mockRepo.On("GetPost", mock.Anything, replyID.String()).Return(reply, nil)
+	mockRepo.On("GetAncestors", mock.Anything, "alice", replyID.String()).Return([]model.Post{{ID: rootID}, {ID: parentID}}, nil)
+	mockRepo.On("GetPost", mock.Anything, parentID).Return(model.Post{ID: parentID, UserID: "bob"}, nil)
+	mockRepo.On("Blocked", mock.Anything, "carol", "alice").Return(false, nil)
+	mockRepo.On("Blocked", mock.Anything, "bob", "alice").Return(false, nil)
+	// alice is private, eve does not follow her
+	mockRepo.On("ReadersAmong", mock.Anything, replyID.String(), mock.MatchedBy(func(ids []string) bool { return len(ids) == 2 })).
+		Return([]string{"dave"}, nil)
+
+	_, err := svc.CreatePost(t.Context(), "alice", model.CreatePostRequest{Content: "@carol look", InReplyTo: parentID})
+
+	require.NoError(t, err)
+	require.Len(t, thread.Events(), 1)
+	assert.Equal(t, model.Event{Channel: model.ChannelThread, PostID: rootID, Type: model.EventReply, Data: reply}, <-thread.Events())
+	assert.Empty(t, outsider.Events(), "replies of private accounts only reach their followers")
+	require.Len(t, parentAuthor.Events(), 1)
+	assert.Equal(t, model.NotificationEvent{Type: model.NotificationReply, ActorID: "alice", PostID: &parentID}, (<-parentAuthor.Events()).Data)
+	require.Len(t, mentioned.Events(), 1)
+	assert.Equal(t, model.NotificationMention, (<-mentioned.Events()).Data.(model.NotificationEvent).Type)
+}
+
+func TestLikeSkipsNotificationOfBlockedUsers(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	author := svc.Subscribe("bob", model.NotificationsTopic("bob"))
+	defer author.Close()
+
+	mockRepo.On("LikePost", mock.Anything, "alice", "post").Return(true, nil)
+	mockRepo.On("GetPost", mock.Anything, "post").Return(model.Post{ID: "post", UserID: "bob"}, nil)
+	mockRepo.On("Blocked", mock.Anything, "bob", "alice").Return(true, nil)
+
+	require.NoError(t, svc.LikePost(t.Context(), "alice", "post"))
+	assert.Empty(t, author.Events(), "users blocking one another are not notified of each other")
+}
+
+func TestRepeatedLikeIsNotNotified(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	author := svc.Subscribe("bob", model.NotificationsTopic("bob"))
+	defer author.Close()
+
+	mockRepo.On("LikePost", mock.Anything, "alice", "post").Return(false, nil)
+
+	require.NoError(t, svc.LikePost(t.Context(), "alice", "post"))
+	assert.Empty(t, author.Events(), "liking twice notifies once")
+	mockRepo.AssertNotCalled(t, "GetPost", mock.Anything, "post")
+}
+
+func TestFollowPublishesNotification(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	followee := svc.Subscribe("bob", model.NotificationsTopic("bob"))
+	defer followee.Close()
+
+	mockRepo.On("FollowUser", mock.Anything, "alice", "bob").Return(model.FollowActive, true, nil).Once()
+	mockRepo.On("FollowUser", mock.Anything, "alice", "bob").Return(model.FollowActive, false, nil).Once()
+	mockRepo.On("FollowUser", mock.Anything, "carol", "bob").Return(model.FollowPending, true, nil)
+
+	_, err := svc.FollowUser(t.Context(), "alice", "bob")
+	require.NoError(t, err)
+	_, err = svc.FollowUser(t.Context(), "alice", "bob")
+	require.NoError(t, err)
+	_, err = svc.FollowUser(t.Context(), "carol", "bob")
+	require.NoError(t, err)
+	require.Len(t, followee.Events(), 1, "follow requests and repeated follows are not notified")
+	assert.Equal(t, model.NotificationEvent{Type: model.NotificationFollow, ActorID: "alice"}, (<-followee.Events()).Data)
+}
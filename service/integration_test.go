@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"microblogging/model"
+	"microblogging/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// TestBlogServiceInMemory runs the main user flows against the in-memory repository
+func TestBlogServiceInMemory(t *testing.T) {
+	svc := NewBlogService(repository.NewMemoryRepository(zap.NewNop()))
+
+	alice, err := svc.CreateUser(t.Context(), model.CreateUserRequest{Name: "alice", Email: "alice@example.com", Password: "password123"})
+	require.NoError(t, err)
+	bob, err := svc.CreateUser(t.Context(), model.CreateUserRequest{Name: "bob", Email: "bob@example.com", Password: "password123"})
+	require.NoError(t, err)
+
+	loggedIn, err := svc.Login(t.Context(), model.LoginRequest{Email: "alice@example.com", Password: "password123"})
+	require.NoError(t, err)
+	assert.Equal(t, alice.String(), loggedIn)
+
+	state, err := svc.FollowUser(t.Context(), alice.String(), bob.String())
+	require.NoError(t, err)
+	assert.Equal(t, model.FollowActive, state)
+	postID, err := svc.CreatePost(t.Context(), bob.String(), model.CreatePostRequest{Content: "Hello from bob"})
+	require.NoError(t, err)
+
+	timeline, err := svc.GetTimeline(t.Context(), model.TimelineRequest{UserID: alice.String(), Before: time.Now().Add(time.Minute), Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, timeline.Posts, 1)
+	assert.Equal(t, postID.String(), timeline.Posts[0].ID)
+
+	require.NoError(t, svc.UnfollowUser(t.Context(), alice.String(), bob.String()))
+	timeline, err = svc.GetTimeline(t.Context(), model.TimelineRequest{UserID: alice.String(), Before: time.Now().Add(time.Minute), Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, timeline.Posts)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"regexp"
+	"unicode/utf8"
+
+	m "microblogging/model"
+)
+
+// usernameChars is the class of the characters of a username
+const usernameChars = `[\p{L}\p{M}\p{N}_]`
+
+// mentionPattern matches an @ that does not follow a word character (so emails are not mentions)
+// and the username after it.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_@])@(` + usernameChars + `+)`)
+
+// usernamePattern matches the usernames users can sign up with, those mentionPattern matches in full
+var usernamePattern = regexp.MustCompile(`^` + usernameChars + `+$`)
+
+// extractMentions returns every @username of content with its position counted in characters.
+// Usernames are resolved to users by the repository, unknown ones are dropped there.
+func extractMentions(content string) []m.Mention {
+	var mentions []m.Mention
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		// match[2]:match[3] is the username, the @ is the byte before it
+		at := match[2] - 1
+		mentions = append(mentions, m.Mention{
+			Offset:   utf8.RuneCountInString(content[:at]),
+			Length:   utf8.RuneCountInString(content[at:match[3]]),
+			Username: content[match[2]:match[3]],
+		})
+	}
+	return mentions
+}
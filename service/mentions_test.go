@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+
+	"microblogging/model"
+	"microblogging/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := map[string]struct {
+		content  string
+		expected []model.Mention
+	}{
+		"none":     {content: "no mentions", expected: nil},
+		"start":    {content: "@alice hi", expected: []model.Mention{{Offset: 0, Length: 6, Username: "alice"}}},
+		"several":  {content: "hi @bob, @carol_1!", expected: []model.Mention{{Offset: 3, Length: 4, Username: "bob"}, {Offset: 9, Length: 8, Username: "carol_1"}}},
+		"unicode":  {content: "¡olé @josé!", expected: []model.Mention{{Offset: 5, Length: 5, Username: "josé"}}},
+		"email":    {content: "mail me at bob@example.com", expected: nil},
+		"repeated": {content: "@bob @bob", expected: []model.Mention{{Offset: 0, Length: 4, Username: "bob"}, {Offset: 5, Length: 4, Username: "bob"}}},
+		"bare_at":  {content: "meet @ noon", expected: nil},
+		"dotted":   {content: "@john.doe", expected: []model.Mention{{Offset: 0, Length: 5, Username: "john"}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, extractMentions(tc.content))
+		})
+	}
+}
+
+func TestUsernamesAreMentionable(t *testing.T) {
+	svc := NewBlogService(repository.NewMemoryRepository(zap.NewNop()))
+	john, err := svc.CreateUser(t.Context(), model.CreateUserRequest{Name: "john", Email: "john@example.com", Password: "password123"})
+	require.NoError(t, err)
+
+	_, err = svc.CreateUser(t.Context(), model.CreateUserRequest{Name: "john.doe", Email: "john.doe@example.com", Password: "password123"})
+	assert.Equal(t, model.ErrInvalidUsername, err, "@john.doe would mention john")
+	_, err = svc.CreateUser(t.Context(), model.CreateUserRequest{Name: "josé_1", Email: "jose@example.com", Password: "password123"})
+	assert.NoError(t, err)
+
+	postID, err := svc.CreatePost(t.Context(), john.String(), model.CreatePostRequest{Content: "hi @john.doe"})
+	require.NoError(t, err)
+	post, err := svc.GetPost(t.Context(), john.String(), postID.String())
+	require.NoError(t, err)
+	assert.Equal(t, model.Mentions{{Offset: 3, Length: 5, UserID: john.String()}}, post.Mentions)
+}
+
+func TestMentionsAreParsedOnWrite(t *testing.T) {
+	userID := uuid.New().String()
+	postID := uuid.New().String()
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	mockRepo.On("Save", mock.Anything, mock.MatchedBy(func(p *model.Post) bool {
+		return len(p.Mentions) == 1 && p.Mentions[0].Username == "bob"
+	})).Return(uuid.MustParse(postID), nil)
+	_, err := svc.CreatePost(t.Context(), userID, model.CreatePostRequest{Content: "hi @bob"})
+	assert.NoError(t, err)
+
+	mockRepo.On("UpdatePostPut", mock.Anything, model.CreatePostRequest{UserID: userID, PostID: postID, Content: "hi @carol", Mentions: []model.Mention{{Offset: 3, Length: 6, Username: "carol"}}}).Return(nil)
+	assert.NoError(t, svc.UpdatePostPut(t.Context(), userID, model.CreatePostRequest{PostID: postID, Content: "hi @carol"}))
+
+	mockRepo.AssertExpectations(t)
+}
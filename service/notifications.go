@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	m "microblogging/model"
+)
+
+// notificationActions completes the message of a notification group, by type
+var notificationActions = map[string]string{
+	m.NotificationFollow:  "followed you",
+	m.NotificationLike:    "liked your post",
+	m.NotificationReply:   "replied to your post",
+	m.NotificationMention: "mentioned you",
+}
+
+// GetNotifications returns a page of the notification groups of info.UserID with their messages,
+// and the number of unread notifications
+func (s *blogService) GetNotifications(ctx context.Context, info m.TimelineRequest) (m.NotificationsResponse, error) {
+	groups, err := s.repo.GetNotifications(ctx, info)
+	if err != nil {
+		return m.NotificationsResponse{}, err
+	}
+	unread, err := s.repo.CountUnreadNotifications(ctx, info.UserID)
+	if err != nil {
+		return m.NotificationsResponse{}, err
+	}
+	for i := range groups {
+		groups[i].Message = notificationMessage(groups[i])
+	}
+	return m.NotificationsResponse{Notifications: groups, UnreadCount: unread}, nil
+}
+
+// MarkNotificationsRead marks the groups ids of userID as read, or all of them when ids is empty
+func (s *blogService) MarkNotificationsRead(ctx context.Context, userID string, ids []string) (m.ReadNotificationsResponse, error) {
+	marked, err := s.repo.MarkNotificationsRead(ctx, userID, ids)
+	if err != nil {
+		return m.ReadNotificationsResponse{}, err
+	}
+	unread, err := s.repo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return m.ReadNotificationsResponse{}, err
+	}
+	return m.ReadNotificationsResponse{Marked: marked, UnreadCount: unread}, nil
+}
+
+// notificationMessage renders a group as "alice liked your post", "alice and bob liked your post"
+// or "alice and 4 others liked your post"
+func notificationMessage(group m.NotificationGroup) string {
+	if len(group.Actors) == 0 {
+		return ""
+	}
+	action := notificationActions[group.Type]
+	first := group.Actors[0].Name
+	switch {
+	case group.ActorCount == 1:
+		return fmt.Sprintf("%s %s", first, action)
+	case group.ActorCount == 2 && len(group.Actors) == 2:
+		return fmt.Sprintf("%s and %s %s", first, group.Actors[1].Name, action)
+	case group.ActorCount == 2:
+		return fmt.Sprintf("%s and 1 other %s", first, action)
+	default:
+		return fmt.Sprintf("%s and %d others %s", first, group.ActorCount-1, action)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"microblogging/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationMessage(t *testing.T) {
+	alice := model.UserSummary{ID: "1", Name: "alice"}
+	bob := model.UserSummary{ID: "2", Name: "bob"}
+	carol := model.UserSummary{ID: "3", Name: "carol"}
+	tests := map[string]struct {
+		group    model.NotificationGroup
+		expected string
+	}{
+		"one":        {group: model.NotificationGroup{Type: model.NotificationFollow, ActorCount: 1, Actors: []model.UserSummary{alice}}, expected: "alice followed you"},
+		"two":        {group: model.NotificationGroup{Type: model.NotificationLike, ActorCount: 2, Actors: []model.UserSummary{alice, bob}}, expected: "alice and bob liked your post"},
+		"two_hidden": {group: model.NotificationGroup{Type: model.NotificationReply, ActorCount: 2, Actors: []model.UserSummary{alice}}, expected: "alice and 1 other replied to your post"},
+		"many":       {group: model.NotificationGroup{Type: model.NotificationMention, ActorCount: 5, Actors: []model.UserSummary{alice, bob, carol}}, expected: "alice and 4 others mentioned you"},
+		"no_actors":  {group: model.NotificationGroup{Type: model.NotificationLike}, expected: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, notificationMessage(tc.group))
+		})
+	}
+}
+
+func TestGetNotifications(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	info := model.TimelineRequest{UserID: "user-1", Before: time.Now(), Limit: 10}
+	groups := []model.NotificationGroup{{ID: "n1", Type: model.NotificationLike, ActorCount: 1, Actors: []model.UserSummary{{ID: "2", Name: "bob"}}}}
+
+	mockRepo.On("GetNotifications", mock.Anything, info).Return(groups, nil)
+	mockRepo.On("CountUnreadNotifications", mock.Anything, "user-1").Return(1, nil)
+
+	resp, err := svc.GetNotifications(t.Context(), info)
+
+	require.NoError(t, err)
+	require.Len(t, resp.Notifications, 1)
+	assert.Equal(t, "bob liked your post", resp.Notifications[0].Message)
+	assert.Equal(t, 1, resp.UnreadCount)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	mockRepo.On("MarkNotificationsRead", mock.Anything, "user-1", []string{"n1"}).Return(2, nil)
+	mockRepo.On("CountUnreadNotifications", mock.Anything, "user-1").Return(3, nil)
+
+	resp, err := svc.MarkNotificationsRead(t.Context(), "user-1", []string{"n1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, model.ReadNotificationsResponse{Marked: 2, UnreadCount: 3}, resp)
+	mockRepo.AssertExpectations(t)
+}
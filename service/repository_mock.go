@@ -1,8 +1,10 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"microblogging/model"
+	"microblogging/repository"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
@@ -12,48 +14,217 @@ type MockPostRepository struct {
 	mock.Mock
 }
 
-func (m *MockPostRepository) Save(post *model.Post) (uuid.UUID, error) {
-	args := m.Called(post)
+func (m *MockPostRepository) Save(ctx context.Context, post *model.Post) (uuid.UUID, error) {
+	args := m.Called(ctx, post)
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
-func (m *MockPostRepository) GetTimeline(info model.TimelineRequest) (model.TimelineResponse, error) {
-	args := m.Called(info)
+func (m *MockPostRepository) GetTimeline(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, info)
 	return args.Get(0).(model.TimelineResponse), args.Error(1)
 }
 
-func (m *MockPostRepository) FollowUser(followerID, followeeID string) error {
-	args := m.Called(followerID, followeeID)
-	return args.Error(0)
+func (m *MockPostRepository) GetPost(ctx context.Context, postID string) (model.Post, error) {
+	args := m.Called(ctx, postID)
+	return args.Get(0).(model.Post), args.Error(1)
+}
+
+func (m *MockPostRepository) GetPostRevisions(ctx context.Context, postID string) ([]model.PostRevision, error) {
+	args := m.Called(ctx, postID)
+	return args.Get(0).([]model.PostRevision), args.Error(1)
+}
+
+func (m *MockPostRepository) GetHashtagPosts(ctx context.Context, tag string, info model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, tag, info)
+	return args.Get(0).(model.TimelineResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) GetMentions(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, info)
+	return args.Get(0).(model.TimelineResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) GetUserPosts(ctx context.Context, info model.TimelineRequest) (model.TimelineResponse, error) {
+	args := m.Called(ctx, info)
+	return args.Get(0).(model.TimelineResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) GetAncestors(ctx context.Context, viewerID, postID string) ([]model.Post, error) {
+	args := m.Called(ctx, viewerID, postID)
+	return args.Get(0).([]model.Post), args.Error(1)
+}
+
+func (m *MockPostRepository) GetReplies(ctx context.Context, req model.ThreadRequest) ([]model.Post, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]model.Post), args.Error(1)
+}
+
+func (m *MockPostRepository) LikePost(ctx context.Context, userID, postID string) (bool, error) {
+	args := m.Called(ctx, userID, postID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPostRepository) UnlikePost(ctx context.Context, userID, postID string) (bool, error) {
+	args := m.Called(ctx, userID, postID)
+	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockPostRepository) UnfollowUser(followerID, followeeID string) error {
-	args := m.Called(followerID, followeeID)
+func (m *MockPostRepository) FollowUser(ctx context.Context, followerID, followeeID string) (string, bool, error) {
+	args := m.Called(ctx, followerID, followeeID)
+	return args.String(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockPostRepository) UnfollowUser(ctx context.Context, followerID, followeeID string) error {
+	args := m.Called(ctx, followerID, followeeID)
 	return args.Error(0)
 }
-func (m *MockPostRepository) GetFollowees(userID string, limit int) ([]string, error) {
-	args := m.Called(userID, limit)
+func (m *MockPostRepository) GetFollowees(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) GetFollowers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error) {
+	args := m.Called(ctx, followeeID, userIDs)
 	return args.Get(0).([]string), args.Error(1)
 }
 
-func (m *MockPostRepository) CreateUser(userData model.CreateUserRequest) (uuid.UUID, error) {
-	args := m.Called(userData)
+func (m *MockPostRepository) ReadersAmong(ctx context.Context, postID string, userIDs []string) ([]string, error) {
+	args := m.Called(ctx, postID, userIDs)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockPostRepository) GetFollowRequests(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	args := m.Called(ctx, followeeID, followerID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) RejectFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	args := m.Called(ctx, followeeID, followerID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) SetPrivate(ctx context.Context, userID string, private bool) error {
+	args := m.Called(ctx, userID, private)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) CanViewPosts(ctx context.Context, viewerID, authorID string) (bool, error) {
+	args := m.Called(ctx, viewerID, authorID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPostRepository) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	args := m.Called(ctx, blockerID, blockedID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) GetBlockedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) Blocked(ctx context.Context, userID, otherID string) (bool, error) {
+	args := m.Called(ctx, userID, otherID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPostRepository) Muted(ctx context.Context, muterID, mutedID string) (bool, error) {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPostRepository) MuteUser(ctx context.Context, muterID, mutedID string) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) UnmuteUser(ctx context.Context, muterID, mutedID string) error {
+	args := m.Called(ctx, muterID, mutedID)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) GetMutedUsers(ctx context.Context, req model.FollowListRequest) (model.FollowListResponse, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(model.FollowListResponse), args.Error(1)
+}
+
+func (m *MockPostRepository) CreateUser(ctx context.Context, userData model.CreateUserRequest) (uuid.UUID, error) {
+	args := m.Called(ctx, userData)
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
-func (m *MockPostRepository) UpdatePostPut(post model.CreatePostRequest) error {
+func (m *MockPostRepository) UpdatePostPut(ctx context.Context, post model.CreatePostRequest) error {
 	fmt.Println("Mock called with:", post)
 
-	args := m.Called(post)
+	args := m.Called(ctx, post)
+	return args.Error(0)
+}
+
+func (m *MockPostRepository) PatchPost(ctx context.Context, post model.PatchPostRequest) (int, error) {
+	args := m.Called(ctx, post)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockPostRepository) DeletePost(ctx context.Context, postID, userID string) error {
+	args := m.Called(ctx, postID, userID)
 	return args.Error(0)
 }
 
-func (m *MockPostRepository) DeleteUser(userID string) error {
-	args := m.Called(userID)
+// WithTx runs fn with the mock itself, the calls fn makes are expected on m
+func (m *MockPostRepository) WithTx(ctx context.Context, fn func(repo repository.PostRepository) error) error {
+	args := m.Called(ctx)
+	if err := args.Error(0); err != nil {
+		return err
+	}
+	return fn(m)
+}
+
+func (m *MockPostRepository) DeleteUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
 	return args.Error(0)
 }
 
-func (m *MockPostRepository) GetUser(userID string) (model.User, error) {
-	args := m.Called(userID)
+func (m *MockPostRepository) GetUser(ctx context.Context, userID string) (model.User, error) {
+	args := m.Called(ctx, userID)
 	return args.Get(0).(model.User), args.Error(1)
 }
+
+func (m *MockPostRepository) GetUserProfile(ctx context.Context, userID string) (model.UserProfile, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(model.UserProfile), args.Error(1)
+}
+
+func (m *MockPostRepository) GetUserCredentials(ctx context.Context, email string) (model.UserCredentials, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(model.UserCredentials), args.Error(1)
+}
+
+func (m *MockPostRepository) GetNotifications(ctx context.Context, info model.TimelineRequest) ([]model.NotificationGroup, error) {
+	args := m.Called(ctx, info)
+	return args.Get(0).([]model.NotificationGroup), args.Error(1)
+}
+
+func (m *MockPostRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockPostRepository) MarkNotificationsRead(ctx context.Context, userID string, ids []string) (int, error) {
+	args := m.Called(ctx, userID, ids)
+	return args.Int(0), args.Error(1)
+}
@@ -1,6 +1,10 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"microblogging/auth"
 	m "microblogging/model"
 	"microblogging/repository"
 	"time"
@@ -9,60 +13,511 @@ import (
 )
 
 type BlogService interface {
-	CreatePost(userID, content string) (uuid.UUID, error)
-	GetTimeline(timeLine m.TimelineRequest) (m.TimelineResponse, error)
-	FollowUser(followerID, followeeID string) error
-	UnfollowUser(followerID, followeeID string) error
-	GetFollowees(userID string, limit int) ([]string, error)
-	CreateUser(userData m.CreateUserRequest) (uuid.UUID, error)
-	UpdatePostPut(post m.CreatePostRequest) error
-	DeleteUser(userID string) error
-	GetUser(userID string) (m.User, error)
+	CreatePost(ctx context.Context, userID string, post m.CreatePostRequest) (uuid.UUID, error)
+	Repost(ctx context.Context, userID, postID string) (uuid.UUID, error)
+	GetTimeline(ctx context.Context, timeLine m.TimelineRequest) (m.TimelineResponse, error)
+	Subscribe(userID string, topics ...m.Topic) Subscription
+	GetPost(ctx context.Context, viewerID, postID string) (m.Post, error)
+	GetPostRevisions(ctx context.Context, viewerID, postID string) ([]m.PostRevision, error)
+	GetUserPosts(ctx context.Context, info m.TimelineRequest) (m.TimelineResponse, error)
+	GetHashtagPosts(ctx context.Context, tag string, info m.TimelineRequest) (m.TimelineResponse, error)
+	GetMentions(ctx context.Context, info m.TimelineRequest) (m.TimelineResponse, error)
+	GetNotifications(ctx context.Context, info m.TimelineRequest) (m.NotificationsResponse, error)
+	MarkNotificationsRead(ctx context.Context, userID string, ids []string) (m.ReadNotificationsResponse, error)
+	GetThread(ctx context.Context, req m.ThreadRequest) (m.Thread, error)
+	FollowUser(ctx context.Context, followerID, followeeID string) (string, error)
+	UnfollowUser(ctx context.Context, followerID, followeeID string) error
+	GetFollowRequests(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error)
+	ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error
+	RejectFollowRequest(ctx context.Context, followeeID, followerID string) error
+	SetPrivate(ctx context.Context, userID string, private bool) error
+	BlockUser(ctx context.Context, blockerID, blockedID string) error
+	UnblockUser(ctx context.Context, blockerID, blockedID string) error
+	GetBlockedUsers(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error)
+	MuteUser(ctx context.Context, muterID, mutedID string) error
+	UnmuteUser(ctx context.Context, muterID, mutedID string) error
+	GetMutedUsers(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error)
+	GetFollowees(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error)
+	GetFollowers(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error)
+	CreateUser(ctx context.Context, userData m.CreateUserRequest) (uuid.UUID, error)
+	UpdatePostPut(ctx context.Context, userID string, post m.CreatePostRequest) error
+	PatchPost(ctx context.Context, userID string, post m.PatchPostRequest) (int, error)
+	DeletePost(ctx context.Context, userID, postID string) error
+	LikePost(ctx context.Context, userID, postID string) error
+	UnlikePost(ctx context.Context, userID, postID string) error
+	DeleteUser(ctx context.Context, actorID, userID string) error
+	GetUser(ctx context.Context, userID string) (m.User, error)
+	GetUserProfile(ctx context.Context, viewerID, userID string) (m.UserProfile, error)
+	Login(ctx context.Context, req m.LoginRequest) (string, error)
 }
 
 type blogService struct {
 	repo repository.PostRepository
+	hub  *eventHub
+	// editWindow is how long after their creation posts can be edited, zero means forever
+	editWindow time.Duration
 }
 
-func NewBlogService(r repository.PostRepository) BlogService {
-	return &blogService{repo: r}
+// Option configures a BlogService
+type Option func(*blogService)
+
+// WithEditWindow rejects the edits of posts created more than window ago
+func WithEditWindow(window time.Duration) Option {
+	return func(s *blogService) {
+		s.editWindow = window
+	}
+}
+
+func NewBlogService(r repository.PostRepository, opts ...Option) BlogService {
+	s := &blogService{repo: r, hub: newEventHub()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// CreatePost creates a post written by userID. It is a reply when post.InReplyTo is set and a
+// quote when post.QuoteOf is set.
+func (s *blogService) CreatePost(ctx context.Context, userID string, post m.CreatePostRequest) (uuid.UUID, error) {
+	newPost := &m.Post{
+		UserID:    userID,
+		Content:   post.Content,
+		CreatedAt: time.Now(),
+		Kind:      m.PostKindPost,
+		Hashtags:  extractHashtags(post.Content),
+		Mentions:  extractMentions(post.Content),
+	}
+	if post.InReplyTo != "" {
+		newPost.InReplyTo = &post.InReplyTo
+	}
+	if post.QuoteOf != "" {
+		sharedID, err := s.sharedPostID(ctx, userID, post.QuoteOf)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		newPost.Kind = m.PostKindQuote
+		newPost.RepostOf = &sharedID
+	}
+	return s.savePost(ctx, newPost)
 }
 
-func (s *blogService) CreatePost(userID, content string) (uuid.UUID, error) {
-	post := &m.Post{
+// Repost shares postID as is on behalf of userID
+func (s *blogService) Repost(ctx context.Context, userID, postID string) (uuid.UUID, error) {
+	sharedID, err := s.sharedPostID(ctx, userID, postID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return s.savePost(ctx, &m.Post{
 		UserID:    userID,
-		Content:   content,
 		CreatedAt: time.Now(),
+		Kind:      m.PostKindRepost,
+		RepostOf:  &sharedID,
+	})
+}
+
+// savePost saves a new post and publishes it to the timeline streams of its author's followers
+func (s *blogService) savePost(ctx context.Context, post *m.Post) (uuid.UUID, error) {
+	postID, err := s.repo.Save(ctx, post)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	s.publishPost(ctx, postID, post.UserID)
+	return postID, nil
+}
+
+// sharedPostID returns the post shared when userID reposts or quotes postID, reposts share their
+// original. The posts of private accounts can only be shared by their followers.
+func (s *blogService) sharedPostID(ctx context.Context, userID, postID string) (string, error) {
+	post, err := s.repo.GetPost(ctx, postID)
+	if err != nil {
+		if errors.Is(err, m.ErrPostNotFound) {
+			return "", m.ErrSharedPostNotFound
+		}
+		return "", err
+	}
+	if post.DeletedAt != nil {
+		return "", m.ErrSharedPostNotFound
+	}
+	visible, err := s.postVisible(ctx, userID, post)
+	if err != nil {
+		return "", err
+	}
+	if !visible {
+		return "", m.ErrSharedPostNotFound
+	}
+	if post.Kind == m.PostKindRepost && post.RepostOf != nil {
+		return *post.RepostOf, nil
+	}
+	return post.ID, nil
+}
+
+func (s *blogService) GetTimeline(ctx context.Context, info m.TimelineRequest) (m.TimelineResponse, error) {
+	return s.repo.GetTimeline(ctx, info)
+}
+
+// GetPost returns a post, soft deleted posts are reported as m.ErrPostDeleted
+func (s *blogService) GetPost(ctx context.Context, viewerID, postID string) (m.Post, error) {
+	post, err := s.repo.GetPost(ctx, postID)
+	if err != nil {
+		return m.Post{}, err
+	}
+	visible, err := s.postVisible(ctx, viewerID, post)
+	if err != nil {
+		return m.Post{}, err
+	}
+	// the posts of private accounts do not exist for the users who do not follow them
+	if !visible {
+		return m.Post{}, m.ErrPostNotFound
+	}
+	if post.DeletedAt != nil {
+		return m.Post{}, m.ErrPostDeleted
+	}
+	return post, nil
+}
+
+// postVisible reports whether viewerID may read post, and the post it shares for reposts and quotes
+func (s *blogService) postVisible(ctx context.Context, viewerID string, post m.Post) (bool, error) {
+	authorIDs := []string{post.UserID}
+	if post.Original != nil {
+		authorIDs = append(authorIDs, post.Original.UserID)
+	}
+	for _, authorID := range authorIDs {
+		if authorID == viewerID {
+			continue
+		}
+		visible, err := s.repo.CanViewPosts(ctx, viewerID, authorID)
+		if err != nil || !visible {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// GetUserPosts returns a page of the posts of info.UserID read by info.ViewerID, private accounts
+// are only readable by their followers
+func (s *blogService) GetUserPosts(ctx context.Context, info m.TimelineRequest) (m.TimelineResponse, error) {
+	if info.ViewerID != "" && info.ViewerID != info.UserID {
+		visible, err := s.repo.CanViewPosts(ctx, info.ViewerID, info.UserID)
+		if err != nil {
+			return m.TimelineResponse{}, err
+		}
+		if !visible {
+			return m.TimelineResponse{}, m.ErrPrivateAccount
+		}
+	}
+	return s.repo.GetUserPosts(ctx, info)
+}
+
+// GetHashtagPosts returns a page of the live posts tagged with tag, newest first. info.UserID is
+// the reader: the posts it may not read, or whose author it blocked or muted, are left out.
+func (s *blogService) GetHashtagPosts(ctx context.Context, tag string, info m.TimelineRequest) (m.TimelineResponse, error) {
+	normalized, ok := normalizeHashtag(tag)
+	if !ok {
+		return m.TimelineResponse{}, m.ErrInvalidHashtag
+	}
+	return s.repo.GetHashtagPosts(ctx, normalized, info)
+}
+
+// GetMentions returns a page of the live posts mentioning info.UserID that info.ViewerID may read,
+// newest first
+func (s *blogService) GetMentions(ctx context.Context, info m.TimelineRequest) (m.TimelineResponse, error) {
+	return s.repo.GetMentions(ctx, info)
+}
+
+// GetThread returns the conversation around req.PostID: its ancestors up to the root and one page
+// of its replies as a tree. Deleted ancestors and replies are kept as tombstones without content,
+// the posts req.ViewerID may not read or whose author it blocked or muted are left out.
+func (s *blogService) GetThread(ctx context.Context, req m.ThreadRequest) (m.Thread, error) {
+	post, err := s.GetPost(ctx, req.ViewerID, req.PostID)
+	if err != nil {
+		return m.Thread{}, err
+	}
+	ancestors, err := s.repo.GetAncestors(ctx, req.ViewerID, req.PostID)
+	if err != nil {
+		return m.Thread{}, err
+	}
+	replies, err := s.repo.GetReplies(ctx, req)
+	if err != nil {
+		return m.Thread{}, err
+	}
+
+	thread := m.Thread{
+		Ancestors: tombstones(ancestors),
+		Post:      post,
+		Replies:   buildReplyTree(tombstones(replies)),
+	}
+	// the ancestors leave out the posts the viewer may not read, the first one is only the root of the
+	// conversation when it replies to nothing
+	switch {
+	case post.InReplyTo == nil:
+		thread.Root = &post
+	case len(thread.Ancestors) > 0 && thread.Ancestors[0].InReplyTo == nil:
+		thread.Root = &thread.Ancestors[0]
+	}
+	if len(replies) > 0 && len(replies) == req.Limit {
+		last := replies[len(replies)-1]
+		thread.LastReply = &last
+	}
+	return thread, nil
+}
+
+// tombstones blanks the content of deleted posts, with its content warning and mentions
+func tombstones(posts []m.Post) []m.Post {
+	out := make([]m.Post, len(posts))
+	for i, post := range posts {
+		if post.DeletedAt != nil {
+			post.Content = ""
+			post.ContentWarning = nil
+			post.Mentions = nil
+		}
+		out[i] = post
+	}
+	return out
+}
+
+// buildReplyTree nests replies ordered by (created_at, id) under their parent. Replies whose
+// parent is not part of the page are returned at the top level.
+func buildReplyTree(replies []m.Post) []m.ThreadNode {
+	inPage := make(map[string]bool, len(replies))
+	children := make(map[string][]m.Post, len(replies))
+	var top []m.Post
+	for _, reply := range replies {
+		inPage[reply.ID] = true
+		if reply.InReplyTo != nil && inPage[*reply.InReplyTo] {
+			children[*reply.InReplyTo] = append(children[*reply.InReplyTo], reply)
+			continue
+		}
+		top = append(top, reply)
+	}
+
+	var build func(posts []m.Post) []m.ThreadNode
+	build = func(posts []m.Post) []m.ThreadNode {
+		nodes := make([]m.ThreadNode, 0, len(posts))
+		for _, post := range posts {
+			nodes = append(nodes, m.ThreadNode{Post: post, Replies: build(children[post.ID])})
+		}
+		return nodes
+	}
+	return build(top)
+}
+
+// FollowUser follows followeeID on behalf of followerID and returns the state of the follow,
+// following a private account sends it a follow request
+func (s *blogService) FollowUser(ctx context.Context, followerID, followeeID string) (string, error) {
+	state, changed, err := s.repo.FollowUser(ctx, followerID, followeeID)
+	if err != nil {
+		return "", err
+	}
+	if changed && state == m.FollowActive {
+		s.publishNotification(followeeID, m.NotificationEvent{Type: m.NotificationFollow, ActorID: followerID})
 	}
-	return s.repo.Save(post)
+	return state, nil
+}
+func (s *blogService) UnfollowUser(ctx context.Context, followerID, followeeID string) error {
+	return s.repo.UnfollowUser(ctx, followerID, followeeID)
+}
+
+// GetFollowRequests returns the users waiting for req.UserID to approve their follow
+func (s *blogService) GetFollowRequests(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error) {
+	return s.repo.GetFollowRequests(ctx, req)
+}
+
+// ApproveFollowRequest lets followerID follow followeeID, who received its follow request
+func (s *blogService) ApproveFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	return s.repo.ApproveFollowRequest(ctx, followeeID, followerID)
+}
+
+// RejectFollowRequest drops the follow request of followerID to followeeID
+func (s *blogService) RejectFollowRequest(ctx context.Context, followeeID, followerID string) error {
+	return s.repo.RejectFollowRequest(ctx, followeeID, followerID)
 }
 
-func (s *blogService) GetTimeline(info m.TimelineRequest) (m.TimelineResponse, error) {
-	return s.repo.GetTimeline(info)
+// SetPrivate makes userID private or public, going public approves the pending follow requests
+func (s *blogService) SetPrivate(ctx context.Context, userID string, private bool) error {
+	return s.repo.SetPrivate(ctx, userID, private)
 }
 
-func (s *blogService) FollowUser(followerID, followeeID string) error {
-	return s.repo.FollowUser(followerID, followeeID)
+// BlockUser blocks blockedID for blockerID, it removes the follows between them and keeps them
+// from following each other
+func (s *blogService) BlockUser(ctx context.Context, blockerID, blockedID string) error {
+	if blockerID == blockedID {
+		return m.ErrCanNotBlockSelf
+	}
+	return s.repo.BlockUser(ctx, blockerID, blockedID)
 }
-func (s *blogService) UnfollowUser(followerID, followeeID string) error {
-	return s.repo.UnfollowUser(followerID, followeeID)
+
+func (s *blogService) UnblockUser(ctx context.Context, blockerID, blockedID string) error {
+	if blockerID == blockedID {
+		return m.ErrCanNotBlockSelf
+	}
+	return s.repo.UnblockUser(ctx, blockerID, blockedID)
 }
 
-func (s *blogService) GetFollowees(userID string, limit int) ([]string, error) {
-	return s.repo.GetFollowees(userID, limit)
+func (s *blogService) GetBlockedUsers(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error) {
+	return s.repo.GetBlockedUsers(ctx, req)
 }
 
-func (s *blogService) CreateUser(userData m.CreateUserRequest) (uuid.UUID, error) {
-	return s.repo.CreateUser(userData)
+// MuteUser hides the posts of mutedID from the timeline of muterID
+func (s *blogService) MuteUser(ctx context.Context, muterID, mutedID string) error {
+	if muterID == mutedID {
+		return m.ErrCanNotMuteSelf
+	}
+	return s.repo.MuteUser(ctx, muterID, mutedID)
 }
-func (s *blogService) UpdatePostPut(post m.CreatePostRequest) error {
-	return s.repo.UpdatePostPut(post)
+
+func (s *blogService) UnmuteUser(ctx context.Context, muterID, mutedID string) error {
+	if muterID == mutedID {
+		return m.ErrCanNotMuteSelf
+	}
+	return s.repo.UnmuteUser(ctx, muterID, mutedID)
 }
 
-func (s *blogService) DeleteUser(userID string) error {
-	return s.repo.DeleteUser(userID)
+func (s *blogService) GetMutedUsers(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error) {
+	return s.repo.GetMutedUsers(ctx, req)
 }
 
-func (s *blogService) GetUser(userID string) (m.User, error) {
-	return s.repo.GetUser(userID)
+func (s *blogService) GetFollowees(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error) {
+	return s.repo.GetFollowees(ctx, req)
+}
+
+func (s *blogService) GetFollowers(ctx context.Context, req m.FollowListRequest) (m.FollowListResponse, error) {
+	return s.repo.GetFollowers(ctx, req)
+}
+
+// CreateUser signs up a user. Its name must be mentionable, so it is restricted to the characters
+// of a mention.
+func (s *blogService) CreateUser(ctx context.Context, userData m.CreateUserRequest) (uuid.UUID, error) {
+	if !usernamePattern.MatchString(userData.Name) {
+		return uuid.Nil, m.ErrInvalidUsername
+	}
+	hash, err := auth.HashPassword(userData.Password)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("could not hash password: %w", err)
+	}
+	userData.Password = hash
+	return s.repo.CreateUser(ctx, userData)
+}
+
+// UpdatePostPut updates a post owned by userID, the authenticated author
+func (s *blogService) UpdatePostPut(ctx context.Context, userID string, post m.CreatePostRequest) error {
+	if post.UserID != "" && post.UserID != userID {
+		return m.ErrForbidden
+	}
+	post.UserID = userID
+	if err := s.checkEditWindow(ctx, userID, post.PostID); err != nil {
+		return err
+	}
+	post.Hashtags = extractHashtags(post.Content)
+	post.Mentions = extractMentions(post.Content)
+	return s.repo.UpdatePostPut(ctx, post)
+}
+
+// PatchPost applies a partial update to a post owned by userID and returns its new version
+func (s *blogService) PatchPost(ctx context.Context, userID string, post m.PatchPostRequest) (int, error) {
+	if post.Content == nil && post.ContentWarning == nil {
+		return 0, m.ErrEmptyPatch
+	}
+	post.UserID = userID
+	if err := s.checkEditWindow(ctx, userID, post.PostID); err != nil {
+		return 0, err
+	}
+	if post.Content != nil {
+		post.Hashtags = extractHashtags(*post.Content)
+		post.Mentions = extractMentions(*post.Content)
+	}
+	return s.repo.PatchPost(ctx, post)
+}
+
+// checkEditWindow returns ErrEditWindowExpired when the post of userID was created before the
+// edit window. created_at never changes, so the check does not need to share the update transaction.
+func (s *blogService) checkEditWindow(ctx context.Context, userID, postID string) error {
+	if s.editWindow <= 0 {
+		return nil
+	}
+	post, err := s.repo.GetPost(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if post.UserID != userID || post.DeletedAt != nil {
+		return m.ErrPostNotFound
+	}
+	if time.Since(post.CreatedAt) > s.editWindow {
+		return m.ErrEditWindowExpired
+	}
+	return nil
+}
+
+// GetPostRevisions returns the previous contents of a post viewerID can read, oldest first
+func (s *blogService) GetPostRevisions(ctx context.Context, viewerID, postID string) ([]m.PostRevision, error) {
+	if _, err := s.GetPost(ctx, viewerID, postID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPostRevisions(ctx, postID)
+}
+
+// DeletePost soft deletes a post owned by userID
+func (s *blogService) DeletePost(ctx context.Context, userID, postID string) error {
+	return s.repo.DeletePost(ctx, postID, userID)
+}
+
+// LikePost likes a post on behalf of userID, liking twice is a no-op
+func (s *blogService) LikePost(ctx context.Context, userID, postID string) error {
+	liked, err := s.repo.LikePost(ctx, userID, postID)
+	if err != nil {
+		return err
+	}
+	if liked {
+		s.publishPostNotification(ctx, m.NotificationLike, userID, postID)
+	}
+	return nil
+}
+
+// UnlikePost removes the like of userID, if any
+func (s *blogService) UnlikePost(ctx context.Context, userID, postID string) error {
+	_, err := s.repo.UnlikePost(ctx, userID, postID)
+	return err
+}
+
+// DeleteUser deletes userID's account, users can only delete themselves
+func (s *blogService) DeleteUser(ctx context.Context, actorID, userID string) error {
+	if actorID != userID {
+		return m.ErrForbidden
+	}
+	return s.repo.DeleteUser(ctx, userID)
+}
+
+func (s *blogService) GetUser(ctx context.Context, userID string) (m.User, error) {
+	return s.repo.GetUser(ctx, userID)
+}
+
+// GetUserProfile returns the public profile of userID read by viewerID, the last post is left out
+// when viewerID may not read it
+func (s *blogService) GetUserProfile(ctx context.Context, viewerID, userID string) (m.UserProfile, error) {
+	profile, err := s.repo.GetUserProfile(ctx, userID)
+	if err != nil || profile.LastPost == nil {
+		return profile, err
+	}
+	visible, err := s.postVisible(ctx, viewerID, *profile.LastPost)
+	if err != nil {
+		return m.UserProfile{}, err
+	}
+	if !visible {
+		profile.LastPost = nil
+	}
+	return profile, nil
+}
+
+// Login checks the user credentials and returns the ID of the authenticated user
+func (s *blogService) Login(ctx context.Context, req m.LoginRequest) (string, error) {
+	creds, err := s.repo.GetUserCredentials(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, m.ErrUserNotFound) {
+			return "", m.ErrInvalidCredentials
+		}
+		return "", err
+	}
+	if err := auth.CheckPassword(creds.PasswordHash, req.Password); err != nil {
+		return "", err
+	}
+	return creds.ID, nil
 }
@@ -3,7 +3,9 @@ package service
 import (
 	"errors"
 	"testing"
+	"time"
 
+	"microblogging/auth"
 	"microblogging/model"
 
 	"github.com/google/uuid"
@@ -23,7 +25,7 @@ func TestCreatePost(t *testing.T) {
 	}{
 		"success": {
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("Save", mock.MatchedBy(func(p *model.Post) bool {
+				mockRepo.On("Save", mock.Anything, mock.MatchedBy(func(p *model.Post) bool {
 					return p.UserID == userID && p.Content == content
 				})).Return(expectedUUID, nil)
 			},
@@ -32,7 +34,7 @@ func TestCreatePost(t *testing.T) {
 		},
 		"repo_error": {
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("Save", mock.Anything).Return(uuid.Nil, errors.New("db error"))
+				mockRepo.On("Save", mock.Anything, mock.Anything).Return(uuid.Nil, errors.New("db error"))
 			},
 			expected:  uuid.Nil,
 			expectErr: true,
@@ -45,7 +47,7 @@ func TestCreatePost(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			result, err := svc.CreatePost(userID, content)
+			result, err := svc.CreatePost(t.Context(), userID, model.CreatePostRequest{Content: content})
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -73,14 +75,14 @@ func TestGetUser(t *testing.T) {
 	}{
 		"success": {
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("GetUser", userID).Return(expectedUser, nil)
+				mockRepo.On("GetUser", mock.Anything, userID).Return(expectedUser, nil)
 			},
 			expected:  expectedUser,
 			expectErr: false,
 		},
 		"not_found": {
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("GetUser", userID).Return(model.User{}, errors.New("user not found"))
+				mockRepo.On("GetUser", mock.Anything, userID).Return(model.User{}, errors.New("user not found"))
 			},
 			expected:  model.User{},
 			expectErr: true,
@@ -93,7 +95,7 @@ func TestGetUser(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			result, err := svc.GetUser(userID)
+			result, err := svc.GetUser(t.Context(), userID)
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -106,6 +108,43 @@ func TestGetUser(t *testing.T) {
 		})
 	}
 }
+func TestGetUserProfile(t *testing.T) {
+	userID := uuid.New().String()
+	lastPost := &model.Post{ID: uuid.New().String(), UserID: userID, Content: "last"}
+
+	tests := []struct {
+		name         string
+		viewerID     string
+		visible      bool
+		wantLastPost bool
+	}{
+		{name: "own_profile", viewerID: userID, wantLastPost: true},
+		{name: "follower", viewerID: "follower", visible: true, wantLastPost: true},
+		{name: "private_account_non_follower", viewerID: "stranger", visible: false, wantLastPost: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo)
+			mockRepo.On("GetUserProfile", mock.Anything, userID).Return(model.UserProfile{ID: userID, Name: "Test User", FollowerCount: 2, LastPost: lastPost}, nil)
+			if tt.viewerID != userID {
+				mockRepo.On("CanViewPosts", mock.Anything, tt.viewerID, userID).Return(tt.visible, nil)
+			}
+
+			profile, err := svc.GetUserProfile(t.Context(), tt.viewerID, userID)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 2, profile.FollowerCount)
+			if tt.wantLastPost {
+				assert.Equal(t, lastPost, profile.LastPost)
+			} else {
+				assert.Nil(t, profile.LastPost)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestFollowUser(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -116,7 +155,7 @@ func TestFollowUser(t *testing.T) {
 		{
 			name: "success",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("FollowUser", "user-1", "user-2").Return(nil)
+				mockRepo.On("FollowUser", mock.Anything, "user-1", "user-2").Return(model.FollowActive, true, nil)
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: false,
@@ -124,7 +163,7 @@ func TestFollowUser(t *testing.T) {
 		{
 			name: "db_error",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("FollowUser", "user-1", "user-2").Return(errors.New("db error"))
+				mockRepo.On("FollowUser", mock.Anything, "user-1", "user-2").Return("", false, errors.New("db error"))
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: true,
@@ -132,7 +171,7 @@ func TestFollowUser(t *testing.T) {
 		{
 			name: "user_1_not_found",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("FollowUser", "user-1", "user-2").Return(errors.New("user-1 not found"))
+				mockRepo.On("FollowUser", mock.Anything, "user-1", "user-2").Return("", false, errors.New("user-1 not found"))
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: true,
@@ -140,7 +179,7 @@ func TestFollowUser(t *testing.T) {
 		{
 			name: "user_2_not_found",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("FollowUser", "user-1", "user-2").Return(errors.New("user-2 not found"))
+				mockRepo.On("FollowUser", mock.Anything, "user-1", "user-2").Return("", false, errors.New("user-2 not found"))
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: true,
@@ -153,7 +192,7 @@ func TestFollowUser(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			err := svc.FollowUser(tc.input[0], tc.input[1])
+			_, err := svc.FollowUser(t.Context(), tc.input[0], tc.input[1])
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -175,7 +214,7 @@ func TestUnfollowUser(t *testing.T) {
 		{
 			name: "success",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("UnfollowUser", "user-1", "user-2").Return(nil)
+				mockRepo.On("UnfollowUser", mock.Anything, "user-1", "user-2").Return(nil)
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: false,
@@ -183,7 +222,7 @@ func TestUnfollowUser(t *testing.T) {
 		{
 			name: "db_error",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("UnfollowUser", "user-1", "user-2").Return(errors.New("db error"))
+				mockRepo.On("UnfollowUser", mock.Anything, "user-1", "user-2").Return(errors.New("db error"))
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: true,
@@ -191,7 +230,7 @@ func TestUnfollowUser(t *testing.T) {
 		{
 			name: "user_1_not_found",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("UnfollowUser", "user-1", "user-2").Return(errors.New("user-1 not found"))
+				mockRepo.On("UnfollowUser", mock.Anything, "user-1", "user-2").Return(errors.New("user-1 not found"))
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: true,
@@ -199,7 +238,7 @@ func TestUnfollowUser(t *testing.T) {
 		{
 			name: "user_2_not_found",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("UnfollowUser", "user-1", "user-2").Return(errors.New("user-2 not found"))
+				mockRepo.On("UnfollowUser", mock.Anything, "user-1", "user-2").Return(errors.New("user-2 not found"))
 			},
 			input:     []string{"user-1", "user-2"},
 			expectErr: true,
@@ -212,7 +251,7 @@ func TestUnfollowUser(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			err := svc.UnfollowUser(tc.input[0], tc.input[1])
+			err := svc.UnfollowUser(t.Context(), tc.input[0], tc.input[1])
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -225,32 +264,28 @@ func TestUnfollowUser(t *testing.T) {
 }
 
 func TestGetFollowees(t *testing.T) {
+	req := model.FollowListRequest{UserID: "user-1", Limit: 10}
+	page := model.FollowListResponse{Users: []model.UserSummary{{ID: "user-2", Name: "bob"}, {ID: "user-3", Name: "carol"}}}
+
 	testCases := []struct {
 		name      string
 		setupMock func(mockRepo *MockPostRepository)
-		input     []string
-		limit     int
-		expected  []string
+		expected  model.FollowListResponse
 		expectErr bool
 	}{
 		{
 			name: "success",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("GetFollowees", "user-1", 10).Return([]string{"user-2", "user-3"}, nil)
+				mockRepo.On("GetFollowees", mock.Anything, req).Return(page, nil)
 			},
-			input:     []string{"user-1"},
-			limit:     10,
-			expected:  []string{"user-2", "user-3"},
+			expected:  page,
 			expectErr: false,
 		},
 		{
 			name: "db_error",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("GetFollowees", "user-1", 10).Return([]string{}, errors.New("db error"))
+				mockRepo.On("GetFollowees", mock.Anything, req).Return(model.FollowListResponse{}, errors.New("db error"))
 			},
-			input:     []string{"user-1"},
-			limit:     10,
-			expected:  []string{},
 			expectErr: true,
 		},
 	}
@@ -261,7 +296,7 @@ func TestGetFollowees(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			result, err := svc.GetFollowees(tc.input[0], tc.limit)
+			result, err := svc.GetFollowees(t.Context(), req)
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -274,6 +309,66 @@ func TestGetFollowees(t *testing.T) {
 	}
 }
 
+func TestGetFollowers(t *testing.T) {
+	req := model.FollowListRequest{UserID: "user-1", Limit: 10, After: "user-2"}
+	page := model.FollowListResponse{Users: []model.UserSummary{{ID: "user-3", Name: "carol"}}}
+
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	mockRepo.On("GetFollowers", mock.Anything, req).Return(page, nil)
+
+	result, err := svc.GetFollowers(t.Context(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, page, result)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBlockUser(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	mockRepo.On("BlockUser", mock.Anything, "user-1", "user-2").Return(nil)
+	mockRepo.On("UnblockUser", mock.Anything, "user-1", "user-2").Return(nil)
+
+	assert.NoError(t, svc.BlockUser(t.Context(), "user-1", "user-2"))
+	assert.NoError(t, svc.UnblockUser(t.Context(), "user-1", "user-2"))
+	assert.Equal(t, model.ErrCanNotBlockSelf, svc.BlockUser(t.Context(), "user-1", "user-1"))
+	assert.Equal(t, model.ErrCanNotBlockSelf, svc.UnblockUser(t.Context(), "user-1", "user-1"))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestMuteUser(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	mockRepo.On("MuteUser", mock.Anything, "user-1", "user-2").Return(nil)
+	mockRepo.On("UnmuteUser", mock.Anything, "user-1", "user-2").Return(errors.New("db error"))
+
+	assert.NoError(t, svc.MuteUser(t.Context(), "user-1", "user-2"))
+	assert.Error(t, svc.UnmuteUser(t.Context(), "user-1", "user-2"))
+	assert.Equal(t, model.ErrCanNotMuteSelf, svc.MuteUser(t.Context(), "user-1", "user-1"))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetUserPostsPrivate(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	follower := model.TimelineRequest{UserID: "author", ViewerID: "follower", Limit: 10}
+	stranger := model.TimelineRequest{UserID: "author", ViewerID: "stranger", Limit: 10}
+	own := model.TimelineRequest{UserID: "author", ViewerID: "author", Limit: 10}
+	mockRepo.On("CanViewPosts", mock.Anything, "follower", "author").Return(true, nil)
+	mockRepo.On("CanViewPosts", mock.Anything, "stranger", "author").Return(false, nil)
+	mockRepo.On("GetUserPosts", mock.Anything, follower).Return(model.TimelineResponse{}, nil)
+	mockRepo.On("GetUserPosts", mock.Anything, own).Return(model.TimelineResponse{}, nil)
+
+	_, err := svc.GetUserPosts(t.Context(), follower)
+	assert.NoError(t, err)
+	_, err = svc.GetUserPosts(t.Context(), stranger)
+	assert.Equal(t, model.ErrPrivateAccount, err)
+	_, err = svc.GetUserPosts(t.Context(), own)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
 func TestCreateUser(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -286,18 +381,25 @@ func TestCreateUser(t *testing.T) {
 			name: "success",
 			setupMock: func(mockRepo *MockPostRepository) {
 				expectedUUID := uuid.Must(uuid.Parse("66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf"))
-				mockRepo.On("CreateUser", mock.Anything).Return(expectedUUID, nil)
+				mockRepo.On("CreateUser", mock.Anything, mock.Anything).Return(expectedUUID, nil)
 			},
-			input:     model.CreateUserRequest{Name: "John Doe", Email: "oE5W0@example.com", Password: "password123"},
+			input:     model.CreateUserRequest{Name: "john_doe", Email: "oE5W0@example.com", Password: "password123"},
 			expected:  uuid.Must(uuid.Parse("66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf")),
 			expectErr: false,
 		},
 		{
 			name: "db_error",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("CreateUser", mock.Anything).Return(uuid.UUID{}, errors.New("db error"))
+				mockRepo.On("CreateUser", mock.Anything, mock.Anything).Return(uuid.UUID{}, errors.New("db error"))
 			},
-			input:     model.CreateUserRequest{Name: "Jane Doe"},
+			input:     model.CreateUserRequest{Name: "jane_doe"},
+			expected:  uuid.UUID{},
+			expectErr: true,
+		},
+		{
+			name:      "unmentionable_name",
+			setupMock: func(mockRepo *MockPostRepository) {},
+			input:     model.CreateUserRequest{Name: "john.doe", Email: "john@example.com", Password: "password123"},
 			expected:  uuid.UUID{},
 			expectErr: true,
 		},
@@ -309,7 +411,7 @@ func TestCreateUser(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			result, err := svc.CreateUser(tc.input)
+			result, err := svc.CreateUser(t.Context(), tc.input)
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -322,6 +424,79 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserHashesPassword(t *testing.T) {
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	input := model.CreateUserRequest{Name: "john_doe", Email: "oE5W0@example.com", Password: "password123"}
+
+	mockRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(u model.CreateUserRequest) bool {
+		return u.Name == input.Name && u.Password != input.Password &&
+			auth.CheckPassword(u.Password, input.Password) == nil
+	})).Return(uuid.New(), nil)
+
+	_, err := svc.CreateUser(t.Context(), input)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogin(t *testing.T) {
+	const userID = "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf"
+	hash, err := auth.HashPassword("password123")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		setupMock   func(mockRepo *MockPostRepository)
+		input       model.LoginRequest
+		expected    string
+		expectedErr error
+	}{
+		{
+			name: "success",
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetUserCredentials", mock.Anything, "john@example.com").Return(model.UserCredentials{ID: userID, PasswordHash: hash}, nil)
+			},
+			input:    model.LoginRequest{Email: "john@example.com", Password: "password123"},
+			expected: userID,
+		},
+		{
+			name: "wrong_password",
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetUserCredentials", mock.Anything, "john@example.com").Return(model.UserCredentials{ID: userID, PasswordHash: hash}, nil)
+			},
+			input:       model.LoginRequest{Email: "john@example.com", Password: "wrong"},
+			expectedErr: model.ErrInvalidCredentials,
+		},
+		{
+			name: "unknown_email",
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetUserCredentials", mock.Anything, "nobody@example.com").Return(model.UserCredentials{}, model.ErrUserNotFound)
+			},
+			input:       model.LoginRequest{Email: "nobody@example.com", Password: "password123"},
+			expectedErr: model.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo)
+			tc.setupMock(mockRepo)
+
+			result, err := svc.Login(t.Context(), tc.input)
+
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, result)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestUpdatePostPut(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -332,7 +507,7 @@ func TestUpdatePostPut(t *testing.T) {
 		{
 			name: "success",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("UpdatePostPut", model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"}).Return(nil)
+				mockRepo.On("UpdatePostPut", mock.Anything, model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"}).Return(nil)
 			},
 			input:     model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"},
 			expectErr: false,
@@ -340,11 +515,25 @@ func TestUpdatePostPut(t *testing.T) {
 		{
 			name: "db_error",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("UpdatePostPut", model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"}).Return(errors.New("db error"))
+				mockRepo.On("UpdatePostPut", mock.Anything, model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"}).Return(errors.New("db error"))
 			},
 			input:     model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"},
 			expectErr: true,
 		},
+		{
+			name: "user_id_taken_from_caller",
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("UpdatePostPut", mock.Anything, model.CreatePostRequest{UserID: "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", Content: "Updated content"}).Return(nil)
+			},
+			input:     model.CreatePostRequest{Content: "Updated content"},
+			expectErr: false,
+		},
+		{
+			name:      "other_author",
+			setupMock: func(mockRepo *MockPostRepository) {},
+			input:     model.CreatePostRequest{UserID: "11111111-1111-1111-1111-111111111111", Content: "Updated content"},
+			expectErr: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -353,7 +542,7 @@ func TestUpdatePostPut(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			err := svc.UpdatePostPut(tc.input)
+			err := svc.UpdatePostPut(t.Context(), "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf", tc.input)
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -365,6 +554,265 @@ func TestUpdatePostPut(t *testing.T) {
 	}
 }
 
+func TestUpdatePostPutEditWindow(t *testing.T) {
+	const userID = "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf"
+	const postID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	deletedAt := time.Now()
+
+	testCases := []struct {
+		name        string
+		mockPost    model.Post
+		expectedErr error
+	}{
+		{
+			name:     "within_window",
+			mockPost: model.Post{ID: postID, UserID: userID, CreatedAt: time.Now().Add(-time.Minute)},
+		},
+		{
+			name:        "window_expired",
+			mockPost:    model.Post{ID: postID, UserID: userID, CreatedAt: time.Now().Add(-time.Hour)},
+			expectedErr: model.ErrEditWindowExpired,
+		},
+		{
+			name:        "other_author",
+			mockPost:    model.Post{ID: postID, UserID: "author", CreatedAt: time.Now()},
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:        "deleted",
+			mockPost:    model.Post{ID: postID, UserID: userID, CreatedAt: time.Now(), DeletedAt: &deletedAt},
+			expectedErr: model.ErrPostNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo, WithEditWindow(15*time.Minute))
+			mockRepo.On("GetPost", mock.Anything, postID).Return(tc.mockPost, nil)
+			if tc.expectedErr == nil {
+				mockRepo.On("UpdatePostPut", mock.Anything, mock.MatchedBy(func(post model.CreatePostRequest) bool { return post.PostID == postID })).Return(nil)
+			}
+
+			err := svc.UpdatePostPut(t.Context(), userID, model.CreatePostRequest{PostID: postID, Content: "edited"})
+
+			assert.Equal(t, tc.expectedErr, err)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPatchPost(t *testing.T) {
+	const userID = "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf"
+	const postID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	content := "hello #go"
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+
+	_, err := svc.PatchPost(t.Context(), userID, model.PatchPostRequest{PostID: postID})
+	assert.Equal(t, model.ErrEmptyPatch, err)
+
+	mockRepo.On("PatchPost", mock.Anything, model.PatchPostRequest{PostID: postID, UserID: userID, Content: &content, Versions: []int{2}, Hashtags: []string{"go"}}).Return(3, nil)
+	version, err := svc.PatchPost(t.Context(), userID, model.PatchPostRequest{PostID: postID, Content: &content, Versions: []int{2}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDeletePost(t *testing.T) {
+	const userID = "66e95b4d-1f09-4cfb-b71d-bb80f92a8dbf"
+	const postID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+
+	testCases := []struct {
+		name        string
+		mockErr     error
+		expectedErr error
+	}{
+		{name: "success"},
+		{name: "not_found", mockErr: model.ErrPostNotFound, expectedErr: model.ErrPostNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo)
+			mockRepo.On("DeletePost", mock.Anything, postID, userID).Return(tc.mockErr)
+
+			err := svc.DeletePost(t.Context(), userID, postID)
+
+			assert.Equal(t, tc.expectedErr, err)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPost(t *testing.T) {
+	const postID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	deletedAt := time.Now()
+
+	testCases := []struct {
+		name        string
+		mockPost    model.Post
+		mockErr     error
+		visible     bool
+		expected    model.Post
+		expectedErr error
+	}{
+		{
+			name:     "success",
+			mockPost: model.Post{ID: postID, UserID: "author", Content: "Hello"},
+			visible:  true,
+			expected: model.Post{ID: postID, UserID: "author", Content: "Hello"},
+		},
+		{
+			name:        "not_found",
+			mockErr:     model.ErrPostNotFound,
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:        "deleted",
+			mockPost:    model.Post{ID: postID, UserID: "author", DeletedAt: &deletedAt},
+			visible:     true,
+			expectedErr: model.ErrPostDeleted,
+		},
+		{
+			name:        "private_author",
+			mockPost:    model.Post{ID: postID, UserID: "author", Content: "Hello"},
+			expectedErr: model.ErrPostNotFound,
+		},
+		{
+			name:        "private_original",
+			mockPost:    model.Post{ID: postID, UserID: "viewer", Kind: model.PostKindQuote, Original: &model.Post{UserID: "author"}},
+			expectedErr: model.ErrPostNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo)
+			mockRepo.On("GetPost", mock.Anything, postID).Return(tc.mockPost, tc.mockErr)
+			if tc.mockErr == nil {
+				mockRepo.On("CanViewPosts", mock.Anything, "viewer", "author").Return(tc.visible, nil)
+			}
+
+			post, err := svc.GetPost(t.Context(), "viewer", postID)
+
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expected, post)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetPostRevisions(t *testing.T) {
+	const postID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+	revisions := []model.PostRevision{{PostID: postID, Revision: 1, Content: "first"}}
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	mockRepo.On("GetPost", mock.Anything, postID).Return(model.Post{ID: postID, UserID: "author", Edited: true, EditCount: 1}, nil)
+	mockRepo.On("CanViewPosts", mock.Anything, "viewer", "author").Return(true, nil).Once()
+	mockRepo.On("GetPostRevisions", mock.Anything, postID).Return(revisions, nil).Once()
+
+	got, err := svc.GetPostRevisions(t.Context(), "viewer", postID)
+	assert.NoError(t, err)
+	assert.Equal(t, revisions, got)
+
+	mockRepo.On("CanViewPosts", mock.Anything, "viewer", "author").Return(false, nil).Once()
+	_, err = svc.GetPostRevisions(t.Context(), "viewer", postID)
+	assert.Equal(t, model.ErrPostNotFound, err, "revisions of posts the viewer cannot read are not returned")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetThread(t *testing.T) {
+	const (
+		rootID   = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+		postID   = "bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb"
+		replyID  = "cccccccc-cccc-cccc-cccc-cccccccccccc"
+		nestedID = "dddddddd-dddd-dddd-dddd-dddddddddddd"
+		laterID  = "eeeeeeee-eeee-eeee-eeee-eeeeeeeeeeee"
+	)
+	parent := func(id string) *string { return &id }
+	deletedAt := time.Now()
+
+	mockRepo := new(MockPostRepository)
+	svc := NewBlogService(mockRepo)
+	req := model.ThreadRequest{PostID: postID, ViewerID: "viewer", Limit: 3}
+	mockRepo.On("GetPost", mock.Anything, postID).Return(model.Post{ID: postID, UserID: "author", Content: "post", InReplyTo: parent(rootID)}, nil)
+	mockRepo.On("CanViewPosts", mock.Anything, "viewer", "author").Return(true, nil)
+	mockRepo.On("GetAncestors", mock.Anything, "viewer", postID).Return([]model.Post{{ID: rootID, Content: "root", DeletedAt: &deletedAt}}, nil)
+	mockRepo.On("GetReplies", mock.Anything, req).Return([]model.Post{
+		{ID: replyID, Content: "reply", InReplyTo: parent(postID)},
+		{ID: nestedID, Content: "nested", InReplyTo: parent(replyID)},
+		{ID: laterID, Content: "later", InReplyTo: parent(postID)},
+	}, nil)
+
+	thread, err := svc.GetThread(t.Context(), req)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, thread.Root) {
+		assert.Equal(t, rootID, thread.Root.ID)
+		assert.Empty(t, thread.Root.Content, "deleted ancestors are tombstones")
+	}
+	assert.Equal(t, postID, thread.Post.ID)
+	if assert.Len(t, thread.Replies, 2) {
+		assert.Equal(t, replyID, thread.Replies[0].ID)
+		if assert.Len(t, thread.Replies[0].Replies, 1) {
+			assert.Equal(t, nestedID, thread.Replies[0].Replies[0].ID)
+		}
+		assert.Equal(t, laterID, thread.Replies[1].ID)
+	}
+	if assert.NotNil(t, thread.LastReply) {
+		assert.Equal(t, laterID, thread.LastReply.ID)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetThreadRoot(t *testing.T) {
+	const rootID, parentID, postID = "root", "parent", "post"
+	parent := func(id string) *string { return &id }
+	tests := []struct {
+		name      string
+		post      model.Post
+		ancestors []model.Post
+		root      *model.Post
+	}{
+		{
+			name: "post_is_the_root",
+			post: model.Post{ID: rootID, UserID: "author"},
+			root: &model.Post{ID: rootID, UserID: "author"},
+		},
+		{
+			name:      "readable_root",
+			post:      model.Post{ID: postID, UserID: "author", InReplyTo: parent(parentID)},
+			ancestors: []model.Post{{ID: rootID}, {ID: parentID, InReplyTo: parent(rootID)}},
+			root:      &model.Post{ID: rootID},
+		},
+		{
+			name:      "hidden_root",
+			post:      model.Post{ID: postID, UserID: "author", InReplyTo: parent(parentID)},
+			ancestors: []model.Post{{ID: parentID, InReplyTo: parent(rootID)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo)
+			req := model.ThreadRequest{PostID: tt.post.ID, ViewerID: "viewer", Limit: 10}
+			mockRepo.On("GetPost", mock.Anything, tt.post.ID).Return(tt.post, nil)
+			mockRepo.On("CanViewPosts", mock.Anything, "viewer", "author").Return(true, nil)
+			mockRepo.On("GetAncestors", mock.Anything, "viewer", tt.post.ID).Return(tt.ancestors, nil)
+			mockRepo.On("GetReplies", mock.Anything, req).Return([]model.Post{}, nil)
+
+			thread, err := svc.GetThread(t.Context(), req)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.root, thread.Root, "the root is left out when the viewer may not read it")
+		})
+	}
+}
+
 func TestDeleteUser(t *testing.T) {
 	testCases := []struct {
 		name      string
@@ -375,7 +823,7 @@ func TestDeleteUser(t *testing.T) {
 		{
 			name: "success",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("DeleteUser", "user-1").Return(nil)
+				mockRepo.On("DeleteUser", mock.Anything, "user-1").Return(nil)
 			},
 			input:     "user-1",
 			expectErr: false,
@@ -383,11 +831,17 @@ func TestDeleteUser(t *testing.T) {
 		{
 			name: "db_error",
 			setupMock: func(mockRepo *MockPostRepository) {
-				mockRepo.On("DeleteUser", "user-1").Return(errors.New("db error"))
+				mockRepo.On("DeleteUser", mock.Anything, "user-1").Return(errors.New("db error"))
 			},
 			input:     "user-1",
 			expectErr: true,
 		},
+		{
+			name:      "other_user",
+			setupMock: func(mockRepo *MockPostRepository) {},
+			input:     "user-2",
+			expectErr: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -396,7 +850,7 @@ func TestDeleteUser(t *testing.T) {
 			svc := NewBlogService(mockRepo)
 			tc.setupMock(mockRepo)
 
-			err := svc.DeleteUser(tc.input)
+			err := svc.DeleteUser(t.Context(), "user-1", tc.input)
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -407,6 +861,93 @@ func TestDeleteUser(t *testing.T) {
 		})
 	}
 }
+func TestRepostAndQuote(t *testing.T) {
+	userID := uuid.New().String()
+	originalID := uuid.New().String()
+	repostID := uuid.New().String()
+	newID := uuid.New()
+	deletedAt := time.Now()
+
+	tests := map[string]struct {
+		setupMock func(mockRepo *MockPostRepository)
+		call      func(svc BlogService) (uuid.UUID, error)
+		expectErr error
+	}{
+		"repost": {
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetPost", mock.Anything, originalID).Return(model.Post{ID: originalID, Kind: model.PostKindPost}, nil)
+				mockRepo.On("Save", mock.Anything, mock.MatchedBy(func(p *model.Post) bool {
+					return p.UserID == userID && p.Kind == model.PostKindRepost && *p.RepostOf == originalID
+				})).Return(newID, nil)
+			},
+			call: func(svc BlogService) (uuid.UUID, error) { return svc.Repost(t.Context(), userID, originalID) },
+		},
+		"repost_of_repost_shares_original": {
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetPost", mock.Anything, repostID).Return(model.Post{ID: repostID, Kind: model.PostKindRepost, RepostOf: &originalID}, nil)
+				mockRepo.On("Save", mock.Anything, mock.MatchedBy(func(p *model.Post) bool {
+					return *p.RepostOf == originalID
+				})).Return(newID, nil)
+			},
+			call: func(svc BlogService) (uuid.UUID, error) { return svc.Repost(t.Context(), userID, repostID) },
+		},
+		"quote": {
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetPost", mock.Anything, originalID).Return(model.Post{ID: originalID, Kind: model.PostKindPost}, nil)
+				mockRepo.On("Save", mock.Anything, mock.MatchedBy(func(p *model.Post) bool {
+					return p.Kind == model.PostKindQuote && p.Content == "so true" && *p.RepostOf == originalID
+				})).Return(newID, nil)
+			},
+			call: func(svc BlogService) (uuid.UUID, error) {
+				return svc.CreatePost(t.Context(), userID, model.CreatePostRequest{Content: "so true", QuoteOf: originalID})
+			},
+		},
+		"deleted_original": {
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetPost", mock.Anything, originalID).Return(model.Post{ID: originalID, DeletedAt: &deletedAt}, nil)
+			},
+			call:      func(svc BlogService) (uuid.UUID, error) { return svc.Repost(t.Context(), userID, originalID) },
+			expectErr: model.ErrSharedPostNotFound,
+		},
+		"private_original": {
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetPost", mock.Anything, originalID).Return(model.Post{ID: originalID, UserID: "author", Kind: model.PostKindPost}, nil)
+				mockRepo.On("CanViewPosts", mock.Anything, userID, "author").Return(false, nil)
+			},
+			call:      func(svc BlogService) (uuid.UUID, error) { return svc.Repost(t.Context(), userID, originalID) },
+			expectErr: model.ErrSharedPostNotFound,
+		},
+		"missing_original": {
+			setupMock: func(mockRepo *MockPostRepository) {
+				mockRepo.On("GetPost", mock.Anything, originalID).Return(model.Post{}, model.ErrPostNotFound)
+			},
+			call: func(svc BlogService) (uuid.UUID, error) {
+				return svc.CreatePost(t.Context(), userID, model.CreatePostRequest{Content: "so true", QuoteOf: originalID})
+			},
+			expectErr: model.ErrSharedPostNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockPostRepository)
+			svc := NewBlogService(mockRepo)
+			tc.setupMock(mockRepo)
+			mockRepo.On("CanViewPosts", mock.Anything, userID, "").Return(true, nil).Maybe()
+
+			id, err := tc.call(svc)
+
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, newID, id)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestCreatePostSave(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -456,14 +997,14 @@ func TestCreatePostSave(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(MockPostRepository)
 
-			mockRepo.On("Save", mock.AnythingOfType("*model.Post")).Return(
+			mockRepo.On("Save", mock.Anything, mock.AnythingOfType("*model.Post")).Return(
 				tt.mockReturn.id,
 				tt.mockReturn.err,
 			)
 
 			svc := NewBlogService(mockRepo)
 
-			id, err := svc.CreatePost(tt.input.UserID, tt.input.Content)
+			id, err := svc.CreatePost(t.Context(), tt.input.UserID, model.CreatePostRequest{Content: tt.input.Content})
 
 			if tt.expectErr {
 				assert.Error(t, err)